@@ -1,15 +1,26 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
 
+	log "github.com/Sirupsen/logrus"
 	xplatform "github.com/dvonthenen/goxplatform"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
 var (
 	//ErrInvalidRestURI The REST URI provided is not valid
 	ErrInvalidRestURI = errors.New("The REST URI provided is not valid")
+
+	//ErrInvalidCAFile The CA file does not contain any certificates
+	ErrInvalidCAFile = errors.New("The CA file does not contain any certificates")
 )
 
 //Config is the representation of the config
@@ -19,6 +30,11 @@ type Config struct {
 	MesosAgent   string
 	FrameworkID  string
 	ExecutorID   string
+	Token        string
+	TLSCAFile    string
+	TLSInsecure  bool
+
+	client *http.Client
 }
 
 //AddFlags adds flags to the command line parsing
@@ -27,6 +43,10 @@ func (cfg *Config) AddFlags(fs *flag.FlagSet) {
 		"Set the logging level for the application")
 	fs.StringVar(&cfg.SchedulerURI, "rest.uri", cfg.SchedulerURI,
 		"Scheduler REST API URI")
+	fs.StringVar(&cfg.TLSCAFile, "rest.tls.cafile", cfg.TLSCAFile,
+		"CA file used to verify the scheduler REST API certificate")
+	fs.BoolVar(&cfg.TLSInsecure, "rest.tls.insecure", cfg.TLSInsecure,
+		"Skip verifying the scheduler REST API certificate")
 
 	fs.StringVar(&cfg.MesosAgent, "mesos.agent", cfg.MesosAgent,
 		"Mesos Agent address")
@@ -44,6 +64,9 @@ func NewConfig() *Config {
 		MesosAgent:   env("MESOS_AGENT_ENDPOINT", "127.0.0.1"),
 		FrameworkID:  env("MESOS_FRAMEWORK_ID", ""),
 		ExecutorID:   env("MESOS_EXECUTOR_ID", ""),
+		Token:        env(types.ExecutorTokenEnv, ""),
+		TLSCAFile:    env("REST_TLS_CAFILE", ""),
+		TLSInsecure:  envBool("REST_TLS_INSECURE", "false"),
 	}
 }
 
@@ -59,3 +82,58 @@ func (cfg *Config) ParseIPFromRestURI() (string, error) {
 	ip := strings[1]
 	return ip, nil
 }
+
+//NewRequest creates a request to the scheduler REST API that carries the
+//credentials of this executor
+func (cfg *Config) NewRequest(method string, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	req.Header.Set(types.ExecutorIDHeader, cfg.ExecutorID)
+
+	return req, nil
+}
+
+//HTTPClient returns the client used to talk to the scheduler REST API
+func (cfg *Config) HTTPClient() *http.Client {
+	if cfg.client != nil {
+		return cfg.client
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+	if len(cfg.TLSCAFile) > 0 {
+		pool, err := loadCAFile(cfg.TLSCAFile)
+		if err == nil {
+			tlsConfig.RootCAs = pool
+		} else {
+			log.Errorln("Failed to load CA file", cfg.TLSCAFile, ". Err:", err)
+		}
+	}
+
+	cfg.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	return cfg.client
+}
+
+func loadCAFile(filename string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrInvalidCAFile
+	}
+	return pool, nil
+}
@@ -21,6 +21,10 @@ func envInt(key, defaultValue string) int {
 	return value
 }
 
+func envBool(key, defaultValue string) bool {
+	return env(key, defaultValue) == "true"
+}
+
 func envDuration(key, defaultValue string) time.Duration {
 	value, err := time.ParseDuration(env(key, defaultValue))
 	if err != nil {
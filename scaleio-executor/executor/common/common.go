@@ -77,6 +77,13 @@ func GetSelfNode(state *types.ScaleIOFramework, executorID string) *types.ScaleI
 	return nil
 }
 
+//IsClientOnly returns true when the node only consumes storage. It only needs
+//the SDC.
+func IsClientOnly(node *types.ScaleIONode) bool {
+	return node != nil && node.Imperative && len(node.ProvidesDomains) == 0 &&
+		len(node.ConsumesDomains) > 0
+}
+
 func getNodeType(state *types.ScaleIOFramework, nodeType int) (*types.ScaleIONode, error) {
 	for _, node := range state.ScaleIO.Nodes {
 		if node.Persona == nodeType {
@@ -157,10 +164,16 @@ func CreateMdmPairString(state *types.ScaleIOFramework) (string, error) {
 	return str, nil
 }
 
-//GenerateSdsName creates the SDS name for this given node
-func GenerateSdsName(node *types.ScaleIONode) string {
-	str := "sds-" + node.Hostname
-	return str
+//GenerateSdsNames returns the names of the SDSs the node runs in each
+//ProtectionDomain it provides
+func GenerateSdsNames(node *types.ScaleIONode) map[string][]string {
+	names := make(map[string][]string)
+	for _, domain := range node.ProvidesDomains {
+		for _, sds := range domain.GetSdss(node.IPAddress) {
+			names[domain.Name] = append(names[domain.Name], sds.Name)
+		}
+	}
+	return names
 }
 
 //GetGatewayAddress returns the ScaleIO gateway address
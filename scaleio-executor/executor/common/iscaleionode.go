@@ -6,9 +6,12 @@ import "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 type IScaleioNode interface {
 	GetSelfNode() *types.ScaleIONode
 	UpdateScaleIOState() *types.ScaleIOFramework
+	WaitForScaleIOStateChange(revision uint64) *types.ScaleIOFramework
 	UpdateNodeState(nodeState int) error
+	UpdateNodeFailure(step string, stepErr error) error
 	UpdateDevices() error
 	UpdatePingNode() error
+	ReleaseRebootLease() error
 
 	RunStateUnknown()
 	RunStateCleanPrereqsReboot()
@@ -22,4 +25,6 @@ type IScaleioNode interface {
 	RunStateFinishInstall()
 	RunStateUpgradeCluster()
 	RunStateFatalInstall()
+	RunStateDecommission()
+	RunStateDecommissioned()
 }
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	//FailureOutputLines is the number of output lines sent to the scheduler
+	//when an install step fails
+	FailureOutputLines = 100
+)
+
+//CommandOutput keeps the stdout and stderr of the most recent command lines
+//so the output leading up to a failure can be reported to the scheduler
+type CommandOutput struct {
+	sync.Mutex
+	lines []string
+}
+
+//RecentOutput is the output of the command lines run by RunCommand
+var RecentOutput = &CommandOutput{}
+
+func splitOutput(output string) []string {
+	output = strings.TrimRight(output, "\n")
+	if len(output) == 0 {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+//Add keeps the output of a command line dropping the oldest lines past
+//FailureOutputLines
+func (co *CommandOutput) Add(cmdline string, stdout string, stderr string) {
+	co.Lock()
+	defer co.Unlock()
+
+	co.lines = append(co.lines, "$ "+cmdline)
+	co.lines = append(co.lines, splitOutput(stdout)...)
+	for _, line := range splitOutput(stderr) {
+		co.lines = append(co.lines, "[stderr] "+line)
+	}
+	if len(co.lines) > FailureOutputLines {
+		co.lines = co.lines[len(co.lines)-FailureOutputLines:]
+	}
+}
+
+//String returns the recent output
+func (co *CommandOutput) String() string {
+	co.Lock()
+	defer co.Unlock()
+
+	return strings.Join(co.lines, "\n")
+}
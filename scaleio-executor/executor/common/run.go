@@ -0,0 +1,123 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//CommandTimeoutInSeconds is how long a command line can run before it is
+	//killed
+	CommandTimeoutInSeconds = 3600
+)
+
+var (
+	//ErrCommandTimeout the command line did not finish in time
+	ErrCommandTimeout = errors.New("The command line timed out")
+
+	//ErrCommandFailed the output of the command line shows it failed
+	ErrCommandFailed = errors.New("The output of the command line shows it failed")
+
+	//ErrCommandCheckFailed the output of the command line does not show it
+	//succeeded
+	ErrCommandCheckFailed = errors.New("The output of the command line does not show it succeeded")
+)
+
+func readOutput(file *os.File) string {
+	output, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		log.Warnln("Unable to read the output of the command line:", err)
+		return ""
+	}
+	return string(output)
+}
+
+//runCommand runs the command line in a shell and returns its stdout and
+//stderr, which are also kept in RecentOutput. The output goes to files and not
+//pipes so a daemon started by the command line does not hold it up.
+func runCommand(cmdline string, timeoutInSeconds int) (string, string, error) {
+	stdoutFile, err := ioutil.TempFile("", "scaleio-stdout")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(stdoutFile.Name())
+	defer stdoutFile.Close()
+
+	stderrFile, err := ioutil.TempFile("", "scaleio-stderr")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(stderrFile.Name())
+	defer stderrFile.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(timeoutInSeconds)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", cmdline)
+	cmd.Stdout = stdoutFile
+	cmd.Stderr = stderrFile
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = ErrCommandTimeout
+	}
+
+	stdout := readOutput(stdoutFile)
+	stderr := readOutput(stderrFile)
+	RecentOutput.Add(cmdline, stdout, stderr)
+
+	return stdout, stderr, err
+}
+
+//RunCommand runs a command line and checks its output. The command line
+//succeeded when its output matches successRegex, or when it exits with 0 and
+//successRegex is empty. Output matching failureRegex is always a failure.
+func RunCommand(cmdline string, successRegex string, failureRegex string) error {
+	return RunCommandEx(cmdline, successRegex, failureRegex, CommandTimeoutInSeconds)
+}
+
+//RunCommandEx is RunCommand with a timeout
+func RunCommandEx(cmdline string, successRegex string, failureRegex string,
+	timeoutInSeconds int) error {
+	stdout, stderr, err := runCommand(cmdline, timeoutInSeconds)
+	output := stdout + stderr
+
+	if len(failureRegex) > 0 {
+		matched, errRegex := regexp.MatchString(failureRegex, output)
+		if errRegex != nil {
+			return errRegex
+		}
+		if matched {
+			return ErrCommandFailed
+		}
+	}
+
+	if len(successRegex) == 0 {
+		return err
+	}
+	matched, errRegex := regexp.MatchString(successRegex, output)
+	if errRegex != nil {
+		return errRegex
+	}
+	if matched {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrCommandCheckFailed
+}
+
+//RunCommandOutput runs a command line and returns its stdout
+func RunCommandOutput(cmdline string) (string, error) {
+	stdout, _, err := runCommand(cmdline, CommandTimeoutInSeconds)
+	return strings.TrimSpace(stdout), err
+}
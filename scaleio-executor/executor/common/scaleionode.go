@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"strings"
 	"time"
 
@@ -37,41 +36,85 @@ func (bsn *ScaleioNode) UpdateScaleIOState() *types.ScaleIOFramework {
 	return bsn.State
 }
 
+//WaitForScaleIOStateChange updates the state of the framework once it is
+//newer than the revision
+func (bsn *ScaleioNode) WaitForScaleIOStateChange(revision uint64) *types.ScaleIOFramework {
+	bsn.State = WaitForStateChange(bsn.GetState, revision)
+	bsn.Node = GetSelfNode(bsn.State, bsn.Config.ExecutorID)
+	return bsn.State
+}
+
 //UpdateNodeState this function tells the scheduler that the executor's state
 //has changed
 func (bsn *ScaleioNode) UpdateNodeState(nodeState int) error {
 	log.Debugln("NotifyNodeState ENTER")
 	log.Debugln("State:", nodeState)
 
-	url := bsn.State.SchedulerAddress + "/api/node/state"
-
 	state := &types.UpdateNode{
 		Acknowledged: false,
 		ExecutorID:   bsn.Config.ExecutorID,
 		State:        nodeState,
 	}
 
+	err := bsn.notifyNodeState(state)
+
+	log.Debugln("NotifyNodeState LEAVE")
+	return err
+}
+
+//UpdateNodeFailure this function tells the scheduler that an install step
+//failed along with the output leading up to the failure
+func (bsn *ScaleioNode) UpdateNodeFailure(step string, stepErr error) error {
+	log.Debugln("UpdateNodeFailure ENTER")
+	log.Debugln("Step:", step)
+
+	output := RecentOutput.String()
+	if stepErr != nil {
+		output = output + "\n" + stepErr.Error()
+	}
+	if bsn.State != nil && len(bsn.State.ScaleIO.AdminPassword) > 0 {
+		output = strings.Replace(output, bsn.State.ScaleIO.AdminPassword, "<redacted>", -1)
+	}
+
+	state := &types.UpdateNode{
+		Acknowledged: false,
+		ExecutorID:   bsn.Config.ExecutorID,
+		State:        types.StateFatalInstall,
+		FailedStep:   step,
+		Output:       output,
+	}
+
+	err := bsn.notifyNodeState(state)
+
+	log.Debugln("UpdateNodeFailure LEAVE")
+	return err
+}
+
+func (bsn *ScaleioNode) notifyNodeState(state *types.UpdateNode) error {
+	//the scheduler rejects the same transitions
+	if bsn.Node != nil && !types.IsValidTransition(bsn.Node.State, state.State) {
+		log.Errorln("Unable to move from state", bsn.Node.State, "to state", state.State)
+		return types.ErrInvalidStateTransition
+	}
+
+	url := bsn.State.SchedulerAddress + types.APIPrefix + "/node/state"
+
 	response, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		log.Errorln("Failed to marshall state object:", err)
-		log.Debugln("NotifyNodeState LEAVE")
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	req, err := bsn.Config.NewRequest("POST", url, bytes.NewBuffer(response))
 	if err != nil {
 		log.Errorln("Failed to create new HTTP request:", err)
-		log.Debugln("NotifyNodeState LEAVE")
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
+	client := bsn.Config.HTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Errorln("Failed to make HTTP call:", err)
-		log.Debugln("NotifyNodeState LEAVE")
 		return err
 	}
 
@@ -80,7 +123,6 @@ func (bsn *ScaleioNode) UpdateNodeState(nodeState int) error {
 	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
 	if err != nil {
 		log.Errorln("Failed to read the HTTP Body:", err)
-		log.Debugln("NotifyNodeState LEAVE")
 		return err
 	}
 
@@ -92,7 +134,6 @@ func (bsn *ScaleioNode) UpdateNodeState(nodeState int) error {
 	err = json.Unmarshal(body, &newstate)
 	if err != nil {
 		log.Errorln("Failed to unmarshal the UpdateState object:", err)
-		log.Debugln("NotifyNodeState LEAVE")
 		return err
 	}
 
@@ -102,12 +143,15 @@ func (bsn *ScaleioNode) UpdateNodeState(nodeState int) error {
 
 	if !newstate.Acknowledged {
 		log.Errorln("Failed to receive an acknowledgement")
-		log.Debugln("NotifyNodeState LEAVE")
 		return ErrStateChangeNotAcknowledged
 	}
 
+	//keep track of the state until the next refresh from the scheduler
+	if bsn.Node != nil {
+		bsn.Node.State = state.State
+	}
+
 	log.Errorln("NotifyNodeState Succeeded")
-	log.Debugln("NotifyNodeState LEAVE")
 	return nil
 }
 
@@ -130,7 +174,7 @@ func (bsn *ScaleioNode) UpdateDevices() error {
 		return nil
 	}
 
-	url := bsn.State.SchedulerAddress + "/api/node/device"
+	url := bsn.State.SchedulerAddress + types.APIPrefix + "/node/device"
 
 	state := &types.UpdateDevices{
 		Acknowledged: false,
@@ -174,16 +218,14 @@ func (bsn *ScaleioNode) UpdateDevices() error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	req, err := bsn.Config.NewRequest("POST", url, bytes.NewBuffer(response))
 	if err != nil {
 		log.Errorln("Failed to create new HTTP request:", err)
 		log.Debugln("UpdateDevices LEAVE")
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
+	client := bsn.Config.HTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Errorln("Failed to make HTTP call:", err)
@@ -230,7 +272,8 @@ func (bsn *ScaleioNode) UpdateDevices() error {
 func (bsn *ScaleioNode) UpdatePingNode() error {
 	log.Debugln("UpdatePingNode ENTER")
 
-	url := bsn.State.SchedulerAddress + "/api/node/ping"
+	//pings run next to the main loop so they don't read the state
+	url := bsn.Config.SchedulerURI + types.APIPrefix + "/node/ping"
 
 	state := &types.PingNode{
 		Acknowledged: false,
@@ -244,16 +287,14 @@ func (bsn *ScaleioNode) UpdatePingNode() error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	req, err := bsn.Config.NewRequest("POST", url, bytes.NewBuffer(response))
 	if err != nil {
 		log.Errorln("Failed to create new HTTP request:", err)
 		log.Debugln("UpdatePingNode LEAVE")
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
+	client := bsn.Config.HTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Errorln("Failed to make HTTP call:", err)
@@ -296,6 +337,119 @@ func (bsn *ScaleioNode) UpdatePingNode() error {
 	return nil
 }
 
+//requestRebootLease asks the scheduler for the lease to reboot the node or
+//gives it back
+func (bsn *ScaleioNode) requestRebootLease(release bool) (*types.RebootLease, error) {
+	url := bsn.State.SchedulerAddress + types.APIPrefix + "/node/reboot"
+
+	lease := &types.RebootLease{
+		Acknowledged: false,
+		ExecutorID:   bsn.Config.ExecutorID,
+		Release:      release,
+	}
+
+	response, err := json.MarshalIndent(lease, "", "  ")
+	if err != nil {
+		log.Errorln("Failed to marshall lease object:", err)
+		return nil, err
+	}
+
+	req, err := bsn.Config.NewRequest("POST", url, bytes.NewBuffer(response))
+	if err != nil {
+		log.Errorln("Failed to create new HTTP request:", err)
+		return nil, err
+	}
+
+	client := bsn.Config.HTTPClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorln("Failed to make HTTP call:", err)
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		log.Errorln("Failed to read the HTTP Body:", err)
+		return nil, err
+	}
+
+	log.Debugln("response Status:", resp.Status)
+	log.Debugln("response Body:", string(body))
+
+	var newlease types.RebootLease
+	err = json.Unmarshal(body, &newlease)
+	if err != nil {
+		log.Errorln("Failed to unmarshal the RebootLease object:", err)
+		return nil, err
+	}
+
+	if !newlease.Acknowledged {
+		log.Errorln("Failed to receive an acknowledgement")
+		return nil, ErrStateChangeNotAcknowledged
+	}
+
+	return &newlease, nil
+}
+
+//ReleaseRebootLease gives the reboot lease of the node back to the scheduler.
+//It is safe to call when the node holds no lease.
+func (bsn *ScaleioNode) ReleaseRebootLease() error {
+	log.Debugln("ReleaseRebootLease ENTER")
+
+	_, err := bsn.requestRebootLease(true)
+
+	log.Debugln("ReleaseRebootLease LEAVE")
+	return err
+}
+
+//waitForRebootLease blocks until the scheduler grants the lease to reboot
+func (bsn *ScaleioNode) waitForRebootLease() {
+	for {
+		lease, err := bsn.requestRebootLease(false)
+		if err == nil && lease.Granted {
+			log.Infoln("Reboot lease granted until", time.Unix(lease.Expires, 0))
+			return
+		}
+		if err == nil {
+			log.Infoln("Waiting for a reboot lease:", lease.Reason)
+		}
+		log.Debugln("Waiting for", PollRebootLeaseInSeconds, "seconds")
+		time.Sleep(time.Duration(PollRebootLeaseInSeconds) * time.Second)
+	}
+}
+
+//Reboot reboots the node once the scheduler grants it a reboot lease. The
+//lease is given back when the executor starts again after the reboot.
+func (bsn *ScaleioNode) Reboot() {
+	if bsn.State.Debug {
+		log.Infoln("Skipping the reboot since Debug is TRUE")
+		return
+	}
+
+	bsn.waitForRebootLease()
+
+	ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
+	ip2, err2 := bsn.Config.ParseIPFromRestURI()
+
+	if err1 == nil && err2 == nil && ip1 == ip2 {
+		log.Infoln("Delay reboot host running the Scheduler")
+		time.Sleep(time.Duration(DelayForRebootInSeconds) * time.Second)
+	}
+
+	rebootErr := RunCommand(RebootCmdline, RebootCheck, "")
+	if rebootErr != nil {
+		log.Errorln("Install Kernel Failed:", rebootErr)
+		//the node did not go down so the other nodes can go ahead
+		if err := bsn.ReleaseRebootLease(); err != nil {
+			log.Warnln("Failed to release the reboot lease:", err)
+		}
+	}
+
+	time.Sleep(time.Duration(WaitForRebootInSeconds) * time.Second)
+}
+
 //RunStateUnknown default action for StateUnknown
 func (bsn *ScaleioNode) RunStateUnknown() {
 	log.Debugln("In StateUnknown. Do nothing.")
@@ -363,8 +517,28 @@ func (bsn *ScaleioNode) RunStateUpgradeCluster() {
 	time.Sleep(time.Duration(PollStatusInSeconds) * time.Second)
 }
 
-//RunStateFatalInstall default action for StateFatalInstall
+//RunStateFatalInstall default action for StateFatalInstall. The scheduler
+//retries the step that failed or an operator resets the node so wait for the
+//state to change.
 func (bsn *ScaleioNode) RunStateFatalInstall() {
-	log.Debugln("Node marked Fatal. Wait for", PollAfterFatalInSeconds, "seconds")
-	time.Sleep(time.Duration(PollAfterFatalInSeconds) * time.Second)
+	log.Debugln("Node marked Fatal. Wait for a retry or a reset.")
+	if bsn.State.Revision == 0 {
+		//the scheduler does not support long-polling
+		time.Sleep(time.Duration(PollStatusInSeconds) * time.Second)
+		return
+	}
+	bsn.WaitForScaleIOStateChange(bsn.State.Revision)
+}
+
+//RunStateDecommission default action for StateDecommission
+func (bsn *ScaleioNode) RunStateDecommission() {
+	log.Debugln("In StateDecommission. Do nothing.")
+	time.Sleep(time.Duration(PollStatusInSeconds) * time.Second)
+}
+
+//RunStateDecommissioned default action for StateDecommissioned. The scheduler
+//kills the task once it has removed the node.
+func (bsn *ScaleioNode) RunStateDecommissioned() {
+	log.Debugln("In StateDecommissioned. Wait for the task to be killed.")
+	time.Sleep(time.Duration(PollStatusInSeconds) * time.Second)
 }
@@ -23,21 +23,32 @@ const (
 	//WaitForRebootInSeconds the amount of time to wait for the reboot
 	WaitForRebootInSeconds = 120
 
-	//OfflineTimeForMdmNodesInSeconds is the max time an MDM node can be offline
-	OfflineTimeForMdmNodesInSeconds = 180
+	//PingIntervalInSeconds the amount of time between pings to the scheduler.
+	//The scheduler decides when a node is offline (-liveness.offline).
+	PingIntervalInSeconds = 20
 
 	//PollStatusInSeconds the amount of time to wait before updating state
 	PollStatusInSeconds = 5
 
+	//LongPollInSeconds how long the scheduler holds a request for the state
+	//waiting for it to change
+	LongPollInSeconds = 30
+
 	//PollAfterFatalInSeconds the amount of time to wait before checking
 	PollAfterFatalInSeconds = 3600
 
 	//PollForChangesInSeconds cluster working. check for changes.
 	PollForChangesInSeconds = 30
+
+	//PollRebootLeaseInSeconds the amount of time to wait before asking for a
+	//reboot lease again
+	PollRebootLeaseInSeconds = 15
 )
 
-//RetrieveState is a call back to retrieve an update of the state
-type RetrieveState func() (*types.ScaleIOFramework, error)
+//RetrieveState is a call back to retrieve an update of the state. When since
+//is not 0, it blocks until the state is newer than that revision or the
+//scheduler gives up waiting.
+type RetrieveState func(since uint64) (*types.ScaleIOFramework, error)
 
 func waitForRunState(state *types.ScaleIOFramework, runState int, allNodes bool) bool {
 	for _, node := range state.ScaleIO.Nodes {
@@ -55,7 +66,8 @@ func waitForRunState(state *types.ScaleIOFramework, runState int, allNodes bool)
 				return false
 			}
 		case types.PersonaNode:
-			if allNodes && node.State < runState {
+			//an offline data node does not hold the others back
+			if allNodes && node.State < runState && node.Liveness != types.LivenessOffline {
 				return false
 			}
 		}
@@ -66,10 +78,16 @@ func waitForRunState(state *types.ScaleIOFramework, runState int, allNodes bool)
 
 //WaitForStableState waits until a state can successfully be retrieved
 func WaitForStableState(getstate RetrieveState) *types.ScaleIOFramework {
+	return WaitForStateChange(getstate, 0)
+}
+
+//WaitForStateChange waits until a state newer than the revision can
+//successfully be retrieved. A revision of 0 returns the current state.
+func WaitForStateChange(getstate RetrieveState, revision uint64) *types.ScaleIOFramework {
 	var err error
 	var state *types.ScaleIOFramework
 	for {
-		state, err = getstate()
+		state, err = getstate(revision)
 		if err == nil {
 			log.Debugln("waitForState BREAK")
 			break
@@ -81,16 +99,17 @@ func WaitForStableState(getstate RetrieveState) *types.ScaleIOFramework {
 }
 
 func waitForState(sio IScaleioNode, nodeState int, allNodes bool) *types.ScaleIOFramework {
-	var state *types.ScaleIOFramework
-	for {
-		state = sio.UpdateScaleIOState()
-		if waitForRunState(state, nodeState, allNodes) {
-			log.Debugln("Achieve state", nodeState, "among nodes")
-			break
+	state := sio.UpdateScaleIOState()
+	for !waitForRunState(state, nodeState, allNodes) {
+		if state.Revision == 0 {
+			//the scheduler does not support long-polling
+			log.Debugln("Waiting for", PollStatusInSeconds, "seconds")
+			time.Sleep(time.Duration(PollStatusInSeconds) * time.Second)
 		}
-		log.Debugln("Waiting for", PollStatusInSeconds, "seconds")
-		time.Sleep(time.Duration(PollStatusInSeconds) * time.Second)
+		log.Debugln("Waiting for a change after revision", state.Revision)
+		state = sio.WaitForScaleIOStateChange(state.Revision)
 	}
+	log.Debugln("Achieve state", nodeState, "among nodes")
 	return state
 }
 
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/codedellemc/scaleio-framework/scaleio-executor/client"
 	"github.com/codedellemc/scaleio-framework/scaleio-executor/config"
+	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
 	exec "github.com/codedellemc/scaleio-framework/scaleio-executor/mesos/exec"
 	mesos "github.com/codedellemc/scaleio-framework/scaleio-executor/mesos/v1"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
@@ -24,6 +26,14 @@ const (
 	numberOfEventFailuresBeforeExiting = 10
 )
 
+var (
+	//ErrCredentialsRejected The scheduler rejected the request for credentials
+	ErrCredentialsRejected = errors.New("The scheduler rejected the request for credentials")
+
+	//ErrStateRequestFailed The scheduler did not return the state
+	ErrStateRequestFailed = errors.New("The scheduler did not return the state")
+)
+
 //ScaleIOExecutor is the representation for an ScaleIO Executor process
 type ScaleIOExecutor struct {
 	Config *config.Config
@@ -37,6 +47,10 @@ type ScaleIOExecutor struct {
 	DoneChan chan struct{}
 
 	ObservedFailures int
+
+	adminPassword string
+	lastState     *types.ScaleIOFramework
+	lastETag      string
 }
 
 //NewScaleIOExecutor creates a ScaleIO executor object
@@ -65,20 +79,25 @@ func (e *ScaleIOExecutor) stop() {
 	close(e.Events)
 }
 
-func (e *ScaleIOExecutor) retrieveState() (*types.ScaleIOFramework, error) {
+func (e *ScaleIOExecutor) retrieveState(since uint64) (*types.ScaleIOFramework, error) {
 	log.Debugln("RetrieveState ENTER")
-	url := e.Config.SchedulerURI + "/api/state"
+	url := e.Config.SchedulerURI + types.APIPrefix + "/state"
+	if since > 0 {
+		//long-poll until the state moves past since
+		url += fmt.Sprintf("?since=%d&wait=%ds", since, common.LongPollInSeconds)
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := e.Config.NewRequest("GET", url, nil)
 	if err != nil {
 		log.Errorln("Error is HTTP NewRequest:", err)
 		log.Debugln("RetrieveState LEAVE")
 		return nil, err
 	}
+	if e.lastState != nil && len(e.lastETag) > 0 {
+		req.Header.Set("If-None-Match", e.lastETag)
+	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
+	client := e.Config.HTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Errorln("Error is HTTP Do:", err)
@@ -87,6 +106,12 @@ func (e *ScaleIOExecutor) retrieveState() (*types.ScaleIOFramework, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && e.lastState != nil {
+		log.Debugln("State has not changed")
+		log.Debugln("RetrieveState LEAVE")
+		return e.lastState, nil
+	}
+
 	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
 	if err != nil {
 		log.Errorln("Error is IO ReadAll:", err)
@@ -96,6 +121,12 @@ func (e *ScaleIOExecutor) retrieveState() (*types.ScaleIOFramework, error) {
 
 	log.Debugln("Body: ", string(body))
 
+	if resp.StatusCode != http.StatusOK {
+		log.Errorln("State request failed:", resp.StatusCode, string(body))
+		log.Debugln("RetrieveState LEAVE")
+		return nil, ErrStateRequestFailed
+	}
+
 	var state types.ScaleIOFramework
 	err = json.Unmarshal(body, &state)
 	if err != nil {
@@ -104,12 +135,84 @@ func (e *ScaleIOExecutor) retrieveState() (*types.ScaleIOFramework, error) {
 		return nil, err
 	}
 
+	//secrets are not part of the public state
+	if len(e.adminPassword) == 0 {
+		creds, err := e.retrieveCredentials()
+		if err != nil {
+			log.Errorln("Failed to retrieve credentials:", err)
+			log.Debugln("RetrieveState LEAVE")
+			return nil, err
+		}
+		e.adminPassword = creds.AdminPassword
+	}
+	state.ScaleIO.AdminPassword = e.adminPassword
+
+	e.lastState = &state
+	e.lastETag = resp.Header.Get("ETag")
+
 	log.Debugln("RetrieveState Succeeded")
 	log.Debugln("RetrieveState LEAVE")
 
 	return &state, nil
 }
 
+func (e *ScaleIOExecutor) retrieveCredentials() (*types.NodeCredentials, error) {
+	log.Debugln("retrieveCredentials ENTER")
+	url := e.Config.SchedulerURI + types.APIPrefix + "/node/credentials"
+
+	creds := &types.NodeCredentials{
+		Acknowledged: false,
+		ExecutorID:   e.Config.ExecutorID,
+	}
+
+	request, err := json.Marshal(creds)
+	if err != nil {
+		log.Errorln("Failed to marshall credentials object:", err)
+		log.Debugln("retrieveCredentials LEAVE")
+		return nil, err
+	}
+
+	req, err := e.Config.NewRequest("POST", url, bytes.NewBuffer(request))
+	if err != nil {
+		log.Errorln("Error is HTTP NewRequest:", err)
+		log.Debugln("retrieveCredentials LEAVE")
+		return nil, err
+	}
+
+	client := e.Config.HTTPClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorln("Error is HTTP Do:", err)
+		log.Debugln("retrieveCredentials LEAVE")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		log.Errorln("Error is IO ReadAll:", err)
+		log.Debugln("retrieveCredentials LEAVE")
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Errorln("Credentials request failed:", resp.StatusCode, string(body))
+		log.Debugln("retrieveCredentials LEAVE")
+		return nil, ErrCredentialsRejected
+	}
+
+	err = json.Unmarshal(body, creds)
+	if err != nil {
+		log.Errorln("Error is JSON Unmarshal:", err)
+		log.Debugln("retrieveCredentials LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("retrieveCredentials Succeeded")
+	log.Debugln("retrieveCredentials LEAVE")
+	return creds, nil
+}
+
 func (e *ScaleIOExecutor) send(call *exec.Call) (*http.Response, error) {
 	marshaler := jsonpb.Marshaler{
 		EnumsAsInts:  true,
@@ -222,7 +325,6 @@ func (e *ScaleIOExecutor) handleEvents() {
 			}
 
 			go func() {
-				//TODO reminder not to rely on node.LastContact value until we add in pings
 				errNode := RunExecutor(e.Config, e.retrieveState)
 				if errNode != nil {
 					myErr := e.sendUpdate(task, mesos.TaskState_TASK_ERROR.Enum())
@@ -4,6 +4,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	xplatform "github.com/dvonthenen/goxplatform"
 
+	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
@@ -23,7 +24,7 @@ func (mdm *MdmDebUbuntu14Mgr) EnvironmentSetup(state *types.ScaleIOFramework) (b
 		log.Infoln("Installing libaio1 and zip")
 
 		miscCmdline := "apt-get -y install libaio1 zip"
-		err := xplatform.GetInstance().Run.Command(miscCmdline, aiozipCheck, "")
+		err := common.RunCommand(miscCmdline, aiozipCheck, "")
 		if err != nil {
 			log.Errorln("Install Prerequisites Failed:", err)
 			log.Infoln("EnvironmentSetup LEAVE")
@@ -38,7 +39,7 @@ func (mdm *MdmDebUbuntu14Mgr) EnvironmentSetup(state *types.ScaleIOFramework) (b
 		log.Infoln("Installing linux-image-4.4.0-38-generic")
 
 		kernelCmdline := "apt-get -y install linux-image-4.4.0-38-generic"
-		err := xplatform.GetInstance().Run.Command(kernelCmdline, genericInstallCheck, "")
+		err := common.RunCommand(kernelCmdline, genericInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install Kernel Failed:", err)
 			log.Infoln("EnvironmentSetup LEAVE")
@@ -79,10 +80,12 @@ func NewMdmDebUbuntu14Mgr(state *types.ScaleIOFramework) *MdmDebUbuntu14Mgr {
 	myMdmDebUbuntu14Mgr.MdmManager.SdsPackageDownload = state.ScaleIO.Ubuntu14.Sds
 	myMdmDebUbuntu14Mgr.MdmManager.SdsInstallCmd = "dpkg -i {LocalSds}"
 	myMdmDebUbuntu14Mgr.MdmManager.SdsInstallCheck = sdsInstallCheck
+	myMdmDebUbuntu14Mgr.MdmManager.SdsUninstallCmd = "dpkg --purge " + types.Ubuntu14SdsPackageName
 	myMdmDebUbuntu14Mgr.MdmManager.SdcPackageName = types.Ubuntu14SdcPackageName
 	myMdmDebUbuntu14Mgr.MdmManager.SdcPackageDownload = state.ScaleIO.Ubuntu14.Sdc
 	myMdmDebUbuntu14Mgr.MdmManager.SdcInstallCmd = "MDM_IP={MdmPair} dpkg -i {LocalSdc}"
 	myMdmDebUbuntu14Mgr.MdmManager.SdcInstallCheck = sdcInstallCheck
+	myMdmDebUbuntu14Mgr.MdmManager.SdcUninstallCmd = "dpkg --purge " + types.Ubuntu14SdcPackageName
 	myMdmDebUbuntu14Mgr.MdmManager.MdmPackageName = types.Ubuntu14MdmPackageName
 	myMdmDebUbuntu14Mgr.MdmManager.MdmPackageDownload = state.ScaleIO.Ubuntu14.Mdm
 	myMdmDebUbuntu14Mgr.MdmManager.MdmInstallCmd = "MDM_ROLE_IS_MANAGER={PriOrSec} dpkg -i {LocalMdm}"
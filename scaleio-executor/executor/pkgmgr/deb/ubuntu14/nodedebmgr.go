@@ -4,6 +4,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	xplatform "github.com/dvonthenen/goxplatform"
 
+	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
@@ -23,7 +24,7 @@ func (dpm *NodeDebUbuntu14Mgr) EnvironmentSetup(state *types.ScaleIOFramework) (
 		log.Infoln("Installing libaio1 and zip")
 
 		miscCmdline := "apt-get -y install libaio1 zip"
-		err := xplatform.GetInstance().Run.Command(miscCmdline, aiozipCheck, "")
+		err := common.RunCommand(miscCmdline, aiozipCheck, "")
 		if err != nil {
 			log.Errorln("Install Prerequisites Failed:", err)
 			log.Infoln("EnvironmentSetup LEAVE")
@@ -38,7 +39,7 @@ func (dpm *NodeDebUbuntu14Mgr) EnvironmentSetup(state *types.ScaleIOFramework) (
 		log.Infoln("Installing linux-image-4.4.0-38-generic")
 
 		kernelCmdline := "apt-get -y install linux-image-4.4.0-38-generic"
-		err := xplatform.GetInstance().Run.Command(kernelCmdline, genericInstallCheck, "")
+		err := common.RunCommand(kernelCmdline, genericInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install Kernel Failed:", err)
 			log.Infoln("EnvironmentSetup LEAVE")
@@ -79,10 +80,12 @@ func NewNodeDebUbuntu14Mgr(state *types.ScaleIOFramework) *NodeDebUbuntu14Mgr {
 	myNodeDebUbuntu14Mgr.NodeManager.SdsPackageDownload = state.ScaleIO.Ubuntu14.Sds
 	myNodeDebUbuntu14Mgr.NodeManager.SdsInstallCmd = "dpkg -i {LocalSds}"
 	myNodeDebUbuntu14Mgr.NodeManager.SdsInstallCheck = sdsInstallCheck
+	myNodeDebUbuntu14Mgr.NodeManager.SdsUninstallCmd = "dpkg --purge " + types.Ubuntu14SdsPackageName
 	myNodeDebUbuntu14Mgr.NodeManager.SdcPackageName = types.Ubuntu14SdcPackageName
 	myNodeDebUbuntu14Mgr.NodeManager.SdcPackageDownload = state.ScaleIO.Ubuntu14.Sdc
 	myNodeDebUbuntu14Mgr.NodeManager.SdcInstallCmd = "MDM_IP={MdmPair} dpkg -i {LocalSdc}"
 	myNodeDebUbuntu14Mgr.NodeManager.SdcInstallCheck = sdcInstallCheck
+	myNodeDebUbuntu14Mgr.NodeManager.SdcUninstallCmd = "dpkg --purge " + types.Ubuntu14SdcPackageName
 
 	//REX-Ray
 	myNodeDebUbuntu14Mgr.NodeManager.RexrayInstallCheck = rexrayInstallCheck
@@ -11,4 +11,6 @@ type IMdmMgr interface {
 	ManagementSetup(state *types.ScaleIOFramework, isPriOrSec bool) error
 	CreateCluster(state *types.ScaleIOFramework) error
 	GatewaySetup(state *types.ScaleIOFramework) (bool, error)
+	SwitchMdmOwnership(state *types.ScaleIOFramework, ipAddress string) error
+	GetMasterMdm(state *types.ScaleIOFramework) (string, error)
 }
@@ -8,6 +8,8 @@ import (
 type INodeMgr interface {
 	EnvironmentSetup(state *types.ScaleIOFramework) (bool, error)
 	NodeSetup(state *types.ScaleIOFramework) error
+	ClientSetup(state *types.ScaleIOFramework) error
+	NodeTeardown(state *types.ScaleIOFramework) error
 
 	RexraySetup(state *types.ScaleIOFramework, executorID string) (bool, error)
 	SetupIsolator(state *types.ScaleIOFramework) error
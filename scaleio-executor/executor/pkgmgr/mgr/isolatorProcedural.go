@@ -285,7 +285,7 @@ func (nm *NodeManager) SetupIsolator(state *types.ScaleIOFramework) error {
 	if dcVerErr != nil || dcInstErr != nil || dcVer != dcInst {
 		dvdcliInstallCmdline := "curl -ksSL https://dl.bintray.com/emccode/dvdcli/install " +
 			"| INSECURE=1 sh -"
-		err := xplatform.GetInstance().Run.Command(dvdcliInstallCmdline, nm.DvdcliInstallCheck, "")
+		err := common.RunCommand(dvdcliInstallCmdline, nm.DvdcliInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install DVDCLI Failed:", err)
 			log.Infoln("SetupIsolator LEAVE")
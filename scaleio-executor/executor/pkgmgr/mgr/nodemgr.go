@@ -5,6 +5,12 @@ import "errors"
 var (
 	//ErrBaseUnimplemented failed because function is unimplemented in the base class
 	ErrBaseUnimplemented = errors.New("Function is unimplemented in the base class")
+
+	//ErrPackageStillInstalled failed because the package is installed after it was removed
+	ErrPackageStillInstalled = errors.New("The package is still installed after it was removed")
+
+	//ErrMasterMdmNotFound failed because the master MDM is not in the cluster query
+	ErrMasterMdmNotFound = errors.New("The master MDM was not found in the cluster query")
 )
 
 //NodeManager implementation for Package Manager for ScaleIO Nodes
@@ -14,10 +20,12 @@ type NodeManager struct {
 	SdsPackageDownload string
 	SdsInstallCmd      string
 	SdsInstallCheck    string
+	SdsUninstallCmd    string
 	SdcPackageName     string
 	SdcPackageDownload string
 	SdcInstallCmd      string
 	SdcInstallCheck    string
+	SdcUninstallCmd    string
 
 	//REX-Ray
 	RexrayInstallCheck string
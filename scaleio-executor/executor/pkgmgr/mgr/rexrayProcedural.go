@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -52,7 +53,7 @@ func fixSciniDepInRexrayInitD() error {
 	log.Debugln("fixSciniDepInRexrayInitD ENTER")
 
 	writeSciniCmdline := "sed -i 's/\\/usr\\/bin\\/rexray start/if \\[ -e \\/etc\\/init.d\\/scini \\]\\; then \\/etc\\/init.d\\/scini start; fi\\n    \\/usr\\/bin\\/rexray start/' /etc/init.d/rexray"
-	output, errScini := xplatform.GetInstance().Run.CommandOutput(writeSciniCmdline)
+	output, errScini := common.RunCommandOutput(writeSciniCmdline)
 	if errScini != nil {
 		log.Errorln("Failed to add Scini dependency:", errScini)
 		log.Debugln("fixSciniDepInRexrayInitD LEAVE")
@@ -109,6 +110,30 @@ func doesSciniExistInRexrayInitD() (bool, error) {
 	return false, nil
 }
 
+//firstDomainPool returns the ProtectionDomain and StoragePool that sort first.
+//A node can run several SDSs in a ProtectionDomain so the pair is picked by
+//name to give REX-Ray the same one on every run. The StoragePool falls back to
+//storagePool when the ProtectionDomain has none.
+func firstDomainPool(domains map[string]*types.ProtectionDomain, storagePool string) (string, string) {
+	domainNames := make([]string, 0)
+	for name := range domains {
+		domainNames = append(domainNames, name)
+	}
+	sort.Strings(domainNames)
+	domain := domains[domainNames[0]]
+
+	poolNames := make([]string, 0)
+	for name := range domain.Pools {
+		poolNames = append(poolNames, name)
+	}
+	sort.Strings(poolNames)
+
+	if len(poolNames) > 0 {
+		storagePool = domain.Pools[poolNames[0]].Name
+	}
+	return domain.Name, storagePool
+}
+
 //RexraySetup procedure for setting up REX-Ray
 func (nm *NodeManager) RexraySetup(state *types.ScaleIOFramework, executorID string) (bool, error) {
 	log.Infoln("RexraySetup ENTER")
@@ -154,23 +179,9 @@ func (nm *NodeManager) RexraySetup(state *types.ScaleIOFramework, executorID str
 		storagePool := state.ScaleIO.StoragePool
 
 		if len(self.ConsumesDomains) > 0 {
-			for _, domain := range self.ConsumesDomains {
-				protectionDomain = domain.Name
-				for _, pool := range domain.Pools {
-					storagePool = pool.Name
-					break //only allow 1 pool
-				}
-				break //only allow 1 domain
-			}
+			protectionDomain, storagePool = firstDomainPool(self.ConsumesDomains, storagePool)
 		} else if len(self.ProvidesDomains) > 0 {
-			for _, domain := range self.ProvidesDomains {
-				protectionDomain = domain.Name
-				for _, pool := range domain.Pools {
-					storagePool = pool.Name
-					break //only allow 1 pool
-				}
-				break //only allow 1 domain
-			}
+			protectionDomain, storagePool = firstDomainPool(self.ProvidesDomains, storagePool)
 		}
 		log.Debugln("ProtectionDomain:", protectionDomain)
 		log.Debugln("StoragePool:", storagePool)
@@ -224,13 +235,15 @@ scaleio:
 		rexrayConfig = strings.Replace(rexrayConfig, "{STORAGEPOOLNAME}", storagePool, -1)
 
 		file, err := os.OpenFile("/etc/rexray/config.yml",
-			os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+			os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
 		if err != nil {
 			log.Errorln("Writing Config File Failed:", err)
 			log.Infoln("RexraySetup LEAVE")
 			return false, err
 		}
 
+		//O_CREATE does not change the mode of an existing file
+		file.Chmod(0600)
 		file.WriteString(rexrayConfig)
 		file.Close()
 
@@ -248,7 +261,7 @@ scaleio:
 				state.Rexray.Branch
 		}
 
-		err = xplatform.GetInstance().Run.Command(rexrayInstallCmdline, nm.RexrayInstallCheck, "")
+		err = common.RunCommand(rexrayInstallCmdline, nm.RexrayInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install REX-Ray Failed:", err)
 			log.Infoln("RexraySetup LEAVE")
@@ -317,7 +330,7 @@ func rexrayServerSetup() error {
 
 	//REX-Ray Install
 	rexrayInstallCmdline := "curl -ksSL https://dl.bintray.com/emccode/rexray/install | INSECURE=1 sh -"
-	err = xplatform.GetInstance().Run.Command(rexrayInstallCmdline, rexrayInstallCheck, "")
+	err = common.RunCommand(rexrayInstallCmdline, rexrayInstallCheck, "")
 	if err != nil {
 		log.Errorln("Install REX-Ray Failed:", err)
 		log.Infoln("RexrayServerSetup LEAVE")
@@ -371,20 +384,22 @@ libstorage:
 		state.ScaleIO.StoragePool, -1)
 
 	file, err := os.OpenFile("/etc/rexray/config.yml",
-		os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+		os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
 	if err != nil {
 		log.Errorln("Writing Config File Failed:", err)
 		log.Infoln("RexrayServerSetup LEAVE")
 		return err
 	}
 
+	//O_CREATE does not change the mode of an existing file
+	file.Chmod(0600)
 	file.WriteString(rexrayConfig)
 	file.Close()
 
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	rexrayStopCmdline := "rexray service stop -l debug"
-	err = xplatform.GetInstance().Run.CommandEx(rexrayStopCmdline, rexrayStopCheck, "", 20)
+	err = common.RunCommandEx(rexrayStopCmdline, rexrayStopCheck, "", 20)
 	if err != nil {
 		log.Warnln("REX-Ray stop Failed:", err)
 	}
@@ -392,7 +407,7 @@ libstorage:
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	rexrayStartCmdline := "rexray service start -l debug"
-	err = xplatform.GetInstance().Run.CommandEx(rexrayStartCmdline, rexrayStartCheck, "", 20)
+	err = common.RunCommandEx(rexrayStartCmdline, rexrayStartCheck, "", 20)
 	if err != nil {
 		log.Errorln("REX-Ray start Failed:", err)
 		log.Infoln("RexrayServerSetup LEAVE")
@@ -416,7 +431,7 @@ func rexrayClientSetup(state *types.ScaleIOFramework) error {
 
 	//REX-Ray Install
 	rexrayInstallCmdline := "curl -ksSL https://dl.bintray.com/emccode/rexray/install | INSECURE=1 sh -"
-	err = xplatform.GetInstance().Run.Command(rexrayInstallCmdline, rexrayInstallCheck, "")
+	err = common.RunCommand(rexrayInstallCmdline, rexrayInstallCheck, "")
 	if err != nil {
 		log.Errorln("Install REX-Ray Failed:", err)
 		log.Infoln("RexrayClientSetup LEAVE")
@@ -439,20 +454,22 @@ libstorage:
 	rexrayConfig = strings.Replace(rexrayConfig, "{IP_ADDRESS}", gatewayIP, -1)
 
 	file, err := os.OpenFile("/etc/rexray/config.yml",
-		os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+		os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
 	if err != nil {
 		log.Errorln("Writing Config File Failed:", err)
 		log.Infoln("RexrayClientSetup LEAVE")
 		return err
 	}
 
+	//O_CREATE does not change the mode of an existing file
+	file.Chmod(0600)
 	file.WriteString(rexrayConfig)
 	file.Close()
 
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	rexrayStopCmdline := "rexray service stop -l debug"
-	err = xplatform.GetInstance().Run.CommandEx(rexrayStopCmdline, rexrayStopCheck, "", 20)
+	err = common.RunCommandEx(rexrayStopCmdline, rexrayStopCheck, "", 20)
 	if err != nil {
 		log.Warnln("REX-Ray stop Failed:", err)
 	}
@@ -460,7 +477,7 @@ libstorage:
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	rexrayStartCmdline := "rexray service start -l debug"
-	err = xplatform.GetInstance().Run.CommandEx(rexrayStartCmdline, rexrayStartCheck, "", 20)
+	err = common.RunCommandEx(rexrayStartCmdline, rexrayStartCheck, "", 20)
 	if err != nil {
 		log.Errorln("REX-Ray start Failed:", err)
 		log.Infoln("RexrayClientSetup LEAVE")
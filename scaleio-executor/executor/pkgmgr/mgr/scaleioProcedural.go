@@ -25,6 +25,7 @@ const (
 	addStoragePoolCheck      = "Successfully created a storage pool"
 	addSdsCheck              = "Successfully created SDS"
 	addVolumeCheck           = "Successfully created volume of size"
+	switchOwnershipCheck     = "[Ss]uccessfully"
 )
 
 //ManagementSetup for setting up the MDM packages
@@ -68,7 +69,7 @@ func (mm *MdmManager) ManagementSetup(state *types.ScaleIOFramework, isPriOrSec
 		mdmInstallCmd = strings.Replace(mdmInstallCmd, "{LocalMdm}", localMdm, -1)
 		log.Infoln("mdmInstallCmd:", mdmInstallCmd)
 
-		err = xplatform.GetInstance().Run.Command(mdmInstallCmd, mm.MdmInstallCheck, "")
+		err = common.RunCommand(mdmInstallCmd, mm.MdmInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install MDM Failed:", err)
 			log.Infoln("ManagementSetup LEAVE")
@@ -117,7 +118,7 @@ func (nm *NodeManager) NodeSetup(state *types.ScaleIOFramework) error {
 		sdsInstallCmd := strings.Replace(nm.SdsInstallCmd, "{LocalSds}", localSds, -1)
 		log.Infoln("sdsInstallCmd:", sdsInstallCmd)
 
-		err = xplatform.GetInstance().Run.Command(sdsInstallCmd, nm.SdsInstallCheck, "")
+		err = common.RunCommand(sdsInstallCmd, nm.SdsInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install SDS Failed:", err)
 			log.Infoln("NodeSetup LEAVE")
@@ -128,7 +129,42 @@ func (nm *NodeManager) NodeSetup(state *types.ScaleIOFramework) error {
 		time.Sleep(time.Duration(common.DelayIfInstalledInSeconds) * time.Second)
 	}
 
-	//SDC Install
+	err := nm.sdcSetup(mdmPair)
+	if err != nil {
+		log.Infoln("NodeSetup LEAVE")
+		return err
+	}
+
+	log.Infoln("NodeSetup Succeeded")
+	log.Infoln("NodeSetup LEAVE")
+	return nil
+}
+
+//ClientSetup for setting up only the SDC package on a node that consumes
+//storage without providing any
+func (nm *NodeManager) ClientSetup(state *types.ScaleIOFramework) error {
+	log.Infoln("ClientSetup ENTER")
+
+	mdmPair, err := common.CreateMdmPairString(state)
+	if err != nil {
+		log.Errorln("Error creating the MDM pair string:", err)
+		log.Infoln("ClientSetup LEAVE")
+		return err
+	}
+	log.Infoln("MDM Pair String:", mdmPair)
+
+	err = nm.sdcSetup(mdmPair)
+	if err != nil {
+		log.Infoln("ClientSetup LEAVE")
+		return err
+	}
+
+	log.Infoln("ClientSetup Succeeded")
+	log.Infoln("ClientSetup LEAVE")
+	return nil
+}
+
+func (nm *NodeManager) sdcSetup(mdmPair string) error {
 	sdcVer, sdcVerErr := xplatform.GetInstance().Inst.ParseVersionFromFilename(nm.SdcPackageDownload)
 	sdcInst, sdcInstErr := xplatform.GetInstance().Inst.GetInstalledVersion(nm.SdcPackageName, true)
 	log.Debugln("sdcVer:", sdcVer)
@@ -142,7 +178,6 @@ func (nm *NodeManager) NodeSetup(state *types.ScaleIOFramework) error {
 		localSdc, err := xplatform.GetInstance().Inst.DownloadPackage(nm.SdcPackageDownload)
 		if err != nil {
 			log.Errorln("Error downloading SDC package:", err)
-			log.Infoln("NodeSetup LEAVE")
 			return err
 		}
 
@@ -150,10 +185,9 @@ func (nm *NodeManager) NodeSetup(state *types.ScaleIOFramework) error {
 		sdcInstallCmd = strings.Replace(sdcInstallCmd, "{LocalSdc}", localSdc, -1)
 		log.Infoln("sdcInstallCmd:", sdcInstallCmd)
 
-		err = xplatform.GetInstance().Run.Command(sdcInstallCmd, nm.SdcInstallCheck, "")
+		err = common.RunCommand(sdcInstallCmd, nm.SdcInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install SDC Failed:", err)
-			log.Infoln("NodeSetup LEAVE")
 			return err
 		}
 	} else {
@@ -161,8 +195,47 @@ func (nm *NodeManager) NodeSetup(state *types.ScaleIOFramework) error {
 		time.Sleep(time.Duration(common.DelayIfInstalledInSeconds) * time.Second)
 	}
 
-	log.Infoln("NodeSetup Succeeded")
-	log.Infoln("NodeSetup LEAVE")
+	return nil
+}
+
+//NodeTeardown removes the SDC and SDS packages from a decommissioned node. The
+//SDC goes first since it is the one using the SDS.
+func (nm *NodeManager) NodeTeardown(state *types.ScaleIOFramework) error {
+	log.Infoln("NodeTeardown ENTER")
+
+	packages := []struct {
+		name         string
+		uninstallCmd string
+	}{
+		{nm.SdcPackageName, nm.SdcUninstallCmd},
+		{nm.SdsPackageName, nm.SdsUninstallCmd},
+	}
+
+	for _, pkg := range packages {
+		if xplatform.GetInstance().Inst.IsInstalled(pkg.name) != nil {
+			log.Infoln(pkg.name, "is not installed")
+			continue
+		}
+
+		log.Infoln("Uninstalling", pkg.name)
+		log.Infoln("uninstallCmd:", pkg.uninstallCmd)
+		output, err := common.RunCommandOutput(pkg.uninstallCmd)
+		if err != nil {
+			log.Errorln("Uninstall", pkg.name, "Failed:", err)
+			log.Errorln("Output:", output)
+			log.Infoln("NodeTeardown LEAVE")
+			return err
+		}
+
+		if xplatform.GetInstance().Inst.IsInstalled(pkg.name) == nil {
+			log.Errorln(pkg.name, "is still installed")
+			log.Infoln("NodeTeardown LEAVE")
+			return ErrPackageStillInstalled
+		}
+	}
+
+	log.Infoln("NodeTeardown Succeeded")
+	log.Infoln("NodeTeardown LEAVE")
 	return nil
 }
 
@@ -200,7 +273,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 	createCmdline := "scli --create_mdm_cluster --master_mdm_ip " + pri.IPAddress +
 		" --master_mdm_management_ip " + pri.IPAddress + " --master_mdm_name mdm1 --accept_license " +
 		"--approve_certificate"
-	err = xplatform.GetInstance().Run.Command(createCmdline, createClusterCheck, "")
+	err = common.RunCommand(createCmdline, createClusterCheck, "")
 	if err != nil {
 		log.Errorln("Init First Node Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -210,7 +283,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	loginCmdline := "scli --login --username admin --password admin"
-	err = xplatform.GetInstance().Run.Command(loginCmdline, loggedInCheck, "")
+	err = common.RunCommand(loginCmdline, loggedInCheck, "")
 	if err != nil {
 		log.Errorln("ScaleIO Login Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -221,7 +294,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 
 	setPassCmdline := "scli --set_password --old_password admin --new_password " +
 		state.ScaleIO.AdminPassword
-	err = xplatform.GetInstance().Run.Command(setPassCmdline, setPasswordCheck, "")
+	err = common.RunCommand(setPassCmdline, setPasswordCheck, "")
 	if err != nil {
 		log.Errorln("ScaleIO Set Password Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -231,7 +304,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	loginCmdline = "scli --login --username admin --password " + state.ScaleIO.AdminPassword
-	err = xplatform.GetInstance().Run.Command(loginCmdline, loggedInCheck, "")
+	err = common.RunCommand(loginCmdline, loggedInCheck, "")
 	if err != nil {
 		log.Errorln("ScaleIO Login with new Password Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -242,7 +315,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 
 	secondaryCmdline := "scli --add_standby_mdm --new_mdm_ip " + sec.IPAddress +
 		" --mdm_role manager --new_mdm_management_ip " + sec.IPAddress + " --new_mdm_name mdm2"
-	err = xplatform.GetInstance().Run.Command(secondaryCmdline, addMdmToClusterCheck, "")
+	err = common.RunCommand(secondaryCmdline, addMdmToClusterCheck, "")
 	if err != nil {
 		log.Errorln("Add Secondary MDM Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -253,7 +326,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 
 	tiebreakerCmdline := "scli --add_standby_mdm --new_mdm_ip " + tb.IPAddress +
 		" --mdm_role tb --new_mdm_name tb"
-	err = xplatform.GetInstance().Run.Command(tiebreakerCmdline, addMdmToClusterCheck, "")
+	err = common.RunCommand(tiebreakerCmdline, addMdmToClusterCheck, "")
 	if err != nil {
 		log.Errorln("Add Tiebreaker MDM Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -264,7 +337,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 
 	changeClusterCmdline := "scli --switch_cluster_mode --cluster_mode 3_node " +
 		"--add_slave_mdm_name mdm2 --add_tb_name tb"
-	err = xplatform.GetInstance().Run.Command(changeClusterCmdline, changeClusterModeCheck, "")
+	err = common.RunCommand(changeClusterCmdline, changeClusterModeCheck, "")
 	if err != nil {
 		log.Errorln("Change ScaleIO to 3 Node Cluster Failed:", err)
 		log.Infoln("CreateCluster LEAVE")
@@ -274,7 +347,7 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
 
 	renameCmdline := "scli --mdm_ip " + pri.IPAddress + " --rename_system --new_name scaleio"
-	err = xplatform.GetInstance().Run.Command(renameCmdline, clusterRenameCheck, "")
+	err = common.RunCommand(renameCmdline, clusterRenameCheck, "")
 	if err != nil {
 		log.Errorln("Cluster Rename Failed:", err)
 		log.Infoln("InitializeCluster LEAVE")
@@ -288,6 +361,68 @@ func (mm *MdmManager) CreateCluster(state *types.ScaleIOFramework) error {
 	return nil
 }
 
+//SwitchMdmOwnership makes the MDM at the IP address the master of the cluster
+func (mm *MdmManager) SwitchMdmOwnership(state *types.ScaleIOFramework, ipAddress string) error {
+	log.Infoln("SwitchMdmOwnership ENTER")
+	log.Infoln("New Master MDM:", ipAddress)
+
+	loginCmdline := "scli --login --username admin --password " + state.ScaleIO.AdminPassword
+	err := common.RunCommand(loginCmdline, loggedInCheck, "")
+	if err != nil {
+		log.Errorln("ScaleIO Login Failed:", err)
+		log.Infoln("SwitchMdmOwnership LEAVE")
+		return err
+	}
+
+	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
+
+	switchCmdline := "scli --switch_mdm_ownership --new_master_mdm_ip " + ipAddress
+	err = common.RunCommand(switchCmdline, switchOwnershipCheck, "")
+	if err != nil {
+		log.Errorln("Switch MDM Ownership Failed:", err)
+		log.Infoln("SwitchMdmOwnership LEAVE")
+		return err
+	}
+
+	time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
+
+	log.Infoln("SwitchMdmOwnership Succeeded")
+	log.Infoln("SwitchMdmOwnership LEAVE")
+	return nil
+}
+
+//GetMasterMdm returns the IP address of the MDM that is the master of the
+//cluster
+func (mm *MdmManager) GetMasterMdm(state *types.ScaleIOFramework) (string, error) {
+	log.Infoln("GetMasterMdm ENTER")
+
+	loginCmdline := "scli --login --username admin --password " + state.ScaleIO.AdminPassword
+	err := common.RunCommand(loginCmdline, loggedInCheck, "")
+	if err != nil {
+		log.Errorln("ScaleIO Login Failed:", err)
+		log.Infoln("GetMasterMdm LEAVE")
+		return "", err
+	}
+
+	masterCmdline := "scli --query_cluster | grep -A 2 \"Master MDM:\" | " +
+		"sed -n -e 's/^\\s*IPs: \\([^,]*\\),.*$/\\1/p'"
+	output, err := common.RunCommandOutput(masterCmdline)
+	if err != nil {
+		log.Errorln("Query Master MDM Failed:", err)
+		log.Infoln("GetMasterMdm LEAVE")
+		return "", err
+	}
+	if len(output) == 0 {
+		log.Errorln("Query Master MDM Failed:", ErrMasterMdmNotFound)
+		log.Infoln("GetMasterMdm LEAVE")
+		return "", ErrMasterMdmNotFound
+	}
+
+	log.Infoln("Master MDM:", output)
+	log.Infoln("GetMasterMdm LEAVE")
+	return output, nil
+}
+
 //GatewaySetup for setting up the ScaleIO gateway for API use
 func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error) {
 	log.Infoln("GatewaySetup ENTER")
@@ -326,7 +461,7 @@ func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error)
 		liaInstallCmd := strings.Replace(mm.LiaInstallCmd, "{LocalLia}", localLia, -1)
 		log.Infoln("liaInstallCmd:", liaInstallCmd)
 
-		err = xplatform.GetInstance().Run.Command(liaInstallCmd, mm.LiaInstallCheck, "")
+		err = common.RunCommand(liaInstallCmd, mm.LiaInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install LIA Failed:", err)
 			log.Infoln("GatewaySetup LEAVE")
@@ -334,7 +469,7 @@ func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error)
 		}
 
 		installIDCmdline := "scli --query_all | grep \"Installation ID\" | sed -n -e 's/^.*ID: //p'"
-		output, err := xplatform.GetInstance().Run.CommandOutput(installIDCmdline)
+		output, err := common.RunCommandOutput(installIDCmdline)
 		if err != nil {
 			log.Errorln("Install LIA Failed:", err)
 			log.Infoln("GatewaySetup LEAVE")
@@ -342,7 +477,7 @@ func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error)
 		}
 
 		dumpIDCmdline := "echo " + output + " > /opt/emc/scaleio/lia/cfg/installation_id.txt"
-		output, err = xplatform.GetInstance().Run.CommandOutput(dumpIDCmdline)
+		output, err = common.RunCommandOutput(dumpIDCmdline)
 		if err != nil || len(output) > 0 {
 			log.Errorln("Install LIA Failed:", err)
 			log.Infoln("GatewaySetup LEAVE")
@@ -373,7 +508,7 @@ func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error)
 
 		gatewayInstallCmd := strings.Replace(mm.GatewayInstallCmd, "{LocalGw}", localGw, -1)
 
-		err = xplatform.GetInstance().Run.Command(gatewayInstallCmd, mm.GatewayInstallCheck, "")
+		err = common.RunCommand(gatewayInstallCmd, mm.GatewayInstallCheck, "")
 		if err != nil {
 			log.Errorln("Install GW Failed:", err)
 			log.Infoln("GatewaySetup LEAVE")
@@ -381,7 +516,7 @@ func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error)
 		}
 
 		bypasssecCmdline := "sed -i 's/security.bypass_certificate_check=false/security.bypass_certificate_check=true/' /opt/emc/scaleio/gateway/webapps/ROOT/WEB-INF/classes/gatewayUser.properties"
-		output, err := xplatform.GetInstance().Run.CommandOutput(bypasssecCmdline)
+		output, err := common.RunCommandOutput(bypasssecCmdline)
 		if err != nil || len(output) > 0 {
 			log.Errorln("Configure By-Pass Security Check Failed:", err)
 			log.Infoln("GatewaySetup LEAVE")
@@ -390,7 +525,7 @@ func (mm *MdmManager) GatewaySetup(state *types.ScaleIOFramework) (bool, error)
 
 		writemdmCmdline := "sed -i 's/mdm.ip.addresses=/mdm.ip.addresses='" + pri.IPAddress +
 			"','" + sec.IPAddress + "'/' /opt/emc/scaleio/gateway/webapps/ROOT/WEB-INF/classes/gatewayUser.properties"
-		output, err = xplatform.GetInstance().Run.CommandOutput(writemdmCmdline)
+		output, err = common.RunCommandOutput(writemdmCmdline)
 		if err != nil || len(output) > 0 {
 			log.Errorln("Configure MDM to Gateway Failed:", err)
 			log.Infoln("GatewaySetup LEAVE")
@@ -4,6 +4,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	xplatform "github.com/dvonthenen/goxplatform"
 
+	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
@@ -25,7 +26,7 @@ func (mdm *MdmRpmRhel7Mgr) EnvironmentSetup(state *types.ScaleIOFramework) (bool
 		log.Infoln("Installing libaio1, zip, and java-1.8.0-openjdk")
 
 		miscCmdline := "yum -y install zip unzip libaio java-1.8.0-openjdk"
-		err := xplatform.GetInstance().Run.Command(miscCmdline, aiozipCheck, "")
+		err := common.RunCommand(miscCmdline, aiozipCheck, "")
 		if err != nil {
 			log.Errorln("Install Prerequisites Failed:", err)
 			log.Infoln("EnvironmentSetup LEAVE")
@@ -50,10 +51,12 @@ func NewMdmRpmRhel7Mgr(state *types.ScaleIOFramework) *MdmRpmRhel7Mgr {
 	myMdmRpmRhel7Mgr.MdmManager.SdsPackageDownload = state.ScaleIO.Rhel7.Sds
 	myMdmRpmRhel7Mgr.MdmManager.SdsInstallCmd = "rpm -Uvh {LocalSds}"
 	myMdmRpmRhel7Mgr.MdmManager.SdsInstallCheck = sdsInstallCheck
+	myMdmRpmRhel7Mgr.MdmManager.SdsUninstallCmd = "rpm -e " + types.Rhel7SdsPackageName
 	myMdmRpmRhel7Mgr.MdmManager.SdcPackageName = types.Rhel7SdcPackageName
 	myMdmRpmRhel7Mgr.MdmManager.SdcPackageDownload = state.ScaleIO.Rhel7.Sdc
 	myMdmRpmRhel7Mgr.MdmManager.SdcInstallCmd = "MDM_IP={MdmPair} rpm -Uvh {LocalSdc}"
 	myMdmRpmRhel7Mgr.MdmManager.SdcInstallCheck = sdcInstallCheck
+	myMdmRpmRhel7Mgr.MdmManager.SdcUninstallCmd = "rpm -e " + types.Rhel7SdcPackageName
 	myMdmRpmRhel7Mgr.MdmManager.MdmPackageName = types.Rhel7MdmPackageName
 	myMdmRpmRhel7Mgr.MdmManager.MdmPackageDownload = state.ScaleIO.Rhel7.Mdm
 	myMdmRpmRhel7Mgr.MdmManager.MdmInstallCmd = "MDM_ROLE_IS_MANAGER={PriOrSec} rpm -Uvh {LocalMdm}"
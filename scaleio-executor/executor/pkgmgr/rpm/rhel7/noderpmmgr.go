@@ -4,6 +4,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	xplatform "github.com/dvonthenen/goxplatform"
 
+	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
@@ -25,7 +26,7 @@ func (npm *NodeRpmRhel7Mgr) EnvironmentSetup(state *types.ScaleIOFramework) (boo
 		log.Infoln("Installing libaio1, zip, and java-1.8.0-openjdk")
 
 		miscCmdline := "yum -y install zip unzip libaio java-1.8.0-openjdk"
-		err := xplatform.GetInstance().Run.Command(miscCmdline, aiozipCheck, "")
+		err := common.RunCommand(miscCmdline, aiozipCheck, "")
 		if err != nil {
 			log.Errorln("Install Prerequisites Failed:", err)
 			log.Infoln("EnvironmentSetup LEAVE")
@@ -50,10 +51,12 @@ func NewNodeRpmRhel7Mgr(state *types.ScaleIOFramework) *NodeRpmRhel7Mgr {
 	myNodeRpmRhel7Mgr.NodeManager.SdsPackageDownload = state.ScaleIO.Rhel7.Sds
 	myNodeRpmRhel7Mgr.NodeManager.SdsInstallCmd = "rpm -Uvh {LocalSds}"
 	myNodeRpmRhel7Mgr.NodeManager.SdsInstallCheck = sdsInstallCheck
+	myNodeRpmRhel7Mgr.NodeManager.SdsUninstallCmd = "rpm -e " + types.Rhel7SdsPackageName
 	myNodeRpmRhel7Mgr.NodeManager.SdcPackageName = types.Rhel7SdcPackageName
 	myNodeRpmRhel7Mgr.NodeManager.SdcPackageDownload = state.ScaleIO.Rhel7.Sdc
 	myNodeRpmRhel7Mgr.NodeManager.SdcInstallCmd = "MDM_IP={MdmPair} rpm -Uvh {LocalSdc}"
 	myNodeRpmRhel7Mgr.NodeManager.SdcInstallCheck = sdcInstallCheck
+	myNodeRpmRhel7Mgr.NodeManager.SdcUninstallCmd = "rpm -e " + types.Rhel7SdcPackageName
 
 	//REX-Ray
 	myNodeRpmRhel7Mgr.NodeManager.RexrayInstallCheck = rexrayInstallCheck
@@ -53,6 +53,15 @@ func whichNode(cfg *config.Config, getstate common.RetrieveState) (common.IScale
 	return sionode, nil
 }
 
+func pingScheduler(node common.IScaleioNode) {
+	for {
+		if err := node.UpdatePingNode(); err != nil {
+			log.Warnln("Failed to ping the scheduler:", err)
+		}
+		time.Sleep(time.Duration(common.PingIntervalInSeconds) * time.Second)
+	}
+}
+
 //RunExecutor starts the executor
 func RunExecutor(cfg *config.Config, getstate common.RetrieveState) error {
 	log.Infoln("RunExecutor ENTER")
@@ -65,6 +74,15 @@ func RunExecutor(cfg *config.Config, getstate common.RetrieveState) error {
 		return ErrFoundSelfFailed
 	}
 
+	//let the scheduler know this node is alive
+	go pingScheduler(node)
+
+	//a lease held from before the reboot is given back
+	node.UpdateScaleIOState()
+	if errLease := node.ReleaseRebootLease(); errLease != nil {
+		log.Warnln("Failed to release the reboot lease:", errLease)
+	}
+
 	for {
 		node.UpdateScaleIOState()
 
@@ -117,6 +135,12 @@ func RunExecutor(cfg *config.Config, getstate common.RetrieveState) error {
 
 		case types.StateFatalInstall:
 			node.RunStateFatalInstall()
+
+		case types.StateDecommission:
+			node.RunStateDecommission()
+
+		case types.StateDecommissioned:
+			node.RunStateDecommissioned()
 		}
 	}
 
@@ -4,14 +4,10 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	xplatform "github.com/dvonthenen/goxplatform"
-	xplatformsys "github.com/dvonthenen/goxplatform/sys"
 
 	config "github.com/codedellemc/scaleio-framework/scaleio-executor/config"
 	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
-	ubuntu14 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/deb/ubuntu14"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
-	rhel7 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/rpm/rhel7"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
@@ -28,16 +24,7 @@ func NewData(state *types.ScaleIOFramework, cfg *config.Config, getstate common.
 	myNode.GetState = getstate
 	myNode.RebootRequired = false
 
-	var pkgmgr mgr.INodeMgr
-	switch xplatform.GetInstance().Sys.GetOsType() {
-	case xplatformsys.OsRhel:
-		log.Infoln("Is RHEL7")
-		pkgmgr = rhel7.NewNodeRpmRhel7Mgr(state)
-	case xplatformsys.OsUbuntu:
-		log.Infoln("Is Ubuntu14")
-		pkgmgr = ubuntu14.NewNodeDebUbuntu14Mgr(state)
-	}
-	myNode.PkgMgr = pkgmgr
+	myNode.PkgMgr = newNodeMgr(state)
 
 	return myNode
 }
@@ -47,7 +34,7 @@ func (sdn *ScaleioDataNode) RunStateUnknown() {
 	reboot, err := sdn.PkgMgr.EnvironmentSetup(sdn.State)
 	if err != nil {
 		log.Errorln("EnvironmentSetup Failed:", err)
-		errState := sdn.UpdateNodeState(types.StateFatalInstall)
+		errState := sdn.UpdateNodeFailure("EnvironmentSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -76,35 +63,28 @@ func (sdn *ScaleioDataNode) RunStateUnknown() {
 	if reboot {
 		log.Infoln("Reboot required before StatePrerequisitesInstalled!")
 
-		if sdn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := sdn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		sdn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing prerequisites")
 	}
 }
 
+//setupPackages installs only the SDC on a node that consumes storage without
+//providing any and both the SDS and SDC otherwise
+func (sdn *ScaleioDataNode) setupPackages(state *types.ScaleIOFramework) (string, error) {
+	if common.IsClientOnly(common.GetSelfNode(state, sdn.Config.ExecutorID)) {
+		log.Infoln("Node only consumes storage. Installing the SDC only.")
+		return "ClientSetup", sdn.PkgMgr.ClientSetup(state)
+	}
+	return "NodeSetup", sdn.PkgMgr.NodeSetup(state)
+}
+
 //RunStatePrerequisitesInstalled default action for StatePrerequisitesInstalled
 func (sdn *ScaleioDataNode) RunStatePrerequisitesInstalled() {
-	err := sdn.PkgMgr.NodeSetup(sdn.State)
+	step, err := sdn.setupPackages(sdn.State)
 	if err != nil {
-		log.Errorln("NodeSetup Failed:", err)
-		errState := sdn.UpdateNodeState(types.StateFatalInstall)
+		log.Errorln(step, "Failed:", err)
+		errState := sdn.UpdateNodeFailure(step, err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -116,7 +96,7 @@ func (sdn *ScaleioDataNode) RunStatePrerequisitesInstalled() {
 	err = sdn.UpdateDevices()
 	if err != nil {
 		log.Errorln("UpdateDevices Failed:", err)
-		errState := sdn.UpdateNodeState(types.StateFatalInstall)
+		errState := sdn.UpdateNodeFailure("UpdateDevices", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -138,7 +118,7 @@ func (sdn *ScaleioDataNode) RunStateInstallRexRay() {
 	reboot, err := sdn.PkgMgr.RexraySetup(sdn.State, sdn.Config.ExecutorID)
 	if err != nil {
 		log.Errorln("REX-Ray setup Failed:", err)
-		errState := sdn.UpdateNodeState(types.StateFatalInstall)
+		errState := sdn.UpdateNodeFailure("REX-Ray setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -151,7 +131,7 @@ func (sdn *ScaleioDataNode) RunStateInstallRexRay() {
 	err = sdn.PkgMgr.SetupIsolator(sdn.State)
 	if err != nil {
 		log.Errorln("Mesos Isolator setup Failed:", err)
-		errState := sdn.UpdateNodeState(types.StateFatalInstall)
+		errState := sdn.UpdateNodeFailure("Mesos Isolator setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -181,24 +161,7 @@ func (sdn *ScaleioDataNode) RunStateInstallRexRay() {
 			log.Debugln("Signaled StateSystemReboot")
 		}
 
-		if sdn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := sdn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		sdn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing REX-Ray")
 
@@ -238,8 +201,36 @@ func (sdn *ScaleioDataNode) RunStateFinishInstall() {
 	time.Sleep(time.Duration(common.PollForChangesInSeconds) * time.Second)
 }
 
-//RunStateUpgradeCluster default action for StateUpgradeCluster
+//RunStateUpgradeCluster upgrades the packages on the Data Node
 func (sdn *ScaleioDataNode) RunStateUpgradeCluster() {
-	log.Debugln("In StateUpgradeCluster. Do nothing.")
-	//TODO process the upgrade here
+	runUpgrade(&sdn.ScaleioNode, func(state *types.ScaleIOFramework) (string, error) {
+		sdn.PkgMgr = newNodeMgr(state)
+		step, err := sdn.setupPackages(state)
+		if err != nil {
+			return step, err
+		}
+		return "", nil
+	})
+}
+
+//RunStateDecommission removes the ScaleIO packages from the Data Node
+func (sdn *ScaleioDataNode) RunStateDecommission() {
+	err := sdn.PkgMgr.NodeTeardown(sdn.State)
+	if err != nil {
+		log.Errorln("NodeTeardown Failed:", err)
+		errState := sdn.UpdateNodeFailure("NodeTeardown", err)
+		if errState != nil {
+			log.Errorln("Failed to signal state change:", errState)
+		} else {
+			log.Debugln("Signaled StateFatalInstall")
+		}
+		return
+	}
+
+	errState := sdn.UpdateNodeState(types.StateDecommissioned)
+	if errState != nil {
+		log.Errorln("Failed to signal state change:", errState)
+	} else {
+		log.Debugln("Signaled StateDecommissioned")
+	}
 }
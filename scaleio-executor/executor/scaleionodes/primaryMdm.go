@@ -5,18 +5,13 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	xplatform "github.com/dvonthenen/goxplatform"
-	xplatformsys "github.com/dvonthenen/goxplatform/sys"
 
 	config "github.com/codedellemc/scaleio-framework/scaleio-executor/config"
 	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
-	ubuntu14 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/deb/ubuntu14"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
-	rhel7 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/rpm/rhel7"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
@@ -33,16 +28,7 @@ func NewPri(state *types.ScaleIOFramework, cfg *config.Config, getstate common.R
 	myNode.GetState = getstate
 	myNode.RebootRequired = false
 
-	var pkgmgr mgr.IMdmMgr
-	switch xplatform.GetInstance().Sys.GetOsType() {
-	case xplatformsys.OsRhel:
-		log.Infoln("Is RHEL7")
-		pkgmgr = rhel7.NewMdmRpmRhel7Mgr(state)
-	case xplatformsys.OsUbuntu:
-		log.Infoln("Is Ubuntu14")
-		pkgmgr = ubuntu14.NewMdmDebUbuntu14Mgr(state)
-	}
-	myNode.PkgMgr = pkgmgr
+	myNode.PkgMgr = newMdmMgr(state)
 
 	return myNode
 }
@@ -52,7 +38,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateUnknown() {
 	reboot, err := spmn.PkgMgr.EnvironmentSetup(spmn.State)
 	if err != nil {
 		log.Errorln("EnvironmentSetup Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("EnvironmentSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -81,24 +67,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateUnknown() {
 	if reboot {
 		log.Infoln("Reboot required before StatePrerequisitesInstalled!")
 
-		if spmn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := spmn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		spmn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing prerequisites")
 	}
@@ -110,7 +79,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStatePrerequisitesInstalled() {
 	err := spmn.PkgMgr.ManagementSetup(spmn.State, true)
 	if err != nil {
 		log.Errorln("ManagementSetup Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("ManagementSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -122,7 +91,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStatePrerequisitesInstalled() {
 	err = spmn.PkgMgr.NodeSetup(spmn.State)
 	if err != nil {
 		log.Errorln("NodeSetup Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("NodeSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -134,7 +103,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStatePrerequisitesInstalled() {
 	err = spmn.UpdateDevices()
 	if err != nil {
 		log.Errorln("UpdateDevices Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("UpdateDevices", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -157,7 +126,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateBasePackagedInstalled() {
 	err := spmn.PkgMgr.CreateCluster(spmn.State)
 	if err != nil {
 		log.Errorln("CreateCluster Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("CreateCluster", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -169,7 +138,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateBasePackagedInstalled() {
 	err = spmn.UpdateCluster()
 	if err != nil {
 		log.Errorln("UpdateCluster Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("UpdateCluster", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -192,7 +161,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateInitializeCluster() {
 	reboot, err := spmn.PkgMgr.GatewaySetup(spmn.State)
 	if err != nil {
 		log.Errorln("GatewaySetup Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("GatewaySetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -215,7 +184,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateInstallRexRay() {
 	reboot, err := spmn.PkgMgr.RexraySetup(spmn.State, spmn.Config.ExecutorID)
 	if err != nil {
 		log.Errorln("REX-Ray setup Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("REX-Ray setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -228,7 +197,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateInstallRexRay() {
 	err = spmn.PkgMgr.SetupIsolator(spmn.State)
 	if err != nil {
 		log.Errorln("Mesos Isolator setup Failed:", err)
-		errState := spmn.UpdateNodeState(types.StateFatalInstall)
+		errState := spmn.UpdateNodeFailure("Mesos Isolator setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -258,24 +227,7 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateInstallRexRay() {
 			log.Debugln("Signaled StateSystemReboot")
 		}
 
-		if spmn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := spmn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		spmn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing REX-Ray")
 
@@ -314,27 +266,42 @@ func (spmn *ScaleioPrimaryMdmNode) RunStateFinishInstall() {
 		"seconds for changes in the cluster.")
 	time.Sleep(time.Duration(common.PollForChangesInSeconds) * time.Second)
 
-	//TODO eventual plan for MDM node behavior
-	/*
-		if clusterStatusBad then
-			doClusterRemediate()
-		else if upgrade then
-			_ = waitForClusterUpgrade(spmn.UpdateScaleIOState())
-			doUpgrade()
-	*/
+	//the scheduler monitors the health of the cluster (/api/v1/health) and
+	//upgrades are driven through RunStateUpgradeCluster
 }
 
-//RunStateUpgradeCluster default action for StateUpgradeCluster
+//RunStateUpgradeCluster upgrades the packages on the Primary MDM. The Secondary
+//MDM becomes the master while the MDM package is upgraded.
 func (spmn *ScaleioPrimaryMdmNode) RunStateUpgradeCluster() {
-	log.Debugln("In StateUpgradeCluster. Do nothing.")
-	//TODO process the upgrade here
+	runUpgrade(&spmn.ScaleioNode, func(state *types.ScaleIOFramework) (string, error) {
+		spmn.PkgMgr = newMdmMgr(state)
+
+		sec, err := common.GetSecondaryMdmNode(state)
+		if err != nil {
+			return "GetSecondaryMdmNode", err
+		}
+
+		//never upgrade the MDM while it is the master. On a retry the
+		//Secondary MDM may already be the master.
+		step, err := makeMaster(spmn.PkgMgr, state, sec.IPAddress)
+		if err != nil {
+			return step, err
+		}
+
+		step, err = upgradeMdm(spmn.PkgMgr, state, true)
+		if err != nil {
+			return step, err
+		}
+
+		return switchBack(spmn.PkgMgr, state, spmn.GetSelfNode().IPAddress)
+	})
 }
 
 //UpdateCluster this function tells the scheduler that ScaleIO has been configured
 func (spmn *ScaleioPrimaryMdmNode) UpdateCluster() error {
 	log.Debugln("UpdateCluster ENTER")
 
-	url := spmn.State.SchedulerAddress + "/api/state"
+	url := spmn.State.SchedulerAddress + types.APIPrefix + "/state"
 
 	state := &types.UpdateCluster{
 		Acknowledged: false,
@@ -347,16 +314,14 @@ func (spmn *ScaleioPrimaryMdmNode) UpdateCluster() error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	req, err := spmn.Config.NewRequest("POST", url, bytes.NewBuffer(response))
 	if err != nil {
 		log.Errorln("Failed to create new HTTP request:", err)
 		log.Debugln("UpdateCluster LEAVE")
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
+	client := spmn.Config.HTTPClient()
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Errorln("Failed to make HTTP call:", err)
@@ -4,14 +4,10 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	xplatform "github.com/dvonthenen/goxplatform"
-	xplatformsys "github.com/dvonthenen/goxplatform/sys"
 
 	config "github.com/codedellemc/scaleio-framework/scaleio-executor/config"
 	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
-	ubuntu14 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/deb/ubuntu14"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
-	rhel7 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/rpm/rhel7"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
@@ -28,16 +24,7 @@ func NewSec(state *types.ScaleIOFramework, cfg *config.Config, getstate common.R
 	myNode.GetState = getstate
 	myNode.RebootRequired = false
 
-	var pkgmgr mgr.IMdmMgr
-	switch xplatform.GetInstance().Sys.GetOsType() {
-	case xplatformsys.OsRhel:
-		log.Infoln("Is RHEL7")
-		pkgmgr = rhel7.NewMdmRpmRhel7Mgr(state)
-	case xplatformsys.OsUbuntu:
-		log.Infoln("Is Ubuntu14")
-		pkgmgr = ubuntu14.NewMdmDebUbuntu14Mgr(state)
-	}
-	myNode.PkgMgr = pkgmgr
+	myNode.PkgMgr = newMdmMgr(state)
 
 	return myNode
 }
@@ -47,7 +34,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateUnknown() {
 	reboot, err := ssmn.PkgMgr.EnvironmentSetup(ssmn.State)
 	if err != nil {
 		log.Errorln("EnvironmentSetup Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("EnvironmentSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -76,24 +63,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateUnknown() {
 	if reboot {
 		log.Infoln("Reboot required before StatePrerequisitesInstalled!")
 
-		if ssmn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := ssmn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		ssmn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing prerequisites")
 	}
@@ -105,7 +75,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStatePrerequisitesInstalled() {
 	err := ssmn.PkgMgr.ManagementSetup(ssmn.State, true)
 	if err != nil {
 		log.Errorln("ManagementSetup Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("ManagementSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -117,7 +87,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStatePrerequisitesInstalled() {
 	err = ssmn.PkgMgr.NodeSetup(ssmn.State)
 	if err != nil {
 		log.Errorln("NodeSetup Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("NodeSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -129,7 +99,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStatePrerequisitesInstalled() {
 	err = ssmn.UpdateDevices()
 	if err != nil {
 		log.Errorln("UpdateDevices Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("UpdateDevices", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -164,7 +134,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateInitializeCluster() {
 	reboot, err := ssmn.PkgMgr.GatewaySetup(ssmn.State)
 	if err != nil {
 		log.Errorln("GatewaySetup Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("GatewaySetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -187,7 +157,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateInstallRexRay() {
 	reboot, err := ssmn.PkgMgr.RexraySetup(ssmn.State, ssmn.Config.ExecutorID)
 	if err != nil {
 		log.Errorln("REX-Ray setup Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("REX-Ray setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -200,7 +170,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateInstallRexRay() {
 	err = ssmn.PkgMgr.SetupIsolator(ssmn.State)
 	if err != nil {
 		log.Errorln("Mesos Isolator setup Failed:", err)
-		errState := ssmn.UpdateNodeState(types.StateFatalInstall)
+		errState := ssmn.UpdateNodeFailure("Mesos Isolator setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -230,24 +200,7 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateInstallRexRay() {
 			log.Debugln("Signaled StateSystemReboot")
 		}
 
-		if ssmn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := ssmn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		ssmn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing REX-Ray")
 
@@ -285,19 +238,24 @@ func (ssmn *ScaleioSecondaryMdmNode) RunStateFinishInstall() {
 	log.Debugln("In StateFinishInstall. Wait for", common.PollForChangesInSeconds,
 		"seconds for changes in the cluster.")
 	time.Sleep(time.Duration(common.PollForChangesInSeconds) * time.Second)
-
-	//TODO eventual plan for MDM node behavior
-	/*
-		if clusterStatusBad then
-			doClusterRemediate()
-		else if upgrade then
-			_ = common.WaitForClusterUpgrade(spmn.UpdateScaleIOState())
-			doUpgrade()
-	*/
 }
 
-//RunStateUpgradeCluster default action for StateUpgradeCluster
+//RunStateUpgradeCluster upgrades the packages on the Secondary MDM. The Primary
+//MDM has to be the master while the MDM package is upgraded.
 func (ssmn *ScaleioSecondaryMdmNode) RunStateUpgradeCluster() {
-	log.Debugln("In StateUpgradeCluster. Do nothing.")
-	//TODO process the upgrade here
+	runUpgrade(&ssmn.ScaleioNode, func(state *types.ScaleIOFramework) (string, error) {
+		ssmn.PkgMgr = newMdmMgr(state)
+
+		pri, err := common.GetPrimaryMdmNode(state)
+		if err != nil {
+			return "GetPrimaryMdmNode", err
+		}
+
+		step, err := makeMaster(ssmn.PkgMgr, state, pri.IPAddress)
+		if err != nil {
+			return step, err
+		}
+
+		return upgradeMdm(ssmn.PkgMgr, state, true)
+	})
 }
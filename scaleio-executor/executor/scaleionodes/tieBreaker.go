@@ -4,14 +4,10 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	xplatform "github.com/dvonthenen/goxplatform"
-	xplatformsys "github.com/dvonthenen/goxplatform/sys"
 
 	config "github.com/codedellemc/scaleio-framework/scaleio-executor/config"
 	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
-	ubuntu14 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/deb/ubuntu14"
 	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
-	rhel7 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/rpm/rhel7"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
@@ -28,16 +24,7 @@ func NewTb(state *types.ScaleIOFramework, cfg *config.Config, getstate common.Re
 	myNode.GetState = getstate
 	myNode.RebootRequired = false
 
-	var pkgmgr mgr.IMdmMgr
-	switch xplatform.GetInstance().Sys.GetOsType() {
-	case xplatformsys.OsRhel:
-		log.Infoln("Is RHEL7")
-		pkgmgr = rhel7.NewMdmRpmRhel7Mgr(state)
-	case xplatformsys.OsUbuntu:
-		log.Infoln("Is Ubuntu14")
-		pkgmgr = ubuntu14.NewMdmDebUbuntu14Mgr(state)
-	}
-	myNode.PkgMgr = pkgmgr
+	myNode.PkgMgr = newMdmMgr(state)
 
 	return myNode
 }
@@ -47,7 +34,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateUnknown() {
 	reboot, err := stbmn.PkgMgr.EnvironmentSetup(stbmn.State)
 	if err != nil {
 		log.Errorln("EnvironmentSetup Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("EnvironmentSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -76,24 +63,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateUnknown() {
 	if reboot {
 		log.Infoln("Reboot required before StatePrerequisitesInstalled!")
 
-		if stbmn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := stbmn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		stbmn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing prerequisites")
 	}
@@ -105,7 +75,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStatePrerequisitesInstalled() {
 	err := stbmn.PkgMgr.ManagementSetup(stbmn.State, false)
 	if err != nil {
 		log.Errorln("ManagementSetup Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("ManagementSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -117,7 +87,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStatePrerequisitesInstalled() {
 	err = stbmn.PkgMgr.NodeSetup(stbmn.State)
 	if err != nil {
 		log.Errorln("NodeSetup Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("NodeSetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -129,7 +99,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStatePrerequisitesInstalled() {
 	err = stbmn.UpdateDevices()
 	if err != nil {
 		log.Errorln("UpdateDevices Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("UpdateDevices", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -164,7 +134,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateInitializeCluster() {
 	reboot, err := stbmn.PkgMgr.GatewaySetup(stbmn.State)
 	if err != nil {
 		log.Errorln("GatewaySetup Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("GatewaySetup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -187,7 +157,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateInstallRexRay() {
 	reboot, err := stbmn.PkgMgr.RexraySetup(stbmn.State, stbmn.Config.ExecutorID)
 	if err != nil {
 		log.Errorln("REX-Ray setup Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("REX-Ray setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -200,7 +170,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateInstallRexRay() {
 	err = stbmn.PkgMgr.SetupIsolator(stbmn.State)
 	if err != nil {
 		log.Errorln("Mesos Isolator setup Failed:", err)
-		errState := stbmn.UpdateNodeState(types.StateFatalInstall)
+		errState := stbmn.UpdateNodeFailure("Mesos Isolator setup", err)
 		if errState != nil {
 			log.Errorln("Failed to signal state change:", errState)
 		} else {
@@ -230,24 +200,7 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateInstallRexRay() {
 			log.Debugln("Signaled StateSystemReboot")
 		}
 
-		if stbmn.State.Debug {
-			log.Infoln("Skipping the reboot since Debug is TRUE")
-		} else {
-			ip1, err1 := xplatform.GetInstance().Nw.AutoDiscoverIP()
-			ip2, err2 := stbmn.Config.ParseIPFromRestURI()
-
-			if err1 == nil && err2 == nil && ip1 == ip2 {
-				log.Infoln("Delay reboot host running the Scheduler")
-				time.Sleep(time.Duration(common.DelayForRebootInSeconds) * time.Second)
-			}
-
-			rebootErr := xplatform.GetInstance().Run.Command(common.RebootCmdline, common.RebootCheck, "")
-			if rebootErr != nil {
-				log.Errorln("Install Kernel Failed:", rebootErr)
-			}
-
-			time.Sleep(time.Duration(common.WaitForRebootInSeconds) * time.Second)
-		}
+		stbmn.Reboot()
 	} else {
 		log.Infoln("No need to reboot while installing REX-Ray")
 
@@ -285,19 +238,12 @@ func (stbmn *ScaleioTieBreakerMdmNode) RunStateFinishInstall() {
 	log.Debugln("In StateFinishInstall. Wait for", common.PollForChangesInSeconds,
 		"seconds for changes in the cluster.")
 	time.Sleep(time.Duration(common.PollForChangesInSeconds) * time.Second)
-
-	//TODO eventual plan for MDM node behavior
-	/*
-		if clusterStatusBad then
-			doClusterRemediate()
-		else if upgrade then
-			_ = waitForClusterUpgrade(spmn.UpdateScaleIOState())
-			doUpgrade()
-	*/
 }
 
-//RunStateUpgradeCluster default action for StateUpgradeCluster
+//RunStateUpgradeCluster upgrades the packages on the TieBreaker
 func (stbmn *ScaleioTieBreakerMdmNode) RunStateUpgradeCluster() {
-	log.Debugln("In StateUpgradeCluster. Do nothing.")
-	//TODO process the upgrade here
+	runUpgrade(&stbmn.ScaleioNode, func(state *types.ScaleIOFramework) (string, error) {
+		stbmn.PkgMgr = newMdmMgr(state)
+		return upgradeMdm(stbmn.PkgMgr, state, false)
+	})
 }
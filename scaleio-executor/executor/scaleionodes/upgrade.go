@@ -0,0 +1,172 @@
+package scaleionodes
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	xplatform "github.com/dvonthenen/goxplatform"
+	xplatformsys "github.com/dvonthenen/goxplatform/sys"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/common"
+	ubuntu14 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/deb/ubuntu14"
+	mgr "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/mgr"
+	rhel7 "github.com/codedellemc/scaleio-framework/scaleio-executor/executor/pkgmgr/rpm/rhel7"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//switchBackAttempts is the number of times to try to make the primary MDM
+	//the master again after it was upgraded
+	switchBackAttempts = 12
+)
+
+//newMdmMgr creates the package manager for MDM nodes using the package URIs
+//in the state
+func newMdmMgr(state *types.ScaleIOFramework) mgr.IMdmMgr {
+	var pkgmgr mgr.IMdmMgr
+	switch xplatform.GetInstance().Sys.GetOsType() {
+	case xplatformsys.OsRhel:
+		log.Infoln("Is RHEL7")
+		pkgmgr = rhel7.NewMdmRpmRhel7Mgr(state)
+	case xplatformsys.OsUbuntu:
+		log.Infoln("Is Ubuntu14")
+		pkgmgr = ubuntu14.NewMdmDebUbuntu14Mgr(state)
+	}
+	return pkgmgr
+}
+
+//newNodeMgr creates the package manager for data nodes using the package URIs
+//in the state
+func newNodeMgr(state *types.ScaleIOFramework) mgr.INodeMgr {
+	var pkgmgr mgr.INodeMgr
+	switch xplatform.GetInstance().Sys.GetOsType() {
+	case xplatformsys.OsRhel:
+		log.Infoln("Is RHEL7")
+		pkgmgr = rhel7.NewNodeRpmRhel7Mgr(state)
+	case xplatformsys.OsUbuntu:
+		log.Infoln("Is Ubuntu14")
+		pkgmgr = ubuntu14.NewNodeDebUbuntu14Mgr(state)
+	}
+	return pkgmgr
+}
+
+//packagesChanged is true when the package URIs are different in the states
+func packagesChanged(before *types.ScaleIOFramework, after *types.ScaleIOFramework) bool {
+	return before.ScaleIO.Ubuntu14 != after.ScaleIO.Ubuntu14 ||
+		before.ScaleIO.Rhel7 != after.ScaleIO.Rhel7
+}
+
+//upgradeStep installs the packages in the state. It returns the name of the
+//step that failed.
+type upgradeStep func(state *types.ScaleIOFramework) (string, error)
+
+//runUpgrade installs the packages in the state until they stop changing and
+//then tells the scheduler the upgrade of this node is finished. The packages
+//change when a rolling upgrade is rolled back while this node is upgrading.
+func runUpgrade(sio *common.ScaleioNode, upgrade upgradeStep) {
+	log.Infoln("runUpgrade ENTER")
+
+	for {
+		state := sio.UpdateScaleIOState()
+
+		step, err := upgrade(state)
+		if err != nil {
+			log.Errorln(step, "Failed:", err)
+			errState := sio.UpdateNodeFailure(step, err)
+			if errState != nil {
+				log.Errorln("Failed to signal state change:", errState)
+			} else {
+				log.Debugln("Signaled StateFatalInstall")
+			}
+			log.Infoln("runUpgrade LEAVE")
+			return
+		}
+
+		if !packagesChanged(state, sio.UpdateScaleIOState()) {
+			break
+		}
+		log.Infoln("The packages changed during the upgrade. Upgrade again.")
+	}
+
+	errState := sio.UpdateNodeState(types.StateFinishInstall)
+	if errState != nil {
+		log.Errorln("Failed to signal state change:", errState)
+	} else {
+		log.Debugln("Signaled StateFinishInstall")
+	}
+
+	log.Infoln("runUpgrade LEAVE")
+}
+
+//upgradeMdm upgrades the MDM, SDS, SDC, LIA and Gateway packages
+func upgradeMdm(pkgMgr mgr.IMdmMgr, state *types.ScaleIOFramework, isPriOrSec bool) (string, error) {
+	err := pkgMgr.ManagementSetup(state, isPriOrSec)
+	if err != nil {
+		return "ManagementSetup", err
+	}
+
+	err = pkgMgr.NodeSetup(state)
+	if err != nil {
+		return "NodeSetup", err
+	}
+
+	reboot, err := pkgMgr.GatewaySetup(state)
+	if err != nil {
+		return "GatewaySetup", err
+	}
+	if reboot {
+		log.Warnln("GatewaySetup asked for a reboot which is skipped during an upgrade")
+	}
+
+	return "", nil
+}
+
+//ErrNotMasterMdm failed because the MDM did not become the master of the
+//cluster
+var ErrNotMasterMdm = errors.New("The MDM did not become the master of the cluster")
+
+//makeMaster makes the MDM at the IP address the master of the cluster unless
+//it already is. It returns the name of the step that failed.
+func makeMaster(pkgMgr mgr.IMdmMgr, state *types.ScaleIOFramework, ipAddress string) (string, error) {
+	master, err := pkgMgr.GetMasterMdm(state)
+	if err != nil {
+		return "GetMasterMdm", err
+	}
+	if master == ipAddress {
+		log.Infoln("The MDM", ipAddress, "is already the master")
+		return "", nil
+	}
+
+	err = pkgMgr.SwitchMdmOwnership(state, ipAddress)
+	if err != nil {
+		return "SwitchMdmOwnership", err
+	}
+
+	master, err = pkgMgr.GetMasterMdm(state)
+	if err != nil {
+		return "GetMasterMdm", err
+	}
+	if master != ipAddress {
+		return "SwitchMdmOwnership", ErrNotMasterMdm
+	}
+	return "", nil
+}
+
+//switchBack makes the primary MDM the master again after it was upgraded. The
+//upgraded MDM has to rejoin the cluster first so keep trying for a while. It
+//returns the name of the step that failed.
+func switchBack(pkgMgr mgr.IMdmMgr, state *types.ScaleIOFramework, ipAddress string) (string, error) {
+	var step string
+	var err error
+	for i := 0; i < switchBackAttempts; i++ {
+		step, err = makeMaster(pkgMgr, state, ipAddress)
+		if err == nil {
+			return "", nil
+		}
+		log.Debugln("Waiting for", common.DelayBetweenCommandsInSeconds, "seconds")
+		time.Sleep(time.Duration(common.DelayBetweenCommandsInSeconds) * time.Second)
+	}
+	log.Errorln("The primary MDM is not the master after the upgrade")
+	return step, err
+}
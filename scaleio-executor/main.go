@@ -23,7 +23,11 @@ func init() {
 
 func main() {
 	for _, e := range os.Environ() {
-		pair := strings.Split(e, "=")
+		pair := strings.SplitN(e, "=", 2)
+		if strings.Contains(pair[0], "PASSWORD") || strings.Contains(pair[0], "TOKEN") {
+			log.Debugln(pair[0], "= <redacted>")
+			continue
+		}
 		log.Debugln(pair[0], "=", pair[1])
 	}
 
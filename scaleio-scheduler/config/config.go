@@ -1,8 +1,14 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	xplatform "github.com/dvonthenen/goxplatform"
 )
@@ -55,6 +61,11 @@ const (
 	isoBin = "https://github.com/emccode/mesos-module-dvdi/releases/download/v0.4.6/libmesos_dvdi_isolator-1.0.1.so"
 )
 
+var (
+	//ErrEmptyAdminPassword The Admin Password reference resolved to an empty string
+	ErrEmptyAdminPassword = errors.New("The Admin Password reference resolved to an empty string")
+)
+
 //Config is the representation of the config
 type Config struct {
 	LogLevel        string
@@ -73,6 +84,12 @@ type Config struct {
 
 	RestAddress          string
 	RestPort             int
+	RestTLSCert          string
+	RestTLSKey           string
+	RestReadToken        string
+	RestAdminToken       string
+	ExecutorTLSCAFile    string
+	ExecutorTLSInsecure  bool
 	MasterREST           string
 	AltExecutorPath      string
 	ExecutorMdmCPU       float64
@@ -86,6 +103,22 @@ type Config struct {
 	Role                 string
 	Store                string
 	StoreURI             string
+	StoreBoltDir         string
+	StoreBoltBucket      string
+	StoreBoltLockTimeout time.Duration
+	StoreBoltFsync       bool
+	StoreBoltCompact     bool
+	EventsMaxCount       int
+	EventsMaxAge         time.Duration
+	RetryLimit           int
+	RetryBackoff         time.Duration
+	RetryBackoffMax      time.Duration
+	UpgradeTimeout       time.Duration
+	RebootMaxSds         int
+	RebootTimeout        time.Duration
+	LivenessStale        time.Duration
+	LivenessOffline      time.Duration
+	HealthInterval       time.Duration
 
 	ClusterName          string
 	ClusterID            string
@@ -93,6 +126,8 @@ type Config struct {
 	ProtectionDomain     string
 	StoragePool          string
 	AdminPassword        string
+	AdminPasswordFile    string
+	AdminPasswordEnv     string
 	APIVersion           string
 	PrimaryMdmAddress    string
 	SecondaryMdmAddress  string
@@ -146,6 +181,18 @@ func (cfg *Config) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&cfg.RestAddress, "rest.address", cfg.RestAddress,
 		"Mesos scheduler REST API address")
 	fs.IntVar(&cfg.RestPort, "rest.port", cfg.RestPort, "Mesos scheduler REST API port")
+	fs.StringVar(&cfg.RestTLSCert, "rest.tls.cert", cfg.RestTLSCert,
+		"Certificate file to serve the REST API over TLS. Requires rest.tls.key")
+	fs.StringVar(&cfg.RestTLSKey, "rest.tls.key", cfg.RestTLSKey,
+		"Private key file to serve the REST API over TLS. Requires rest.tls.cert")
+	fs.StringVar(&cfg.RestReadToken, "rest.token.read", cfg.RestReadToken,
+		"Bearer token for operators with read access to the REST API")
+	fs.StringVar(&cfg.RestAdminToken, "rest.token.admin", cfg.RestAdminToken,
+		"Bearer token for operators with admin access to the REST API")
+	fs.StringVar(&cfg.ExecutorTLSCAFile, "executor.tls.cafile", cfg.ExecutorTLSCAFile,
+		"CA file on the agents used by executors to verify the REST API certificate")
+	fs.BoolVar(&cfg.ExecutorTLSInsecure, "executor.tls.insecure", cfg.ExecutorTLSInsecure,
+		"Executors skip verifying the REST API certificate")
 	fs.StringVar(&cfg.MasterREST, "uri", cfg.MasterREST, "Mesos scheduler API URL")
 	fs.StringVar(&cfg.AltExecutorPath, "executor.altpath", cfg.AltExecutorPath,
 		"Provide an alternate path to the executor binary")
@@ -166,6 +213,38 @@ func (cfg *Config) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&cfg.Role, "role", cfg.Role, "Framework role to register with the Mesos master")
 	fs.StringVar(&cfg.Store, "store.type", cfg.Store, "The type of keyvalue store to use")
 	fs.StringVar(&cfg.StoreURI, "store.uri", cfg.StoreURI, "Store URI to connect with")
+	fs.StringVar(&cfg.StoreBoltDir, "store.boltdb.dir", cfg.StoreBoltDir,
+		"Directory for the BoltDB file when store.type is boltdb")
+	fs.StringVar(&cfg.StoreBoltBucket, "store.boltdb.bucket", cfg.StoreBoltBucket,
+		"BoltDB bucket name")
+	fs.DurationVar(&cfg.StoreBoltLockTimeout, "store.boltdb.locktimeout", cfg.StoreBoltLockTimeout,
+		"How long to wait for the BoltDB file lock held by another scheduler")
+	fs.BoolVar(&cfg.StoreBoltFsync, "store.boltdb.fsync", cfg.StoreBoltFsync,
+		"Fsync the BoltDB file after every write")
+	fs.BoolVar(&cfg.StoreBoltCompact, "store.boltdb.compact", cfg.StoreBoltCompact,
+		"Compact the BoltDB file on startup")
+	fs.IntVar(&cfg.EventsMaxCount, "events.maxcount", cfg.EventsMaxCount,
+		"Maximum number of events to keep in the journal. 0 is unlimited")
+	fs.DurationVar(&cfg.EventsMaxAge, "events.maxage", cfg.EventsMaxAge,
+		"Maximum age of events to keep in the journal. 0 is unlimited")
+	fs.IntVar(&cfg.RetryLimit, "retry.limit", cfg.RetryLimit,
+		"Number of times a failed install step is retried. 0 disables retries")
+	fs.DurationVar(&cfg.RetryBackoff, "retry.backoff", cfg.RetryBackoff,
+		"How long to wait before the first retry of a failed install step")
+	fs.DurationVar(&cfg.RetryBackoffMax, "retry.backoffmax", cfg.RetryBackoffMax,
+		"The longest wait between retries of a failed install step")
+	fs.DurationVar(&cfg.UpgradeTimeout, "upgrade.timeout", cfg.UpgradeTimeout,
+		"How long a node has to finish a rolling upgrade before the upgrade is paused")
+	fs.IntVar(&cfg.RebootMaxSds, "reboot.maxsds", cfg.RebootMaxSds,
+		"Number of SDS nodes that can reboot at the same time")
+	fs.DurationVar(&cfg.RebootTimeout, "reboot.timeout", cfg.RebootTimeout,
+		"How long a node can hold a reboot lease before it is given to another node")
+	fs.DurationVar(&cfg.LivenessStale, "liveness.stale", cfg.LivenessStale,
+		"How long a node can go without pinging the scheduler before it is stale")
+	fs.DurationVar(&cfg.LivenessOffline, "liveness.offline", cfg.LivenessOffline,
+		"How long a node can go without pinging the scheduler before it is offline")
+	fs.DurationVar(&cfg.HealthInterval, "health.interval", cfg.HealthInterval,
+		"How often the health of the ScaleIO cluster is checked. 0 disables the checks")
 
 	fs.StringVar(&cfg.ClusterName, "scaleio.clustername", cfg.ClusterName, "ScaleIO Cluster Name")
 	fs.StringVar(&cfg.ClusterID, "scaleio.clusterid", cfg.ClusterID, "ScaleIO Cluster ID")
@@ -176,6 +255,10 @@ func (cfg *Config) AddFlags(fs *flag.FlagSet) {
 		"ScaleIO StoragePool Name")
 	fs.StringVar(&cfg.AdminPassword, "scaleio.password", cfg.AdminPassword,
 		"ScaleIO Admin Password")
+	fs.StringVar(&cfg.AdminPasswordFile, "scaleio.password.file", cfg.AdminPasswordFile,
+		"File containing the ScaleIO Admin Password. Supersedes scaleio.password")
+	fs.StringVar(&cfg.AdminPasswordEnv, "scaleio.password.env", cfg.AdminPasswordEnv,
+		"Environment variable containing the ScaleIO Admin Password. Supersedes scaleio.password")
 	fs.StringVar(&cfg.APIVersion, "scaleio.apiversion", cfg.APIVersion,
 		"ScaleIO API Version")
 	fs.StringVar(&cfg.PrimaryMdmAddress, "scaleio.preconfig.primary",
@@ -214,6 +297,44 @@ func (cfg *Config) AddFlags(fs *flag.FlagSet) {
 		"Size in GB in which to grow the volume")
 }
 
+//IsRestTLS returns true when the REST API is served over TLS
+func (cfg *Config) IsRestTLS() bool {
+	return len(cfg.RestTLSCert) > 0 && len(cfg.RestTLSKey) > 0
+}
+
+//RestURI returns the URI of the REST API
+func (cfg *Config) RestURI() string {
+	scheme := "http"
+	if cfg.IsRestTLS() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, cfg.RestAddress, cfg.RestPort)
+}
+
+//ResolveSecrets reads secrets that are passed by reference
+func (cfg *Config) ResolveSecrets() error {
+	if len(cfg.AdminPasswordFile) > 0 {
+		data, err := ioutil.ReadFile(cfg.AdminPasswordFile)
+		if err != nil {
+			return err
+		}
+		cfg.AdminPassword = strings.TrimSpace(string(data))
+		if len(cfg.AdminPassword) == 0 {
+			return ErrEmptyAdminPassword
+		}
+		return nil
+	}
+
+	if len(cfg.AdminPasswordEnv) > 0 {
+		cfg.AdminPassword = os.Getenv(cfg.AdminPasswordEnv)
+		if len(cfg.AdminPassword) == 0 {
+			return ErrEmptyAdminPassword
+		}
+	}
+
+	return nil
+}
+
 //NewConfig creates a new Config object
 func NewConfig() *Config {
 	ip, err := xplatform.GetInstance().Nw.AutoDiscoverIP()
@@ -235,6 +356,12 @@ func NewConfig() *Config {
 		IsolatorBinary:       env("ISOLATOR_BINARY", isoBin),
 		RestAddress:          env("REST_ADDRESS", ip),
 		RestPort:             envInt("REST_PORT", strconv.Itoa(DefaultRestPort)),
+		RestTLSCert:          env("REST_TLS_CERT", ""),
+		RestTLSKey:           env("REST_TLS_KEY", ""),
+		RestReadToken:        env("REST_TOKEN_READ", ""),
+		RestAdminToken:       env("REST_TOKEN_ADMIN", ""),
+		ExecutorTLSCAFile:    env("EXECUTOR_TLS_CAFILE", ""),
+		ExecutorTLSInsecure:  envBool("EXECUTOR_TLS_INSECURE", "false"),
 		MasterREST:           env("MESOS_MASTER_HTTP", "http://127.0.0.1:5050/api/v1/scheduler"),
 		AltExecutorPath:      env("ALT_EXECUTOR_PATH", ""),
 		ExecutorMdmCPU:       envFloat("EXECUTOR_MDM_CPU", strconv.FormatFloat(CPUPerMdmExecutor, 'f', -1, 64)),
@@ -248,12 +375,30 @@ func NewConfig() *Config {
 		Role:                 env("ROLE", "scaleio"),
 		Store:                env("STORE_TYPE", "zk"),
 		StoreURI:             env("STORE_URI", ""),
+		StoreBoltDir:         env("STORE_BOLTDB_DIR", "/var/lib/scaleio-framework"),
+		StoreBoltBucket:      env("STORE_BOLTDB_BUCKET", "scaleio-framework"),
+		StoreBoltLockTimeout: envDuration("STORE_BOLTDB_LOCK_TIMEOUT", "10s"),
+		StoreBoltFsync:       envBool("STORE_BOLTDB_FSYNC", "true"),
+		StoreBoltCompact:     envBool("STORE_BOLTDB_COMPACT", "false"),
+		EventsMaxCount:       envInt("EVENTS_MAX_COUNT", "10000"),
+		EventsMaxAge:         envDuration("EVENTS_MAX_AGE", "720h"),
+		RetryLimit:           envInt("RETRY_LIMIT", "5"),
+		RetryBackoff:         envDuration("RETRY_BACKOFF", "1m"),
+		RetryBackoffMax:      envDuration("RETRY_BACKOFF_MAX", "1h"),
+		UpgradeTimeout:       envDuration("UPGRADE_TIMEOUT", "2h"),
+		RebootMaxSds:         envInt("REBOOT_MAX_SDS", "1"),
+		RebootTimeout:        envDuration("REBOOT_TIMEOUT", "30m"),
+		LivenessStale:        envDuration("LIVENESS_STALE", "1m"),
+		LivenessOffline:      envDuration("LIVENESS_OFFLINE", "3m"),
+		HealthInterval:       envDuration("HEALTH_INTERVAL", "1m"),
 		ClusterName:          env("CLUSTER_NAME", "scaleio"),
 		ClusterID:            env("CLUSTER_ID", ""),
 		LbGateway:            env("LB_GATEWAY", ""),
 		ProtectionDomain:     env("PROTECTION_DOMAIN", "default"),
 		StoragePool:          env("STORAGE_POOL", "default"),
 		AdminPassword:        env("ADMIN_PASSWORD", "Scaleio123"),
+		AdminPasswordFile:    env("ADMIN_PASSWORD_FILE", ""),
+		AdminPasswordEnv:     env("ADMIN_PASSWORD_ENV", ""),
 		APIVersion:           env("API_VERSION", "2.0"),
 		PrimaryMdmAddress:    env("PRIMARY_MDM_ADDRESS", ""),
 		SecondaryMdmAddress:  env("SECONDARY_MDM_ADDRESS", ""),
@@ -53,7 +53,11 @@ func prerequisites(cfg *config.Config) bool {
 
 func main() {
 	for _, e := range os.Environ() {
-		pair := strings.Split(e, "=")
+		pair := strings.SplitN(e, "=", 2)
+		if strings.Contains(pair[0], "PASSWORD") || strings.Contains(pair[0], "TOKEN") {
+			log.Debugln(pair[0], "= <redacted>")
+			continue
+		}
 		log.Debugln(pair[0], "=", pair[1])
 	}
 
@@ -62,6 +66,12 @@ func main() {
 	cfg.AddFlags(fs)
 	fs.Parse(os.Args[1:])
 
+	err := cfg.ResolveSecrets()
+	if err != nil {
+		log.Fatalln("Unable to resolve the ScaleIO Admin Password:", err)
+		return
+	}
+
 	level, err := log.ParseLevel(cfg.LogLevel)
 	if err != nil {
 		log.Warnln("Invalid log level. Defaulting to info.")
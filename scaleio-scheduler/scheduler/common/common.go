@@ -14,6 +14,18 @@ var (
 
 	//ErrAttributeNotFound The attribute was not found
 	ErrAttributeNotFound = errors.New("The attribute was not found")
+
+	//ErrClusterNotConfigured The ScaleIO cluster has not been configured yet
+	ErrClusterNotConfigured = errors.New("The ScaleIO cluster has not been configured yet")
+
+	//ErrVolumeNotFound The volume was not found
+	ErrVolumeNotFound = errors.New("The volume was not found")
+
+	//ErrNotEnoughSpareCapacity The StoragePool cannot hold its data without the device
+	ErrNotEnoughSpareCapacity = errors.New("The StoragePool does not have enough spare capacity to remove the device")
+
+	//ErrSdsNotFound The SDS a device is attached through was not found
+	ErrSdsNotFound = errors.New("The SDS for the device was not found")
 )
 
 //PersonaStringToID String -> PersonaID
@@ -48,6 +60,74 @@ func PersonaIDToString(persona int) string {
 	}
 }
 
+//StateStringToID String -> StateID
+func StateStringToID(state string) int {
+	switch state {
+	case "cleanprereqsreboot":
+		return types.StateCleanPrereqsReboot
+	case "prerequisitesinstalled":
+		return types.StatePrerequisitesInstalled
+	case "basepackagesinstalled":
+		return types.StateBasePackagedInstalled
+	case "initializecluster":
+		return types.StateInitializeCluster
+	case "addresources":
+		return types.StateAddResourcesToScaleIO
+	case "installrexray":
+		return types.StateInstallRexRay
+	case "cleaninstallreboot":
+		return types.StateCleanInstallReboot
+	case "systemreboot":
+		return types.StateSystemReboot
+	case "finishinstall":
+		return types.StateFinishInstall
+	case "upgradecluster":
+		return types.StateUpgradeCluster
+	case "fatalinstall":
+		return types.StateFatalInstall
+	case "decommission":
+		return types.StateDecommission
+	case "decommissioned":
+		return types.StateDecommissioned
+	default:
+		return types.StateUnknown
+	}
+}
+
+//StateIDToString StateID -> String
+func StateIDToString(state int) string {
+	switch state {
+	case types.StateCleanPrereqsReboot:
+		return "cleanprereqsreboot"
+	case types.StatePrerequisitesInstalled:
+		return "prerequisitesinstalled"
+	case types.StateBasePackagedInstalled:
+		return "basepackagesinstalled"
+	case types.StateInitializeCluster:
+		return "initializecluster"
+	case types.StateAddResourcesToScaleIO:
+		return "addresources"
+	case types.StateInstallRexRay:
+		return "installrexray"
+	case types.StateCleanInstallReboot:
+		return "cleaninstallreboot"
+	case types.StateSystemReboot:
+		return "systemreboot"
+	case types.StateFinishInstall:
+		return "finishinstall"
+	case types.StateUpgradeCluster:
+		return "upgradecluster"
+	case types.StateFatalInstall:
+		return "fatalinstall"
+	case types.StateDecommission:
+		return "decommission"
+	case types.StateDecommissioned:
+		return "decommissioned"
+	default:
+		return "unknown"
+	}
+}
+
 //FindScaleIONodeByHostname Find ScaleIO node by Hostname
 func FindScaleIONodeByHostname(nodes []*types.ScaleIONode, hostname string) *types.ScaleIONode {
 	log.Debugln("FindScaleIONodeByHostname ENTER")
@@ -8,6 +8,9 @@ const (
 
 	//WaitForVolumeState the amount of time to wait for volume state changes
 	WaitForVolumeState = 1
+
+	//PollLivenessInSeconds the amount of time between liveness checks
+	PollLivenessInSeconds = 10
 )
 
 //RetrieveState is a call back to retrieve an update of the state
@@ -30,7 +33,8 @@ func SyncRunState(state *types.ScaleIOFramework, runState int, allNodes bool) bo
 				return false
 			}
 		case types.PersonaNode:
-			if allNodes && node.State < runState {
+			//an offline data node does not hold the others back
+			if allNodes && node.State < runState && node.Liveness != types.LivenessOffline {
 				return false
 			}
 		}
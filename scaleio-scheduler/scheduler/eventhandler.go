@@ -16,6 +16,7 @@ func (s *ScaleIOScheduler) subscribed(event *sched.Event) {
 func (s *ScaleIOScheduler) offers(event *sched.Event) {
 	offers := event.GetOffers().GetOffers()
 	log.Infoln("[EVENT] Received", len(offers), "OFFERS")
+	s.Server.Metrics.OffersReceived(len(offers))
 
 	err := s.performNodeSelection(offers)
 	if err != nil {
@@ -31,6 +32,7 @@ func (s *ScaleIOScheduler) offers(event *sched.Event) {
 			log.Debugln("Skipping agent as it already has an executor on it. Decline offer.")
 			message := generateDeclineCall(s.Config, offer)
 			s.send(message)
+			s.Server.Metrics.OfferDeclined()
 			continue
 		}
 
@@ -40,12 +42,28 @@ func (s *ScaleIOScheduler) offers(event *sched.Event) {
 			log.Errorln("Unable to find node by Hostname:", offer.GetHostname())
 			message := generateDeclineCall(s.Config, offer)
 			s.send(message)
+			s.Server.Metrics.OfferDeclined()
 			continue
 		}
 
+		//the offer changes every time and is not saved. Only a new agent (ie a
+		//node restored from the store) is written back.
+		s.Server.Lock()
+		node.OfferID = offer.GetId().GetValue()
+		if node.AgentID != offer.GetAgentId().GetValue() {
+			node.AgentID = offer.GetAgentId().GetValue()
+			err := s.Store.SetNodeRecord(node)
+			s.Server.Touch()
+			if err != nil {
+				log.Warnln("Failed to save node", node.Hostname, "to the store:", err)
+			}
+		}
+		s.Server.Unlock()
+
 		//generate accept call to launch executor
-		message := generateAcceptCall(s.Config, offer, node)
+		message := generateAcceptCall(s.Config, offer, node, s.Server.ExecutorToken(node.ExecutorID))
 		s.send(message)
+		s.Server.Metrics.OfferAccepted()
 	}
 }
 
@@ -58,6 +76,8 @@ func (s *ScaleIOScheduler) update(event *sched.Event) {
 	update := event.GetUpdate().GetStatus()
 	log.Infoln("[EVENT] Received STATUS:", update.String())
 
+	s.Server.UpdateTaskState(update.GetTaskId().GetValue(), update.GetState().String())
+
 	ackRequired := len(update.Uuid) > 0
 	if ackRequired {
 		message := generateAcknowledgeCall(s.Framework, update)
@@ -0,0 +1,541 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+	store "github.com/docker/libkv/store"
+
+	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/config"
+)
+
+const (
+	boltFileName = "scaleio-framework.db"
+
+	//same layout as the libkv boltdb backend. the first 8 bytes of every value
+	//holds the index used for the atomic operations
+	boltMetadataLen = 8
+
+	//the bucket the scheduler used with the libkv boltdb backend
+	boltLegacyBucket = "/tmp/boltdb"
+)
+
+var (
+	//ErrStoreLocked The BoltDB file is held by another process
+	ErrStoreLocked = errors.New("The BoltDB file is locked by another process. " +
+		"Is another ScaleIO scheduler running against the same store.boltdb.dir?")
+
+	//ErrBucketNotFound The BoltDB bucket could not be found
+	ErrBucketNotFound = errors.New("The BoltDB bucket could not be found")
+
+	//ErrStoreClosed The BoltDB file has been closed
+	ErrStoreClosed = errors.New("The BoltDB file has been closed")
+)
+
+//BoltStore is a single node store.Store backed by BoltDB. Unlike the libkv
+//boltdb backend, it holds the file lock for the life of the scheduler so two
+//schedulers can never share the same file. Every operation holds the read
+//lock. Compact and Close hold the write lock while they swap the file.
+type BoltStore struct {
+	db     *bolt.DB
+	bucket []byte
+	path   string
+	cfg    *config.Config
+
+	sync.RWMutex
+}
+
+func boltPath(cfg *config.Config) string {
+	//store.uri is still honored as the path to the file
+	if len(cfg.StoreURI) > 0 {
+		return cfg.StoreURI
+	}
+	return filepath.Join(cfg.StoreBoltDir, boltFileName)
+}
+
+func openBolt(path string, cfg *config.Config) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout: cfg.StoreBoltLockTimeout,
+	})
+	if err == bolt.ErrTimeout {
+		log.Errorln("Timed out waiting for the lock on", path)
+		return nil, ErrStoreLocked
+	}
+	if err != nil {
+		log.Errorln("Unable to open", path, ". Err:", err)
+		return nil, err
+	}
+
+	db.NoSync = !cfg.StoreBoltFsync
+	return db, nil
+}
+
+//NewBoltStore opens (or creates) the BoltDB file for the framework
+func NewBoltStore(cfg *config.Config) (*BoltStore, error) {
+	log.Debugln("NewBoltStore ENTER")
+
+	path := boltPath(cfg)
+	log.Infoln("BoltDB file:", path)
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		log.Errorln("Unable to create the BoltDB directory:", err)
+		log.Debugln("NewBoltStore LEAVE")
+		return nil, err
+	}
+
+	db, err := openBolt(path, cfg)
+	if err != nil {
+		log.Debugln("NewBoltStore LEAVE")
+		return nil, err
+	}
+
+	bucket := []byte(cfg.StoreBoltBucket)
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucket) == nil && tx.Bucket([]byte(boltLegacyBucket)) != nil {
+			return migrateBoltBucket(tx, bucket)
+		}
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		log.Errorln("Unable to create the BoltDB bucket:", err)
+		db.Close()
+		log.Debugln("NewBoltStore LEAVE")
+		return nil, err
+	}
+
+	b := &BoltStore{
+		db:     db,
+		bucket: bucket,
+		path:   path,
+		cfg:    cfg,
+	}
+
+	if cfg.StoreBoltCompact {
+		err = b.Compact()
+		if err != nil {
+			log.Errorln("Compaction failed:", err)
+			b.Close()
+			log.Debugln("NewBoltStore LEAVE")
+			return nil, err
+		}
+	}
+
+	log.Debugln("NewBoltStore Succeeded")
+	log.Debugln("NewBoltStore LEAVE")
+	return b, nil
+}
+
+//migrateBoltBucket moves the keys saved with the libkv boltdb backend to
+//bucket. libkv kept the index counter in memory, so the sequence starts past
+//the highest index found to keep the indexes handed out by put going up.
+func migrateBoltBucket(tx *bolt.Tx, bucket []byte) error {
+	log.Infoln("Moving the BoltDB bucket", boltLegacyBucket, "to", string(bucket))
+
+	legacy := tx.Bucket([]byte(boltLegacyBucket))
+	newBucket, err := tx.CreateBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	sequence := legacy.Sequence()
+	err = legacy.ForEach(func(k, v []byte) error {
+		if len(v) >= boltMetadataLen {
+			index := binary.LittleEndian.Uint64(v[:boltMetadataLen])
+			if index > sequence {
+				sequence = index
+			}
+		}
+		//the key and value point into the file which may be remapped by the put
+		return newBucket.Put(append([]byte{}, k...), append([]byte{}, v...))
+	})
+	if err != nil {
+		return err
+	}
+	if err = newBucket.SetSequence(sequence); err != nil {
+		return err
+	}
+
+	return tx.DeleteBucket([]byte(boltLegacyBucket))
+}
+
+//copyBolt copies every bucket of src to a new file at dstPath. The bucket
+//sequences are kept so the indexes handed out by put keep going up.
+func copyBolt(src *bolt.DB, dstPath string) error {
+	os.Remove(dstPath)
+
+	dst, err := bolt.Open(dstPath, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, srcBucket *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				err = srcBucket.ForEach(func(k, v []byte) error {
+					return dstBucket.Put(k, v)
+				})
+				if err != nil {
+					return err
+				}
+				return dstBucket.SetSequence(srcBucket.Sequence())
+			})
+		})
+	})
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+	return err
+}
+
+//Compact rewrites the BoltDB file to release the free pages. The file is
+//closed while it is swapped and reopened after, so nothing else can use the
+//store until it is done.
+func (b *BoltStore) Compact() error {
+	log.Debugln("Compact ENTER")
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.db == nil {
+		log.Debugln("Compact LEAVE")
+		return ErrStoreClosed
+	}
+
+	tmpPath := b.path + ".compact"
+	err := copyBolt(b.db, tmpPath)
+	if err != nil {
+		log.Errorln("Unable to copy", b.path, ". Err:", err)
+		log.Debugln("Compact LEAVE")
+		return err
+	}
+
+	if err = b.db.Close(); err != nil {
+		log.Warnln("Failed to close", b.path, ". Err:", err)
+	}
+	b.db = nil
+
+	err = os.Rename(tmpPath, b.path)
+	if err != nil {
+		log.Errorln("Unable to replace", b.path, ". Err:", err)
+		os.Remove(tmpPath)
+	}
+
+	//reopen whether the swap worked or not
+	db, errOpen := openBolt(b.path, b.cfg)
+	if errOpen != nil {
+		log.Debugln("Compact LEAVE")
+		return errOpen
+	}
+	b.db = db
+	if err != nil {
+		log.Debugln("Compact LEAVE")
+		return err
+	}
+
+	log.Infoln("Compacted", b.path)
+	log.Debugln("Compact LEAVE")
+	return nil
+}
+
+//view runs fn in a read-only transaction while holding the read lock
+func (b *BoltStore) view(fn func(tx *bolt.Tx) error) error {
+	b.RLock()
+	defer b.RUnlock()
+
+	if b.db == nil {
+		return ErrStoreClosed
+	}
+	return b.db.View(fn)
+}
+
+//update runs fn in a read-write transaction while holding the read lock
+func (b *BoltStore) update(fn func(tx *bolt.Tx) error) error {
+	b.RLock()
+	defer b.RUnlock()
+
+	if b.db == nil {
+		return ErrStoreClosed
+	}
+	return b.db.Update(fn)
+}
+
+func normalizeBoltKey(key string) string {
+	return strings.TrimSuffix(strings.TrimSpace(key), "/")
+}
+
+func (b *BoltStore) get(tx *bolt.Tx, key string) *store.KVPair {
+	bucket := tx.Bucket(b.bucket)
+	if bucket == nil {
+		return nil
+	}
+	val := bucket.Get([]byte(key))
+	if val == nil || len(val) < boltMetadataLen {
+		return nil
+	}
+
+	value := make([]byte, len(val)-boltMetadataLen)
+	copy(value, val[boltMetadataLen:])
+
+	return &store.KVPair{
+		Key:       key,
+		Value:     value,
+		LastIndex: binary.LittleEndian.Uint64(val[:boltMetadataLen]),
+	}
+}
+
+func (b *BoltStore) put(tx *bolt.Tx, key string, value []byte) (uint64, error) {
+	bucket := tx.Bucket(b.bucket)
+	if bucket == nil {
+		return 0, ErrBucketNotFound
+	}
+
+	index, err := bucket.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+
+	dbval := make([]byte, boltMetadataLen)
+	binary.LittleEndian.PutUint64(dbval, index)
+	dbval = append(dbval, value...)
+
+	return index, bucket.Put([]byte(key), dbval)
+}
+
+//Get a value given its key
+func (b *BoltStore) Get(key string) (*store.KVPair, error) {
+	key = normalizeBoltKey(key)
+
+	var pair *store.KVPair
+	err := b.view(func(tx *bolt.Tx) error {
+		pair = b.get(tx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, store.ErrKeyNotFound
+	}
+	return pair, nil
+}
+
+//Put a value at the specified key
+func (b *BoltStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	key = normalizeBoltKey(key)
+
+	return b.update(func(tx *bolt.Tx) error {
+		_, err := b.put(tx, key, value)
+		return err
+	})
+}
+
+//Delete a value at the specified key. Deleting a missing key is not an error.
+func (b *BoltStore) Delete(key string) error {
+	key = normalizeBoltKey(key)
+
+	return b.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+//Exists verifies if a key exists
+func (b *BoltStore) Exists(key string) (bool, error) {
+	_, err := b.Get(key)
+	if err == store.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//List returns the immediate children of a directory. Like zookeeper, the key
+//in each pair is the name of the child relative to the directory.
+func (b *BoltStore) List(directory string) ([]*store.KVPair, error) {
+	directory = normalizeBoltKey(directory)
+	prefix := []byte(directory + "/")
+
+	found := false
+	pairs := make([]*store.KVPair, 0)
+	children := make(map[string]bool)
+
+	err := b.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+
+		found = b.get(tx, directory) != nil
+
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			found = true
+
+			child := strings.SplitN(string(k[len(prefix):]), "/", 2)[0]
+			if len(child) == 0 || children[child] {
+				continue
+			}
+			children[child] = true
+
+			pair := b.get(tx, directory+"/"+child)
+			if pair == nil {
+				pair = &store.KVPair{}
+			}
+			pair.Key = child
+			pairs = append(pairs, pair)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+//DeleteTree deletes the directory and everything under it
+func (b *BoltStore) DeleteTree(directory string) error {
+	directory = normalizeBoltKey(directory)
+	prefix := []byte(directory + "/")
+
+	return b.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+
+		keys := make([][]byte, 0)
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			key := make([]byte, len(k))
+			copy(key, k)
+			keys = append(keys, key)
+		}
+		keys = append(keys, []byte(directory))
+
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//AtomicPut puts a value only if the key has not changed since previous
+func (b *BoltStore) AtomicPut(key string, value []byte, previous *store.KVPair,
+	options *store.WriteOptions) (bool, *store.KVPair, error) {
+	key = normalizeBoltKey(key)
+
+	var pair *store.KVPair
+	err := b.update(func(tx *bolt.Tx) error {
+		current := b.get(tx, key)
+		if previous == nil && current != nil {
+			return store.ErrKeyExists
+		}
+		if previous != nil {
+			if current == nil {
+				return store.ErrKeyNotFound
+			}
+			if current.LastIndex != previous.LastIndex {
+				return store.ErrKeyModified
+			}
+		}
+
+		index, err := b.put(tx, key, value)
+		if err != nil {
+			return err
+		}
+		pair = &store.KVPair{
+			Key:       key,
+			Value:     value,
+			LastIndex: index,
+		}
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return true, pair, nil
+}
+
+//AtomicDelete deletes a value only if the key has not changed since previous
+func (b *BoltStore) AtomicDelete(key string, previous *store.KVPair) (bool, error) {
+	if previous == nil {
+		return false, store.ErrPreviousNotSpecified
+	}
+	key = normalizeBoltKey(key)
+
+	err := b.update(func(tx *bolt.Tx) error {
+		current := b.get(tx, key)
+		if current == nil {
+			return store.ErrKeyNotFound
+		}
+		if current.LastIndex != previous.LastIndex {
+			return store.ErrKeyModified
+		}
+		return tx.Bucket(b.bucket).Delete([]byte(key))
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//Watch is not supported by BoltDB
+func (b *BoltStore) Watch(key string, stopCh <-chan struct{}) (<-chan *store.KVPair, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+//WatchTree is not supported by BoltDB
+func (b *BoltStore) WatchTree(directory string, stopCh <-chan struct{}) (<-chan []*store.KVPair, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+//NewLock is not supported by BoltDB. The file lock already guarantees a
+//single scheduler.
+func (b *BoltStore) NewLock(key string, options *store.LockOptions) (store.Locker, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+//Close syncs and releases the BoltDB file
+func (b *BoltStore) Close() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.db == nil {
+		return
+	}
+	if b.db.NoSync {
+		if err := b.db.Sync(); err != nil {
+			log.Warnln("Failed to sync", b.path, ". Err:", err)
+		}
+	}
+	if err := b.db.Close(); err != nil {
+		log.Warnln("Failed to close", b.path, ". Err:", err)
+	}
+	b.db = nil
+}
@@ -0,0 +1,167 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	store "github.com/docker/libkv/store"
+	assert "github.com/stretchr/testify/assert"
+
+	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/config"
+)
+
+func newTestBoltConfig(t *testing.T) (*config.Config, func()) {
+	dir, err := ioutil.TempDir("", "bolt-test")
+	assert.NoError(t, err)
+
+	cfg := config.NewConfig()
+	cfg.Store = "boltdb"
+	cfg.StoreURI = filepath.Join(dir, boltFileName)
+	cfg.StoreBoltCompact = false
+	return cfg, func() { os.RemoveAll(dir) }
+}
+
+func TestBoltPutGet(t *testing.T) {
+	cfg, cleanup := newTestBoltConfig(t)
+	defer cleanup()
+
+	b, err := NewBoltStore(cfg)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	_, err = b.Get("scaleio-framework/missing")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	assert.NoError(t, b.Put("scaleio-framework/configuration", []byte(""), nil))
+	assert.NoError(t, b.Put("scaleio-framework/configuration/node1", []byte("value1"), nil))
+	assert.NoError(t, b.Put("scaleio-framework/configuration/node2/", []byte("value2"), nil))
+
+	pair, err := b.Get("scaleio-framework/configuration/node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", string(pair.Value))
+
+	exists, err := b.Exists("scaleio-framework/configuration/node2")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	pairs, err := b.List("scaleio-framework/configuration")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(pairs))
+
+	assert.NoError(t, b.DeleteTree("scaleio-framework/configuration"))
+	exists, err = b.Exists("scaleio-framework/configuration/node1")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestBoltCompactReopen(t *testing.T) {
+	cfg, cleanup := newTestBoltConfig(t)
+	defer cleanup()
+
+	b, err := NewBoltStore(cfg)
+	assert.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, b.Put("scaleio-framework/"+key, []byte(key), nil))
+	}
+	assert.NoError(t, b.Delete("scaleio-framework/d"))
+
+	before, err := b.Get("scaleio-framework/c")
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Compact())
+
+	//the data and the sequence survive the compaction
+	pair, err := b.Get("scaleio-framework/c")
+	assert.NoError(t, err)
+	assert.Equal(t, "c", string(pair.Value))
+	assert.Equal(t, before.LastIndex, pair.LastIndex)
+
+	assert.NoError(t, b.Put("scaleio-framework/e", []byte("e"), nil))
+	pair, err = b.Get("scaleio-framework/e")
+	assert.NoError(t, err)
+	assert.True(t, pair.LastIndex > before.LastIndex)
+
+	_, err = os.Stat(cfg.StoreURI + ".compact")
+	assert.True(t, os.IsNotExist(err))
+
+	b.Close()
+	_, err = b.Get("scaleio-framework/c")
+	assert.Equal(t, ErrStoreClosed, err)
+
+	//compact again when the store is opened
+	cfg.StoreBoltCompact = true
+	b, err = NewBoltStore(cfg)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	pair, err = b.Get("scaleio-framework/e")
+	assert.NoError(t, err)
+	assert.Equal(t, "e", string(pair.Value))
+
+	_, err = b.Get("scaleio-framework/d")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	err = b.view(func(tx *bolt.Tx) error {
+		assert.Equal(t, pair.LastIndex, tx.Bucket(b.bucket).Sequence())
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestBoltLocked(t *testing.T) {
+	cfg, cleanup := newTestBoltConfig(t)
+	defer cleanup()
+
+	b, err := NewBoltStore(cfg)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	cfg.StoreBoltLockTimeout = 1
+	_, err = NewBoltStore(cfg)
+	assert.Equal(t, ErrStoreLocked, err)
+}
+
+func TestBoltLegacyBucket(t *testing.T) {
+	cfg, cleanup := newTestBoltConfig(t)
+	defer cleanup()
+
+	//written by the libkv boltdb backend
+	db, err := bolt.Open(cfg.StoreURI, 0600, nil)
+	assert.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte(boltLegacyBucket))
+		if err != nil {
+			return err
+		}
+		value := make([]byte, boltMetadataLen)
+		binary.LittleEndian.PutUint64(value, 7)
+		return bucket.Put([]byte("scaleio-framework/version"), append(value, []byte("1")...))
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	b, err := NewBoltStore(cfg)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	pair, err := b.Get("scaleio-framework/version")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(pair.Value))
+	assert.Equal(t, uint64(7), pair.LastIndex)
+
+	assert.NoError(t, b.Put("scaleio-framework/configured", []byte("true"), nil))
+	pair, err = b.Get("scaleio-framework/configured")
+	assert.NoError(t, err)
+	assert.True(t, pair.LastIndex > 7)
+
+	err = b.view(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte(boltLegacyBucket)))
+		return nil
+	})
+	assert.NoError(t, err)
+}
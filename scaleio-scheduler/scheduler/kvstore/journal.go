@@ -0,0 +1,216 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+/*
+Event journal in the KeyValue Store:
+
+scaleio-framework/<framework role>
+	/journal
+		first = 1
+		last = 3
+		00000000000000000001 = <json of event>
+		00000000000000000002 = <json of event>
+		00000000000000000003 = <json of event>
+*/
+
+func (kv *KvStore) journalKey(name string) string {
+	return kv.RootKey + "/journal/" + name
+}
+
+func eventName(sequence uint64) string {
+	return fmt.Sprintf("%020d", sequence)
+}
+
+func (kv *KvStore) getJournalIndex(name string) uint64 {
+	pair, err := kv.Store.Get(kv.journalKey(name))
+	if err != nil || pair == nil {
+		return 0
+	}
+	index, err := strconv.ParseUint(string(pair.Value), 10, 64)
+	if err != nil {
+		log.Warnln("Invalid journal index", name, "=", string(pair.Value))
+		return 0
+	}
+	return index
+}
+
+func (kv *KvStore) setJournalIndex(name string, index uint64) error {
+	return kv.Store.Put(kv.journalKey(name), []byte(strconv.FormatUint(index, 10)), nil)
+}
+
+func (kv *KvStore) getEvent(sequence uint64) (*types.Event, error) {
+	pair, err := kv.Store.Get(kv.journalKey(eventName(sequence)))
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrInvalidKeyValue
+	}
+
+	event := &types.Event{}
+	err = json.Unmarshal(pair.Value, event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+//pruneJournal drops the oldest events past the count and age limits
+func (kv *KvStore) pruneJournal(first uint64, last uint64) uint64 {
+	maxCount := uint64(kv.Config.EventsMaxCount)
+	oldest := time.Now().Add(-kv.Config.EventsMaxAge).Unix()
+
+	for first > 0 && first < last {
+		if maxCount == 0 || last-first+1 <= maxCount {
+			event, err := kv.getEvent(first)
+			if err == nil && (kv.Config.EventsMaxAge == 0 || event.Timestamp >= oldest) {
+				break
+			}
+		}
+
+		err := kv.Store.Delete(kv.journalKey(eventName(first)))
+		if err != nil {
+			log.Warnln("Failed to prune event", first, ". Err:", err)
+			break
+		}
+		first++
+	}
+
+	return first
+}
+
+//AppendEvent adds an event to the end of the journal
+func (kv *KvStore) AppendEvent(event *types.Event) error {
+	log.Debugln("AppendEvent ENTER")
+
+	kv.journalLock.Lock()
+	defer kv.journalLock.Unlock()
+
+	kv.Store.Put(kv.RootKey+"/journal", []byte(""), nil)
+
+	first := kv.getJournalIndex("first")
+	last := kv.getJournalIndex("last")
+
+	event.Sequence = last + 1
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		log.Errorln("Failed to marshal event:", err)
+		log.Debugln("AppendEvent LEAVE")
+		return err
+	}
+
+	err = kv.Store.Put(kv.journalKey(eventName(event.Sequence)), value, nil)
+	if err != nil {
+		log.Errorln("Failed to save event:", err)
+		log.Debugln("AppendEvent LEAVE")
+		return err
+	}
+
+	err = kv.setJournalIndex("last", event.Sequence)
+	if err != nil {
+		log.Errorln("Failed to set last on journal:", err)
+		log.Debugln("AppendEvent LEAVE")
+		return err
+	}
+
+	if first == 0 {
+		first = event.Sequence
+	}
+	newFirst := kv.pruneJournal(first, event.Sequence)
+	if newFirst != kv.getJournalIndex("first") {
+		err = kv.setJournalIndex("first", newFirst)
+		if err != nil {
+			log.Errorln("Failed to set first on journal:", err)
+			log.Debugln("AppendEvent LEAVE")
+			return err
+		}
+	}
+
+	log.Debugln("AppendEvent Succeeded. Sequence:", event.Sequence)
+	log.Debugln("AppendEvent LEAVE")
+	return nil
+}
+
+func (kv *KvStore) getJournalRange() (uint64, uint64) {
+	kv.journalLock.Lock()
+	defer kv.journalLock.Unlock()
+	return kv.getJournalIndex("first"), kv.getJournalIndex("last")
+}
+
+//readEvents reads at most limit events starting at the start sequence
+func (kv *KvStore) readEvents(start uint64, last uint64, limit uint64) []*types.Event {
+	events := make([]*types.Event, 0)
+	for sequence := start; sequence <= last && uint64(len(events)) < limit; sequence++ {
+		event, err := kv.getEvent(sequence)
+		if err != nil {
+			//pruned while reading
+			log.Debugln("Event", sequence, "not found. Err:", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+//GetEvents returns at most limit events in the journal after the since
+//sequence, oldest first. Page through the journal by passing the sequence of
+//the last event returned as since.
+func (kv *KvStore) GetEvents(since uint64, limit uint64) ([]*types.Event, error) {
+	log.Debugln("GetEvents ENTER")
+	log.Debugln("since:", since, "limit:", limit)
+
+	first, last := kv.getJournalRange()
+	if first == 0 {
+		log.Debugln("Journal is empty")
+		log.Debugln("GetEvents LEAVE")
+		return make([]*types.Event, 0), nil
+	}
+
+	start := since + 1
+	if start < first {
+		start = first
+	}
+	events := kv.readEvents(start, last, limit)
+
+	log.Debugln("GetEvents Succeeded. Events:", len(events))
+	log.Debugln("GetEvents LEAVE")
+	return events, nil
+}
+
+//GetLastEvents returns the newest events in the journal, at most limit of
+//them, oldest first
+func (kv *KvStore) GetLastEvents(limit uint64) ([]*types.Event, error) {
+	log.Debugln("GetLastEvents ENTER")
+	log.Debugln("limit:", limit)
+
+	first, last := kv.getJournalRange()
+	if first == 0 || limit == 0 {
+		log.Debugln("Journal is empty")
+		log.Debugln("GetLastEvents LEAVE")
+		return make([]*types.Event, 0), nil
+	}
+
+	start := first
+	if last-first+1 > limit {
+		start = last - limit + 1
+	}
+	events := kv.readEvents(start, last, limit)
+
+	log.Debugln("GetLastEvents Succeeded. Events:", len(events))
+	log.Debugln("GetLastEvents LEAVE")
+	return events, nil
+}
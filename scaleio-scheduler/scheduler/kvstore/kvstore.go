@@ -1,16 +1,19 @@
 package kvstore
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/libkv"
 	store "github.com/docker/libkv/store"
-	"github.com/docker/libkv/store/boltdb"
 	"github.com/docker/libkv/store/consul"
 	"github.com/docker/libkv/store/etcd"
 	"github.com/docker/libkv/store/zookeeper"
@@ -48,38 +51,71 @@ type KvStore struct {
 	Config  *config.Config
 	Store   store.Store
 	RootKey string
+
+	journalLock sync.Mutex
 }
 
-//Device representation
+//Device representation. Sds is the SDS the device is attached through. It is
+//empty for devices saved before a node could run more than one SDS.
+//RemovePending marks a device being deleted that ScaleIO has not finished
+//removing. It is kept in the store until ScaleIO is done.
 type Device struct {
-	Name   string
-	Delete bool
-	Add    bool
+	Name          string
+	Sds           string
+	Delete        bool
+	RemovePending bool
+	Add           bool
+}
+
+//IsRemoved is true when the device is deleted and ScaleIO is done with it
+func (d *Device) IsRemoved() bool {
+	return d.Delete && !d.RemovePending
 }
 
 //StoragePool representation
 type StoragePool struct {
-	Name    string
-	Devices map[string]*Device
-	Delete  bool
-	Add     bool
+	Name          string
+	Devices       map[string]*Device
+	Delete        bool
+	RemovePending bool
+	Add           bool
+}
+
+//IsRemoved is true when the StoragePool is deleted and ScaleIO is done with it
+func (sp *StoragePool) IsRemoved() bool {
+	return sp.Delete && !sp.RemovePending
 }
 
 //Sds representation
 type Sds struct {
-	Name   string
-	Mode   int
-	Delete bool
-	Add    bool
+	Name          string
+	Mode          int
+	IPs           []string
+	Port          int
+	Delete        bool
+	RemovePending bool
+	Add           bool
+}
+
+//IsRemoved is true when the SDS is deleted and ScaleIO is done with it
+func (sds *Sds) IsRemoved() bool {
+	return sds.Delete && !sds.RemovePending
 }
 
 //ProtectionDomain representation
 type ProtectionDomain struct {
-	Name   string
-	Pools  map[string]*StoragePool
-	Sdss   map[string]*Sds
-	Delete bool
-	Add    bool
+	Name          string
+	Pools         map[string]*StoragePool
+	Sdss          map[string]*Sds
+	Delete        bool
+	RemovePending bool
+	Add           bool
+}
+
+//IsRemoved is true when the ProtectionDomain is deleted and ScaleIO is done
+//with it
+func (pd *ProtectionDomain) IsRemoved() bool {
+	return pd.Delete && !pd.RemovePending
 }
 
 //Metadata representation
@@ -96,36 +132,44 @@ func NewKvStore(cfg *config.Config) (*KvStore, error) {
 	backend := store.Backend(cfg.Store)
 	log.Debugln("backend:", backend)
 
-	endpoints := []string{cfg.StoreURI}
-	if len(cfg.StoreURI) == 0 {
-		var err error
-		endpoints, err = readZookeeperFile()
+	var myStore store.Store
+	if backend == store.BOLTDB {
+		boltStore, err := NewBoltStore(cfg)
 		if err != nil {
-			log.Errorln("Invalid libkv store type.")
+			log.Errorln("Unable to initialize the BoltDB Store")
 			return nil, err
 		}
-	}
-	log.Debugln("endpoints:", endpoints)
-
-	switch backend {
-	case store.CONSUL:
-		consul.Register()
-	case store.ZK:
-		zookeeper.Register()
-	case store.ETCD:
-		etcd.Register()
-	case store.BOLTDB:
-		boltdb.Register()
-		storeCfg.Bucket = "/tmp/boltdb"
-	default:
-		log.Errorln("Invalid libkv store type.")
-		return nil, ErrStoreType
-	}
+		myStore = boltStore
+	} else {
+		endpoints := []string{cfg.StoreURI}
+		if len(cfg.StoreURI) == 0 {
+			var err error
+			endpoints, err = readZookeeperFile()
+			if err != nil {
+				log.Errorln("Invalid libkv store type.")
+				return nil, err
+			}
+		}
+		log.Debugln("endpoints:", endpoints)
+
+		switch backend {
+		case store.CONSUL:
+			consul.Register()
+		case store.ZK:
+			zookeeper.Register()
+		case store.ETCD:
+			etcd.Register()
+		default:
+			log.Errorln("Invalid libkv store type.")
+			return nil, ErrStoreType
+		}
 
-	myStore, err := libkv.NewStore(backend, endpoints, &storeCfg)
-	if err != nil {
-		log.Errorln("Unable to initialize the Store")
-		return nil, err
+		var err error
+		myStore, err = libkv.NewStore(backend, endpoints, &storeCfg)
+		if err != nil {
+			log.Errorln("Unable to initialize the Store")
+			return nil, err
+		}
 	}
 
 	//sets the root for this framework instance
@@ -251,6 +295,11 @@ func (kv *KvStore) dumpTree(dir string) {
 	}
 }
 
+//Close releases the connection to the Store
+func (kv *KvStore) Close() {
+	kv.Store.Close()
+}
+
 //DeleteStore deletes all ScaleIO Framework metadata
 func (kv *KvStore) DeleteStore() {
 	log.Debugln("Calling DeleteStore...")
@@ -498,6 +547,554 @@ func (kv *KvStore) SetNodeInfo(nodeID string, persona int, state int) error {
 	return nil
 }
 
+//GetSetting returns a setting saved directly under configuration
+func (kv *KvStore) GetSetting(name string) (string, error) {
+	pair, err := kv.Store.Get(kv.RootKey + "/configuration/" + name)
+	if err != nil {
+		return "", err
+	}
+	if pair == nil {
+		return "", ErrInvalidKeyValue
+	}
+	return string(pair.Value), nil
+}
+
+//SetSetting saves a setting directly under configuration
+func (kv *KvStore) SetSetting(name string, value string) error {
+	return kv.Store.Put(kv.RootKey+"/configuration/"+name, []byte(value), nil)
+}
+
+//GetTopology returns the topology declared through the REST API
+func (kv *KvStore) GetTopology() (*types.Topology, error) {
+	log.Debugln("GetTopology ENTER")
+
+	pair, err := kv.Store.Get(kv.RootKey + "/topology")
+	if err != nil {
+		log.Debugln("Store.Get(topology) err:", err)
+		log.Debugln("GetTopology LEAVE")
+		return nil, err
+	}
+	if pair == nil || len(pair.Value) == 0 {
+		log.Debugln("No topology has been declared")
+		log.Debugln("GetTopology LEAVE")
+		return nil, ErrInvalidKeyValue
+	}
+
+	topology := &types.Topology{}
+	err = json.Unmarshal(pair.Value, topology)
+	if err != nil {
+		log.Errorln("Failed to unmarshal the topology:", err)
+		log.Debugln("GetTopology LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetTopology Succeeded")
+	log.Debugln("GetTopology LEAVE")
+	return topology, nil
+}
+
+//SetTopology saves the topology declared through the REST API
+func (kv *KvStore) SetTopology(topology *types.Topology) error {
+	log.Debugln("SetTopology ENTER")
+
+	value, err := json.Marshal(topology)
+	if err != nil {
+		log.Errorln("Failed to marshal the topology:", err)
+		log.Debugln("SetTopology LEAVE")
+		return err
+	}
+
+	err = kv.Store.Put(kv.RootKey+"/topology", value, nil)
+	if err != nil {
+		log.Errorln("Failed to set the topology on store:", err)
+		log.Debugln("SetTopology LEAVE")
+		return err
+	}
+
+	log.Debugln("SetTopology Succeeded")
+	log.Debugln("SetTopology LEAVE")
+	return nil
+}
+
+//GetUpgrade returns the last rolling upgrade
+func (kv *KvStore) GetUpgrade() (*types.Upgrade, error) {
+	log.Debugln("GetUpgrade ENTER")
+
+	pair, err := kv.Store.Get(kv.RootKey + "/upgrade")
+	if err != nil {
+		log.Debugln("Store.Get(upgrade) err:", err)
+		log.Debugln("GetUpgrade LEAVE")
+		return nil, err
+	}
+	if pair == nil || len(pair.Value) == 0 {
+		log.Debugln("No upgrade has been started")
+		log.Debugln("GetUpgrade LEAVE")
+		return nil, ErrInvalidKeyValue
+	}
+
+	upgrade := &types.Upgrade{}
+	err = json.Unmarshal(pair.Value, upgrade)
+	if err != nil {
+		log.Errorln("Failed to unmarshal the upgrade:", err)
+		log.Debugln("GetUpgrade LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetUpgrade Succeeded")
+	log.Debugln("GetUpgrade LEAVE")
+	return upgrade, nil
+}
+
+//SetUpgrade saves the progress of a rolling upgrade
+func (kv *KvStore) SetUpgrade(upgrade *types.Upgrade) error {
+	log.Debugln("SetUpgrade ENTER")
+
+	value, err := json.Marshal(upgrade)
+	if err != nil {
+		log.Errorln("Failed to marshal the upgrade:", err)
+		log.Debugln("SetUpgrade LEAVE")
+		return err
+	}
+
+	err = kv.Store.Put(kv.RootKey+"/upgrade", value, nil)
+	if err != nil {
+		log.Errorln("Failed to set the upgrade on store:", err)
+		log.Debugln("SetUpgrade LEAVE")
+		return err
+	}
+
+	log.Debugln("SetUpgrade Succeeded")
+	log.Debugln("SetUpgrade LEAVE")
+	return nil
+}
+
+//GetRebootLeases returns the reboot leases held by the nodes by hostname
+func (kv *KvStore) GetRebootLeases() (map[string]*types.RebootLease, error) {
+	log.Debugln("GetRebootLeases ENTER")
+
+	pair, err := kv.Store.Get(kv.RootKey + "/rebootleases")
+	if err != nil {
+		log.Debugln("Store.Get(rebootleases) err:", err)
+		log.Debugln("GetRebootLeases LEAVE")
+		return nil, err
+	}
+
+	leases := make(map[string]*types.RebootLease)
+	if pair == nil || len(pair.Value) == 0 {
+		log.Debugln("No reboot leases are held")
+		log.Debugln("GetRebootLeases LEAVE")
+		return leases, nil
+	}
+
+	err = json.Unmarshal(pair.Value, &leases)
+	if err != nil {
+		log.Errorln("Failed to unmarshal the reboot leases:", err)
+		log.Debugln("GetRebootLeases LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetRebootLeases Succeeded")
+	log.Debugln("GetRebootLeases LEAVE")
+	return leases, nil
+}
+
+//SetRebootLeases saves the reboot leases held by the nodes
+func (kv *KvStore) SetRebootLeases(leases map[string]*types.RebootLease) error {
+	log.Debugln("SetRebootLeases ENTER")
+
+	value, err := json.Marshal(leases)
+	if err != nil {
+		log.Errorln("Failed to marshal the reboot leases:", err)
+		log.Debugln("SetRebootLeases LEAVE")
+		return err
+	}
+
+	err = kv.Store.Put(kv.RootKey+"/rebootleases", value, nil)
+	if err != nil {
+		log.Errorln("Failed to set the reboot leases on store:", err)
+		log.Debugln("SetRebootLeases LEAVE")
+		return err
+	}
+
+	log.Debugln("SetRebootLeases Succeeded")
+	log.Debugln("SetRebootLeases LEAVE")
+	return nil
+}
+
+//WatchTree watches a directory relative to the framework root
+func (kv *KvStore) WatchTree(dir string, stopCh <-chan struct{}) (<-chan []*store.KVPair, error) {
+	return kv.Store.WatchTree(kv.RootKey+"/"+dir, stopCh)
+}
+
+//GetSecretKey returns the key used to sign executor tokens. The key is
+//created the first time it is requested.
+func (kv *KvStore) GetSecretKey() ([]byte, error) {
+	log.Debugln("GetSecretKey ENTER")
+
+	keyPath := kv.RootKey + "/secrets/key"
+	pair, err := kv.Store.Get(keyPath)
+	if err == nil && pair != nil && len(pair.Value) > 0 {
+		key, errDecode := hex.DecodeString(string(pair.Value))
+		if errDecode == nil {
+			log.Debugln("GetSecretKey Succeeded")
+			log.Debugln("GetSecretKey LEAVE")
+			return key, nil
+		}
+		log.Warnln("Invalid secret key in store. Generating a new one.")
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		log.Errorln("Failed to generate secret key:", err)
+		log.Debugln("GetSecretKey LEAVE")
+		return nil, err
+	}
+
+	kv.Store.Put(kv.RootKey+"/secrets", []byte(""), nil)
+	err = kv.Store.Put(keyPath, []byte(hex.EncodeToString(key)), nil)
+	if err != nil {
+		log.Errorln("Failed to save secret key:", err)
+		log.Debugln("GetSecretKey LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetSecretKey Succeeded")
+	log.Debugln("GetSecretKey LEAVE")
+	return key, nil
+}
+
+//getNodeList returns the nodes with a record. The list is kept outside of
+//configuration so saving it doesn't set off the watch on the settings.
+func (kv *KvStore) getNodeList() []string {
+	pair, err := kv.Store.Get(kv.RootKey + "/nodelist")
+	if err == store.ErrKeyNotFound {
+		//saved before the list had its own key
+		pair, err = kv.Store.Get(kv.RootKey + "/configuration/nodes")
+	}
+	if err != nil || pair == nil || len(pair.Value) == 0 {
+		return make([]string, 0)
+	}
+	return strings.Split(string(pair.Value), ",")
+}
+
+func (kv *KvStore) setNodeList(nodeList []string) error {
+	err := kv.Store.Put(kv.RootKey+"/nodelist", []byte(strings.Join(nodeList, ",")), nil)
+	if err != nil {
+		return err
+	}
+	err = kv.Store.Delete(kv.RootKey + "/configuration/nodes")
+	if err == store.ErrKeyNotFound {
+		err = nil
+	}
+	return err
+}
+
+func (kv *KvStore) addToNodeList(nodeID string) error {
+	nodeList := kv.getNodeList()
+	for _, node := range nodeList {
+		if node == nodeID {
+			return nil
+		}
+	}
+	nodeList = append(nodeList, nodeID)
+
+	return kv.setNodeList(nodeList)
+}
+
+func (kv *KvStore) removeFromNodeList(nodeID string) error {
+	nodeList := make([]string, 0)
+	for _, node := range kv.getNodeList() {
+		if node != nodeID {
+			nodeList = append(nodeList, node)
+		}
+	}
+
+	return kv.setNodeList(nodeList)
+}
+
+func (kv *KvStore) getNodeValue(rootNode string, key string) string {
+	pair, err := kv.Store.Get(rootNode + "/" + key)
+	if err != nil || pair == nil {
+		log.Debugln("Store.Get(", key, ") is empty")
+		return ""
+	}
+	log.Debugln(pair.Key, "=", string(pair.Value))
+	return string(pair.Value)
+}
+
+//SetNodeRecord saves everything needed to restore a node besides the persona
+//and state which are saved by SetNodeInfo
+func (kv *KvStore) SetNodeRecord(node *types.ScaleIONode) error {
+	log.Debugln("SetNodeRecord ENTER")
+
+	if node == nil || len(node.Hostname) == 0 {
+		log.Errorln("Node or Hostname is empty. Return error.")
+		log.Debugln("SetNodeRecord LEAVE")
+		return ErrInvalidKeyValue
+	}
+	log.Debugln("nodeID:", node.Hostname)
+
+	provides, err := json.Marshal(node.ProvidesDomains)
+	if err != nil {
+		log.Errorln("Failed to marshal ProvidesDomains:", err)
+		log.Debugln("SetNodeRecord LEAVE")
+		return err
+	}
+	consumes, err := json.Marshal(node.ConsumesDomains)
+	if err != nil {
+		log.Errorln("Failed to marshal ConsumesDomains:", err)
+		log.Debugln("SetNodeRecord LEAVE")
+		return err
+	}
+	failure := []byte("")
+	if node.Failure != nil {
+		failure, err = json.Marshal(node.Failure)
+		if err != nil {
+			log.Errorln("Failed to marshal Failure:", err)
+			log.Debugln("SetNodeRecord LEAVE")
+			return err
+		}
+	}
+	decommission := []byte("")
+	if node.Decommission != nil {
+		decommission, err = json.Marshal(node.Decommission)
+		if err != nil {
+			log.Errorln("Failed to marshal Decommission:", err)
+			log.Debugln("SetNodeRecord LEAVE")
+			return err
+		}
+	}
+
+	rootConfig := kv.RootKey + "/configuration"
+	kv.Store.Put(rootConfig, []byte(""), nil)
+	rootNode := rootConfig + "/" + node.Hostname
+	kv.Store.Put(rootNode, []byte(""), nil)
+
+	values := map[string]string{
+		"agentid":       node.AgentID,
+		"taskid":        node.TaskID,
+		"executorid":    node.ExecutorID,
+		"ipaddress":     node.IPAddress,
+		"imperative":    strconv.FormatBool(node.Imperative),
+		"advertised":    strconv.FormatBool(node.Advertised),
+		"maintenance":   strconv.FormatBool(node.Maintenance),
+		"previousstate": strconv.Itoa(node.PreviousState),
+		"statechanged":  strconv.FormatInt(node.StateChanged, 10),
+		"statereason":   node.StateReason,
+		"failure":       string(failure),
+		"decommission":  string(decommission),
+		"provides":      string(provides),
+		"consumes":      string(consumes),
+	}
+	for key, value := range values {
+		err := kv.Store.Put(rootNode+"/"+key, []byte(value), nil)
+		if err != nil {
+			log.Errorln("Failed to set", key, "on store:", err)
+			log.Debugln("SetNodeRecord LEAVE")
+			return err
+		}
+	}
+
+	err = kv.SetNodeLastContact(node.Hostname, node.LastContact)
+	if err != nil {
+		log.Errorln("Failed to set lastcontact on store:", err)
+		log.Debugln("SetNodeRecord LEAVE")
+		return err
+	}
+
+	err = kv.addToNodeList(node.Hostname)
+	if err != nil {
+		log.Errorln("Failed to add node to the node list:", err)
+		log.Debugln("SetNodeRecord LEAVE")
+		return err
+	}
+
+	log.Debugln("SetNodeRecord Succeeded")
+	log.Debugln("SetNodeRecord LEAVE")
+	return nil
+}
+
+//SetNodeLastContact saves the last time the node contacted the scheduler. It
+//is kept out of <root>/configuration since it changes on every ping and the
+//scheduler watches that tree for changes.
+func (kv *KvStore) SetNodeLastContact(nodeID string, lastContact int64) error {
+	if len(nodeID) == 0 {
+		return ErrInvalidKeyValue
+	}
+
+	rootContact := kv.RootKey + "/lastcontact"
+	kv.Store.Put(rootContact, []byte(""), nil)
+	return kv.Store.Put(rootContact+"/"+nodeID, []byte(strconv.FormatInt(lastContact, 10)), nil)
+}
+
+//getNodeLastContact returns the last time the node contacted the scheduler.
+//Older versions saved it with the node under <root>/configuration.
+func (kv *KvStore) getNodeLastContact(nodeID string) int64 {
+	value := kv.getNodeValue(kv.RootKey+"/lastcontact", nodeID)
+	if len(value) == 0 {
+		value = kv.getNodeValue(kv.RootKey+"/configuration/"+nodeID, "lastcontact")
+	}
+	lastContact, _ := strconv.ParseInt(value, 10, 64)
+	return lastContact
+}
+
+//GetNodeRecord restores a node previously saved by SetNodeInfo and SetNodeRecord
+func (kv *KvStore) GetNodeRecord(nodeID string) (*types.ScaleIONode, error) {
+	log.Debugln("GetNodeRecord ENTER")
+	log.Debugln("nodeID:", nodeID)
+
+	persona, state, err := kv.GetNodeInfo(nodeID)
+	if err != nil {
+		log.Errorln("GetNodeInfo err:", err)
+		log.Debugln("GetNodeRecord LEAVE")
+		return nil, err
+	}
+
+	rootNode := kv.RootKey + "/configuration/" + nodeID
+
+	executorID := kv.getNodeValue(rootNode, "executorid")
+	if len(executorID) == 0 {
+		log.Errorln("executorid is empty. Return error.")
+		log.Debugln("GetNodeRecord LEAVE")
+		return nil, ErrInvalidKeyValue
+	}
+
+	lastContact := kv.getNodeLastContact(nodeID)
+	previousState, _ := strconv.Atoi(kv.getNodeValue(rootNode, "previousstate"))
+	stateChanged, _ := strconv.ParseInt(kv.getNodeValue(rootNode, "statechanged"), 10, 64)
+
+	node := &types.ScaleIONode{
+		AgentID:         kv.getNodeValue(rootNode, "agentid"),
+		TaskID:          kv.getNodeValue(rootNode, "taskid"),
+		ExecutorID:      executorID,
+		IPAddress:       kv.getNodeValue(rootNode, "ipaddress"),
+		Hostname:        nodeID,
+		Persona:         persona,
+		State:           state,
+		PreviousState:   previousState,
+		StateChanged:    stateChanged,
+		StateReason:     kv.getNodeValue(rootNode, "statereason"),
+		LastContact:     lastContact,
+		Imperative:      kv.getNodeValue(rootNode, "imperative") == "true",
+		Advertised:      kv.getNodeValue(rootNode, "advertised") == "true",
+		Maintenance:     kv.getNodeValue(rootNode, "maintenance") == "true",
+		KeyValue:        make(map[string]string),
+		ProvidesDomains: make(map[string]*types.ProtectionDomain),
+		ConsumesDomains: make(map[string]*types.ProtectionDomain),
+	}
+
+	provides := kv.getNodeValue(rootNode, "provides")
+	if len(provides) > 0 {
+		err = json.Unmarshal([]byte(provides), &node.ProvidesDomains)
+		if err != nil {
+			log.Errorln("Failed to unmarshal ProvidesDomains:", err)
+			log.Debugln("GetNodeRecord LEAVE")
+			return nil, err
+		}
+	}
+	consumes := kv.getNodeValue(rootNode, "consumes")
+	if len(consumes) > 0 {
+		err = json.Unmarshal([]byte(consumes), &node.ConsumesDomains)
+		if err != nil {
+			log.Errorln("Failed to unmarshal ConsumesDomains:", err)
+			log.Debugln("GetNodeRecord LEAVE")
+			return nil, err
+		}
+	}
+
+	failure := kv.getNodeValue(rootNode, "failure")
+	if len(failure) > 0 {
+		node.Failure = &types.NodeFailure{}
+		err = json.Unmarshal([]byte(failure), node.Failure)
+		if err != nil {
+			log.Warnln("Ignoring invalid Failure:", err)
+			node.Failure = nil
+		}
+	}
+
+	decommission := kv.getNodeValue(rootNode, "decommission")
+	if len(decommission) > 0 {
+		node.Decommission = &types.NodeDecommission{}
+		err = json.Unmarshal([]byte(decommission), node.Decommission)
+		if err != nil {
+			log.Warnln("Ignoring invalid Decommission:", err)
+			node.Decommission = nil
+		}
+	}
+
+	log.Debugln("GetNodeRecord Succeeded")
+	log.Debugln("GetNodeRecord LEAVE")
+	return node, nil
+}
+
+//DeleteNode removes everything saved for a decommissioned node and marks the
+//host so it is not added to the cluster again
+func (kv *KvStore) DeleteNode(nodeID string) error {
+	log.Debugln("DeleteNode ENTER")
+	log.Debugln("nodeID:", nodeID)
+
+	if len(nodeID) == 0 {
+		log.Errorln("nodeID is empty. Return error.")
+		log.Debugln("DeleteNode LEAVE")
+		return ErrInvalidKeyValue
+	}
+
+	err := kv.removeFromNodeList(nodeID)
+	if err != nil {
+		log.Errorln("Failed to remove node from the node list:", err)
+		log.Debugln("DeleteNode LEAVE")
+		return err
+	}
+
+	err = kv.deleteTree(kv.RootKey + "/configuration/" + nodeID)
+	if err != nil {
+		log.Errorln("Failed to delete the node:", err)
+		log.Debugln("DeleteNode LEAVE")
+		return err
+	}
+	kv.Store.Delete(kv.RootKey + "/lastcontact/" + nodeID)
+
+	rootDecommissioned := kv.RootKey + "/decommissioned"
+	kv.Store.Put(rootDecommissioned, []byte(""), nil)
+	err = kv.Store.Put(rootDecommissioned+"/"+nodeID,
+		[]byte(strconv.FormatInt(time.Now().Unix(), 10)), nil)
+	if err != nil {
+		log.Errorln("Failed to mark the node decommissioned:", err)
+		log.Debugln("DeleteNode LEAVE")
+		return err
+	}
+
+	log.Debugln("DeleteNode Succeeded")
+	log.Debugln("DeleteNode LEAVE")
+	return nil
+}
+
+//IsDecommissioned returns true if the host was decommissioned
+func (kv *KvStore) IsDecommissioned(nodeID string) bool {
+	pair, err := kv.Store.Get(kv.RootKey + "/decommissioned/" + nodeID)
+	return err == nil && pair != nil
+}
+
+//GetNodeRecords restores all nodes previously saved by SetNodeRecord
+func (kv *KvStore) GetNodeRecords() ([]*types.ScaleIONode, error) {
+	log.Debugln("GetNodeRecords ENTER")
+
+	nodes := make([]*types.ScaleIONode, 0)
+	for _, nodeID := range kv.getNodeList() {
+		node, err := kv.GetNodeRecord(nodeID)
+		if err != nil {
+			log.Warnln("Unable to restore node", nodeID, ". Err:", err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+
+	log.Debugln("GetNodeRecords Succeeded. Nodes:", len(nodes))
+	log.Debugln("GetNodeRecords LEAVE")
+	return nodes, nil
+}
+
 //GetMetadata gets all domains/pools for a given node
 func (kv *KvStore) GetMetadata(nodeID string) (*Metadata, error) {
 	log.Debugln("GetMetadata LEAVE")
@@ -525,6 +1122,9 @@ func (kv *KvStore) GetMetadata(nodeID string) (*Metadata, error) {
 	//Domains
 	domainList := strings.Split(string(pairDomain.Value), ",")
 	for _, domain := range domainList {
+		if len(domain) == 0 {
+			continue
+		}
 
 		pd := new(ProtectionDomain)
 		pd.Name = domain
@@ -547,16 +1147,37 @@ func (kv *KvStore) GetMetadata(nodeID string) (*Metadata, error) {
 		}
 		log.Debugln(pairSds.Key, "=", string(pairSds.Value))
 
+		//each entry is name:mode:port:ip1;ip2. Entries written before the
+		//mode was saved only have the name.
 		sdsList := strings.Split(string(pairSds.Value), ",")
 		for index, sds := range sdsList {
+			if len(sds) == 0 {
+				continue
+			}
+			fields := strings.SplitN(sds, ":", 4)
 			s := new(Sds)
-			s.Name = sds
+			s.Name = fields[0]
 			if len(sdsList) == 1 {
 				s.Mode = SdsModeAll
 			} else {
 				s.Mode = index + 2
 			}
-			pd.Sdss[sds] = s
+			if len(fields) > 1 {
+				mode, err := strconv.Atoi(fields[1])
+				if err == nil {
+					s.Mode = mode
+				}
+			}
+			if len(fields) > 2 {
+				port, err := strconv.Atoi(fields[2])
+				if err == nil {
+					s.Port = port
+				}
+			}
+			if len(fields) > 3 && len(fields[3]) > 0 {
+				s.IPs = strings.Split(fields[3], ";")
+			}
+			pd.Sdss[s.Name] = s
 		}
 
 		//Pools
@@ -576,6 +1197,9 @@ func (kv *KvStore) GetMetadata(nodeID string) (*Metadata, error) {
 
 		poolList := strings.Split(string(pairPool.Value), ",")
 		for _, pool := range poolList {
+			if len(pool) == 0 {
+				continue
+			}
 
 			sp := new(StoragePool)
 			sp.Name = pool
@@ -597,11 +1221,20 @@ func (kv *KvStore) GetMetadata(nodeID string) (*Metadata, error) {
 			}
 			log.Debugln(pairDevice.Key, "=", string(pairDevice.Value))
 
+			//each entry is path@sds. The SDS is missing for devices saved
+			//before a node could run more than one SDS.
 			deviceList := strings.Split(string(pairDevice.Value), ",")
 			for _, device := range deviceList {
+				if len(device) == 0 {
+					continue
+				}
 				dev := new(Device)
 				dev.Name = device
-				sp.Devices[device] = dev
+				if pos := strings.LastIndex(device, "@"); pos != -1 {
+					dev.Name = device[:pos]
+					dev.Sds = device[pos+1:]
+				}
+				sp.Devices[dev.Name] = dev
 			}
 		}
 	}
@@ -635,7 +1268,7 @@ func (kv *KvStore) SetMetadata(nodeID string, metaData *Metadata) error {
 			domain.Delete = true
 		}
 
-		if domain.Delete {
+		if domain.IsRemoved() {
 			err := kv.deleteTree(domainNode)
 			if err == nil {
 				log.Debugln("DeleteTree", domainNode, "succeeded")
@@ -660,10 +1293,14 @@ func (kv *KvStore) SetMetadata(nodeID string, metaData *Metadata) error {
 		//Sds
 		sdsList := ""
 		for _, sds := range domain.Sdss {
+			if sds.IsRemoved() {
+				continue
+			}
 			if len(sdsList) > 0 {
 				sdsList += ","
 			}
-			sdsList += sds.Name
+			sdsList += sds.Name + ":" + strconv.Itoa(sds.Mode) + ":" + strconv.Itoa(sds.Port) +
+				":" + strings.Join(sds.IPs, ";")
 		}
 
 		sdsNode := domainNode + "/sdss"
@@ -684,7 +1321,7 @@ func (kv *KvStore) SetMetadata(nodeID string, metaData *Metadata) error {
 				pool.Delete = true
 			}
 
-			if pool.Delete {
+			if pool.IsRemoved() {
 				err := kv.Store.Delete(poolNode)
 				if err == nil {
 					log.Debugln("Delete", poolNode, "succeeded")
@@ -701,13 +1338,16 @@ func (kv *KvStore) SetMetadata(nodeID string, metaData *Metadata) error {
 
 			deviceList := ""
 			for _, device := range pool.Devices {
-				if device.Delete {
+				if device.IsRemoved() {
 					continue
 				}
 				if len(deviceList) > 0 {
 					deviceList += ","
 				}
 				deviceList += device.Name
+				if len(device.Sds) > 0 {
+					deviceList += "@" + device.Sds
+				}
 			}
 
 			errPool := kv.Store.Put(poolNode, []byte(deviceList), nil)
@@ -718,25 +1358,23 @@ func (kv *KvStore) SetMetadata(nodeID string, metaData *Metadata) error {
 			}
 		}
 
-		if len(poolList) > 0 {
-			poolsNode := domainNode + "/pools"
-			errPools := kv.Store.Put(poolsNode, []byte(poolList), nil)
-			if errPools == nil {
-				log.Debugln("Set", poolsNode, "=", poolList, "succeeded")
-			} else {
-				log.Errorln("Failed to set", poolsNode, ". Err:", errPools)
-			}
+		//written even when empty so removed pools are not restored
+		poolsNode := domainNode + "/pools"
+		errPools := kv.Store.Put(poolsNode, []byte(poolList), nil)
+		if errPools == nil {
+			log.Debugln("Set", poolsNode, "=", poolList, "succeeded")
+		} else {
+			log.Errorln("Failed to set", poolsNode, ". Err:", errPools)
 		}
 	}
 
-	if len(domainList) > 0 {
-		domainsNode := rootNode + "/domains"
-		errDomains := kv.Store.Put(domainsNode, []byte(domainList), nil)
-		if errDomains == nil {
-			log.Debugln("Set", domainsNode, "=", domainList, "succeeded")
-		} else {
-			log.Errorln("Failed to set", domainsNode, ". Err:", errDomains)
-		}
+	//written even when empty so removed domains are not restored
+	domainsNode := rootNode + "/domains"
+	errDomains := kv.Store.Put(domainsNode, []byte(domainList), nil)
+	if errDomains == nil {
+		log.Debugln("Set", domainsNode, "=", domainList, "succeeded")
+	} else {
+		log.Errorln("Failed to set", domainsNode, ". Err:", errDomains)
 	}
 
 	log.Debugln("SetMetadata Succeeded")
@@ -0,0 +1,182 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+/*
+Snapshot policies and volume tags in the KeyValue Store:
+
+scaleio-framework/<framework role>
+	/snapshots
+		/<policy name>
+			policy = <json of policy>
+			status = <json of last run>
+	/volumes
+		/<volume id>
+			tags = <json list of tags>
+*/
+
+func (kv *KvStore) snapshotKey(name string) string {
+	return kv.RootKey + "/snapshots/" + name
+}
+
+func (kv *KvStore) volumeKey(volumeID string) string {
+	return kv.RootKey + "/volumes/" + volumeID
+}
+
+//GetSnapshotPolicy returns a snapshot policy along with its last run
+func (kv *KvStore) GetSnapshotPolicy(name string) (*types.SnapshotPolicy, error) {
+	pair, err := kv.Store.Get(kv.snapshotKey(name) + "/policy")
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrInvalidKeyValue
+	}
+
+	policy := &types.SnapshotPolicy{}
+	err = json.Unmarshal(pair.Value, policy)
+	if err != nil {
+		log.Errorln("Failed to unmarshal snapshot policy", name, ":", err)
+		return nil, err
+	}
+
+	policy.Status = &types.SnapshotPolicyStatus{
+		Snapshots: make(map[string][]string),
+	}
+	pair, err = kv.Store.Get(kv.snapshotKey(name) + "/status")
+	if err == nil && pair != nil && len(pair.Value) > 0 {
+		err = json.Unmarshal(pair.Value, policy.Status)
+		if err != nil {
+			log.Warnln("Ignoring invalid status for snapshot policy", name, ":", err)
+		}
+	}
+
+	return policy, nil
+}
+
+//GetSnapshotPolicies returns all snapshot policies sorted by name
+func (kv *KvStore) GetSnapshotPolicies() ([]*types.SnapshotPolicy, error) {
+	log.Debugln("GetSnapshotPolicies ENTER")
+
+	policies := make([]*types.SnapshotPolicy, 0)
+
+	pairs, err := kv.Store.List(kv.RootKey + "/snapshots")
+	if err != nil {
+		//nothing has been saved yet
+		log.Debugln("GetSnapshotPolicies LEAVE")
+		return policies, nil
+	}
+
+	names := make([]string, 0)
+	for _, pair := range pairs {
+		names = append(names, pair.Key)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		policy, err := kv.GetSnapshotPolicy(name)
+		if err != nil {
+			log.Warnln("Unable to read snapshot policy", name, ". Err:", err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	log.Debugln("GetSnapshotPolicies Succeeded. Policies:", len(policies))
+	log.Debugln("GetSnapshotPolicies LEAVE")
+	return policies, nil
+}
+
+//SetSnapshotPolicy saves a snapshot policy. The status is saved separately by
+//SetSnapshotPolicyStatus.
+func (kv *KvStore) SetSnapshotPolicy(policy *types.SnapshotPolicy) error {
+	log.Debugln("SetSnapshotPolicy ENTER")
+
+	if policy == nil || len(policy.Name) == 0 {
+		log.Errorln("Policy or Name is empty. Return error.")
+		log.Debugln("SetSnapshotPolicy LEAVE")
+		return ErrInvalidKeyValue
+	}
+
+	tmp := *policy
+	tmp.Status = nil
+	value, err := json.Marshal(&tmp)
+	if err != nil {
+		log.Errorln("Failed to marshal snapshot policy:", err)
+		log.Debugln("SetSnapshotPolicy LEAVE")
+		return err
+	}
+
+	kv.Store.Put(kv.RootKey+"/snapshots", []byte(""), nil)
+	kv.Store.Put(kv.snapshotKey(policy.Name), []byte(""), nil)
+	err = kv.Store.Put(kv.snapshotKey(policy.Name)+"/policy", value, nil)
+	if err != nil {
+		log.Errorln("Failed to set snapshot policy on store:", err)
+		log.Debugln("SetSnapshotPolicy LEAVE")
+		return err
+	}
+
+	log.Debugln("SetSnapshotPolicy Succeeded")
+	log.Debugln("SetSnapshotPolicy LEAVE")
+	return nil
+}
+
+//SetSnapshotPolicyStatus saves the last run of a snapshot policy
+func (kv *KvStore) SetSnapshotPolicyStatus(name string, status *types.SnapshotPolicyStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		log.Errorln("Failed to marshal snapshot policy status:", err)
+		return err
+	}
+	return kv.Store.Put(kv.snapshotKey(name)+"/status", value, nil)
+}
+
+//DeleteSnapshotPolicy deletes a snapshot policy and its status
+func (kv *KvStore) DeleteSnapshotPolicy(name string) error {
+	return kv.Store.DeleteTree(kv.snapshotKey(name))
+}
+
+//GetVolumeTags returns the tags given to a volume through the REST API
+func (kv *KvStore) GetVolumeTags(volumeID string) []string {
+	tags := make([]string, 0)
+
+	pair, err := kv.Store.Get(kv.volumeKey(volumeID) + "/tags")
+	if err != nil || pair == nil {
+		return tags
+	}
+	err = json.Unmarshal(pair.Value, &tags)
+	if err != nil {
+		log.Warnln("Ignoring invalid tags for volume", volumeID, ":", err)
+		return make([]string, 0)
+	}
+	return tags
+}
+
+//SetVolumeTags saves the tags of a volume
+func (kv *KvStore) SetVolumeTags(volumeID string, tags []string) error {
+	if len(volumeID) == 0 {
+		return ErrInvalidKeyValue
+	}
+
+	value, err := json.Marshal(tags)
+	if err != nil {
+		log.Errorln("Failed to marshal volume tags:", err)
+		return err
+	}
+
+	kv.Store.Put(kv.RootKey+"/volumes", []byte(""), nil)
+	kv.Store.Put(kv.volumeKey(volumeID), []byte(""), nil)
+	return kv.Store.Put(kv.volumeKey(volumeID)+"/tags", value, nil)
+}
+
+//DeleteVolumeTags deletes the tags of a volume that was removed
+func (kv *KvStore) DeleteVolumeTags(volumeID string) error {
+	return kv.Store.DeleteTree(kv.volumeKey(volumeID))
+}
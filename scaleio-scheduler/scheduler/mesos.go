@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"fmt"
+	"net/url"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gogo/protobuf/proto"
@@ -12,17 +13,26 @@ import (
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
-func prepareExecutorInfo(cfg *config.Config, executorID string) *mesos.ExecutorInfo {
-	schedulerURI := fmt.Sprintf("http://%s:%d", cfg.RestAddress, cfg.RestPort)
+func prepareExecutorInfo(cfg *config.Config, executorID string, token string) *mesos.ExecutorInfo {
+	schedulerURI := cfg.RestURI()
 	log.Infoln("Scheduler URI:", schedulerURI)
-	uri := fmt.Sprintf("%s/scaleio-executor", schedulerURI)
+	uri := fmt.Sprintf("%s%s/scaleio-executor", schedulerURI, types.APIPrefix)
 	log.Infoln("Executor URI:", uri)
 
+	//the fetcher cant set headers so the credentials go in the query
+	fetchURI := fmt.Sprintf("%s?executor=%s&token=%s", uri, url.QueryEscape(executorID), token)
+
 	executorUris := []*mesos.CommandInfo_URI{}
-	executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: &uri, Executable: proto.Bool(true)})
+	executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: &fetchURI, Executable: proto.Bool(true)})
 	executorCommand := fmt.Sprintf(
 		"chmod u+x scaleio-executor && ./scaleio-executor -loglevel=%s -rest.uri=%s",
 		cfg.LogLevel, schedulerURI)
+	if len(cfg.ExecutorTLSCAFile) > 0 {
+		executorCommand += fmt.Sprintf(" -rest.tls.cafile=%s", cfg.ExecutorTLSCAFile)
+	}
+	if cfg.ExecutorTLSInsecure {
+		executorCommand += " -rest.tls.insecure=true"
+	}
 
 	// Create mesos scheduler driver.
 	return &mesos.ExecutorInfo{
@@ -31,6 +41,14 @@ func prepareExecutorInfo(cfg *config.Config, executorID string) *mesos.ExecutorI
 		Command: &mesos.CommandInfo{
 			Value: proto.String(executorCommand), //command to run on agent
 			Uris:  executorUris,                  //URI to download
+			Environment: &mesos.Environment{
+				Variables: []*mesos.Environment_Variable{
+					&mesos.Environment_Variable{
+						Name:  proto.String(types.ExecutorTokenEnv),
+						Value: proto.String(token),
+					},
+				},
+			},
 		},
 	}
 }
@@ -60,7 +78,24 @@ func generateAcknowledgeCall(ID *mesos.FrameworkInfo, update *mesos.TaskStatus)
 	return message
 }
 
-func generateAcceptCall(cfg *config.Config, offer *mesos.Offer, node *types.ScaleIONode) *sched.Call {
+func generateKillCall(ID *mesos.FrameworkInfo, node *types.ScaleIONode) *sched.Call {
+	message := &sched.Call{
+		FrameworkId: ID.GetId(),
+		Type:        sched.Call_KILL.Enum(),
+		Kill: &sched.Call_Kill{
+			TaskId:  &mesos.TaskID{Value: proto.String(node.TaskID)},
+			AgentId: &mesos.AgentID{Value: proto.String(node.AgentID)},
+		},
+	}
+
+	log.Infoln("Call:")
+	log.Infoln(message.String())
+
+	return message
+}
+
+func generateAcceptCall(cfg *config.Config, offer *mesos.Offer, node *types.ScaleIONode,
+	token string) *sched.Call {
 	//offer ids
 	var offerIDs []*mesos.OfferID
 
@@ -93,7 +128,7 @@ func generateAcceptCall(cfg *config.Config, offer *mesos.Offer, node *types.Scal
 		Name:     proto.String("task-" + node.TaskID),
 		TaskId:   taskID,
 		AgentId:  offer.GetAgentId(),
-		Executor: prepareExecutorInfo(cfg, node.ExecutorID),
+		Executor: prepareExecutorInfo(cfg, node.ExecutorID, token),
 		Resources: []*mesos.Resource{
 			&mesos.Resource{
 				Name:   proto.String("cpus"),
@@ -110,8 +145,9 @@ func generateAcceptCall(cfg *config.Config, offer *mesos.Offer, node *types.Scal
 
 	tasks = append(tasks, task)
 
-	log.Infoln("Task:")
-	log.Infoln(task.String())
+	//the task contains the executor token
+	log.Debugln("Task:")
+	log.Debugln(task.String())
 
 	//create operations
 	var operations []*mesos.Offer_Operation
@@ -125,8 +161,8 @@ func generateAcceptCall(cfg *config.Config, offer *mesos.Offer, node *types.Scal
 
 	operations = append(operations, operation)
 
-	log.Infoln("Operation:")
-	log.Infoln(operation.String())
+	log.Debugln("Operation:")
+	log.Debugln(operation.String())
 
 	//launch the task
 	message := &sched.Call{
@@ -139,8 +175,8 @@ func generateAcceptCall(cfg *config.Config, offer *mesos.Offer, node *types.Scal
 		},
 	}
 
-	log.Infoln("Call:")
-	log.Infoln(message.String())
+	log.Debugln("Call:")
+	log.Debugln(message.String())
 
 	return message
 }
@@ -69,6 +69,9 @@ func prepareScaleIONode(store *kvstore.KvStore, offer *mesos.Offer) (*types.Scal
 		LastContact: 0,
 		Imperative:  false,
 		Advertised:  false,
+
+		ProvidesDomains: make(map[string]*types.ProtectionDomain),
+		ConsumesDomains: make(map[string]*types.ProtectionDomain),
 	}
 
 	keys := []string{
@@ -79,6 +82,12 @@ func prepareScaleIONode(store *kvstore.KvStore, offer *mesos.Offer) (*types.Scal
 		appendServerPrefix,
 		appendClientPrefix,
 	}
+	//the SDS attributes are the storage a node provides and the SDC
+	//attributes the storage it consumes
+	domains := []map[string]*types.ProtectionDomain{
+		node.ProvidesDomains,
+		node.ConsumesDomains,
+	}
 
 	for i := 0; i < 2; i++ {
 		value, err := getAttributeByKey(offer.GetAttributes(), keys[i])
@@ -93,16 +102,13 @@ func prepareScaleIONode(store *kvstore.KvStore, offer *mesos.Offer) (*types.Scal
 		fsDomains := strings.Split(value, ",")
 		for _, fsDomain := range fsDomains {
 
-			if node.ProvidesDomains == nil {
-				node.ProvidesDomains = make(map[string]*types.ProtectionDomain)
-			}
-			if node.ProvidesDomains[fsDomain] == nil {
-				node.ProvidesDomains[fsDomain] = &types.ProtectionDomain{
+			if domains[i][fsDomain] == nil {
+				domains[i][fsDomain] = &types.ProtectionDomain{
 					Name:     fsDomain,
 					KeyValue: make(map[string]string),
 				}
 			}
-			nDomain := node.ProvidesDomains[fsDomain]
+			nDomain := domains[i][fsDomain]
 
 			poolsStr, err := getAttributeByKey(offer.GetAttributes(), fixprefix[i](fsDomain))
 			if err != nil {
@@ -156,11 +162,21 @@ func (s *ScaleIOScheduler) addScaleIONode(offer *mesos.Offer) error {
 		return err
 	}
 
+	s.Server.Lock()
+	//the topology declared through the REST API wins over agent attributes
+	s.Server.ApplyTopology(node)
 	if node.Imperative {
 		log.Infoln("At least one node declared by Imperative method.")
 		s.Server.State.ScaleIO.AtLeastOneImperative = true
 	}
-
 	s.Server.State.ScaleIO.Nodes = append(s.Server.State.ScaleIO.Nodes, node)
+	s.Server.PublishNode(types.DeltaPersonaAssigned, node)
+	s.Server.Unlock()
+
+	err = s.Store.SetNodeRecord(node)
+	if err != nil {
+		log.Warnln("Failed to save node", node.Hostname, "to the store:", err)
+	}
+
 	return nil
 }
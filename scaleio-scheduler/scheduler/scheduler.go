@@ -18,6 +18,7 @@ import (
 	mesos "github.com/codedellemc/scaleio-framework/scaleio-scheduler/mesos/v1"
 	kvstore "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/kvstore"
 	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/server"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
 const (
@@ -49,9 +50,11 @@ func NewScaleIOScheduler(cfg *config.Config) *ScaleIOScheduler {
 
 	if cfg.DeleteKeyValues {
 		myStore.DeleteStore()
+		myStore.Close()
 		return nil
 	} else if cfg.DumpKeyValues {
 		myStore.DumpStore()
+		myStore.Close()
 		return nil
 	} else if len(cfg.StoreAddKey) > 0 {
 		err := myStore.UserKeyValue(cfg.StoreAddKey, cfg.StoreAddVal)
@@ -60,6 +63,7 @@ func NewScaleIOScheduler(cfg *config.Config) *ScaleIOScheduler {
 		} else {
 			log.Errorln("UserKeyValue Failed. Err:", err)
 		}
+		myStore.Close()
 		return nil
 	} else if len(cfg.StoreDelKey) > 0 {
 		err := myStore.UserDeleteKey(cfg.StoreDelKey)
@@ -68,10 +72,11 @@ func NewScaleIOScheduler(cfg *config.Config) *ScaleIOScheduler {
 		} else {
 			log.Errorln("UserDeleteKey Failed. Err:", err)
 		}
+		myStore.Close()
 		return nil
 	}
 
-	return &ScaleIOScheduler{
+	scheduler := &ScaleIOScheduler{
 		Config:    cfg,
 		Store:     myStore,
 		Client:    client.New(cfg.MasterREST, "/api/v1/scheduler"),
@@ -80,6 +85,23 @@ func NewScaleIOScheduler(cfg *config.Config) *ScaleIOScheduler {
 		Events:    make(chan *sched.Event),
 		DoneChan:  make(chan struct{}),
 	}
+
+	//the REST server kills the task of a decommissioned node
+	scheduler.Server.Lock()
+	scheduler.Server.KillTask = scheduler.killTask
+	scheduler.Server.Unlock()
+
+	return scheduler
+}
+
+//killTask asks Mesos to kill the task running the executor of a node
+func (s *ScaleIOScheduler) killTask(node *types.ScaleIONode) {
+	log.Infoln("Killing task", node.TaskID, "on", node.Hostname)
+	message := generateKillCall(s.Framework, node)
+	_, err := s.send(message)
+	if err != nil {
+		log.Errorln("Failed to kill task", node.TaskID, ":", err)
+	}
 }
 
 //Start starts the scheduler and subscribes to event stream
@@ -31,15 +31,23 @@ Metadata structure in the KeyValue Store:
 
 scaleio-framework/<framework role>
 	version = 1
+	nodelist = 10.0.0.10,10.0.0.11,10.0.0.12,10.0.0.13
 	/configuration
 		configured = true
 		primary = "10.0.0.10"
 		secondary = "10.0.0.11"
 		tiebreaker = "10.0.0.12"
-	/nodes
 		/10.0.0.10
 			persona = 1
 			state = 2, 3, etc
+			agentid = <mesos agent id>
+			taskid = <mesos task id>
+			executorid = <mesos executor id>
+			ipaddress = 10.0.0.10
+			imperative = true|false
+			advertised = true|false
+			provides = <json of provided domains>
+			consumes = <json of consumed domains>
 			/domains
 				sdss = 10.0.0.10_sds1,10.0.0.10_sds2
 				domains = domain1,domain2
@@ -65,6 +73,9 @@ scaleio-framework/<framework role>
 			state = 2, 3, etc
 			/domains
 				...
+	/lastcontact
+		10.0.0.10 = <unix time>
+		...
 */
 
 var (
@@ -154,6 +165,8 @@ func (s *ScaleIOScheduler) selectAnMdmNode(offers []*mesos.Offer, nodeID string,
 			log.Debugln("Failed to set ", common.PersonaIDToString(mdmType), " MDM metadata:", err)
 			return err
 		}
+		s.Server.RecordEvent(types.EventPersonaAssigned, offer.GetHostname(),
+			"Persona set to "+common.PersonaIDToString(mdmType)+" (manually selected)")
 		s.addScaleIONode(offer)
 	} else {
 		log.Debugln(common.PersonaIDToString(mdmType), "MDM needs to be automatically selected")
@@ -169,6 +182,8 @@ func (s *ScaleIOScheduler) selectAnMdmNode(offers []*mesos.Offer, nodeID string,
 			log.Debugln("Failed to set ", common.PersonaIDToString(mdmType), " MDM metadata:", err)
 			return err
 		}
+		s.Server.RecordEvent(types.EventPersonaAssigned, offer.GetHostname(),
+			"Persona set to "+common.PersonaIDToString(mdmType)+" (automatically selected)")
 		s.addScaleIONode(offer)
 	}
 
@@ -183,6 +198,8 @@ func (s *ScaleIOScheduler) selectDataNode(offer *mesos.Offer) error {
 			log.Debugln("Failed to set data node metadata:", err)
 			return err
 		}
+		s.Server.RecordEvent(types.EventPersonaAssigned, offer.GetHostname(),
+			"Persona set to "+common.PersonaIDToString(types.PersonaNode))
 	}
 	s.addScaleIONode(offer)
 
@@ -238,6 +255,10 @@ func (s *ScaleIOScheduler) performNodeSelection(offers []*mesos.Offer) error {
 			log.Debugln("Node", offer.GetHostname(), "already has a persona")
 			continue
 		}
+		if s.Store.IsDecommissioned(offer.GetHostname()) {
+			log.Debugln("Node", offer.GetHostname(), "was decommissioned")
+			continue
+		}
 
 		log.Debugln("Node", offer.GetHostname(), "persona being set to DataNode")
 		err := s.selectDataNode(offer)
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//isAwsConfigured is true when the scheduler can expand StoragePools in AWS
+func (s *RestServer) isAwsConfigured() bool {
+	return len(s.Config.AccessKey) > 0 && len(s.Config.SecretKey) > 0
+}
+
+func resetNode(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	hostname := mux.Vars(r)["hostname"]
+
+	server.Lock()
+	node := common.FindScaleIONodeByHostname(server.State.ScaleIO.Nodes, hostname)
+	if node == nil {
+		server.Unlock()
+		writeError(w, "Unable to find the Node", http.StatusNotFound)
+		return
+	}
+	if node.Decommission != nil {
+		server.Unlock()
+		writeError(w, "The node is being decommissioned", http.StatusConflict)
+		return
+	}
+	if node.State != types.StateFatalInstall {
+		state := node.State
+		server.Unlock()
+		writeError(w, "Only a node in state "+common.StateIDToString(types.StateFatalInstall)+
+			" can be reset. The node is in state "+common.StateIDToString(state), http.StatusConflict)
+		return
+	}
+
+	//start the install over
+	err := server.resetNodeState(node, "Reset by an operator")
+	info := server.newNodeInfo(node)
+	server.Unlock()
+
+	if err != nil {
+		writeError(w, "SetNodeInfo Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func setNodeMaintenance(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	hostname := mux.Vars(r)["hostname"]
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	maintenance := &types.NodeMaintenance{}
+	if err := json.Unmarshal(body, &maintenance); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	server.Lock()
+	node := common.FindScaleIONodeByHostname(server.State.ScaleIO.Nodes, hostname)
+	if node == nil {
+		server.Unlock()
+		writeError(w, "Unable to find the Node", http.StatusNotFound)
+		return
+	}
+
+	changed := node.Maintenance != maintenance.Maintenance
+	node.Maintenance = maintenance.Maintenance
+	if changed {
+		err = server.Store.SetNodeRecord(node)
+		server.PublishNode(types.DeltaNodeMaintenance, node)
+	}
+	server.Unlock()
+
+	if err != nil {
+		writeError(w, "SetNodeRecord Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if changed && maintenance.Maintenance {
+		server.RecordEvent(types.EventMaintenanceChanged, hostname, "Node put in maintenance")
+	} else if changed {
+		server.RecordEvent(types.EventMaintenanceChanged, hostname, "Node taken out of maintenance")
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(maintenance); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func expandStoragePools(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	if !server.isAwsConfigured() {
+		writeError(w, "Expanding StoragePools requires the AWS access and secret keys", http.StatusBadRequest)
+		return
+	}
+
+	server.Lock()
+	imperative := server.State.ScaleIO.AtLeastOneImperative
+	if !imperative {
+		//picked up by MonitorForState on the next pass
+		server.expandRequested = true
+	}
+	server.Unlock()
+
+	if imperative {
+		writeError(w, "StoragePools can not be expanded when a node has imperative devices",
+			http.StatusConflict)
+		return
+	}
+
+	server.RecordEvent(types.EventExpandRequested, "", "Expand of all StoragePools requested by an operator")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(server.Metrics.Pools()); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func getCapacity(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	capacity := &types.Capacity{
+		CapacityKb:    server.State.ScaleIO.CapacityData,
+		UsedKb:        server.State.ScaleIO.UsedData,
+		FakeUsedKb:    server.State.ScaleIO.FakeUsedData,
+		UsedThreshold: server.Config.UsedThreshold,
+	}
+	server.Unlock()
+	capacity.Pools = server.Metrics.Pools()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(capacity); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//scopePublic requires no credentials
+	scopePublic = iota
+
+	//scopeExecutor requires the token of an executor or an admin token
+	scopeExecutor
+
+	//scopeRead requires a read or admin token, or the token of an executor.
+	//open when no operator tokens are configured.
+	scopeRead
+
+	//scopeAdmin requires an admin token. closed to everyone when no admin
+	//token is configured.
+	scopeAdmin
+)
+
+type authKey int
+
+const (
+	authExecutorID authKey = iota
+	authAdmin
+)
+
+func isTokenEqual(expected string, token string) bool {
+	if len(expected) == 0 || len(token) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+//requestCredentials returns the executor ID and token on the request. The
+//query string is used for the executor download where the Mesos fetcher
+//cannot set headers.
+func requestCredentials(r *http.Request) (string, string) {
+	executorID := r.Header.Get(types.ExecutorIDHeader)
+	if len(executorID) == 0 {
+		executorID = r.URL.Query().Get("executor")
+	}
+	token := bearerToken(r)
+	if len(token) == 0 {
+		token = r.URL.Query().Get("token")
+	}
+	return executorID, token
+}
+
+//authorize wraps a handler so it is only called with valid credentials for
+//the given scope
+func (s *RestServer) authorize(scope int, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		executorID, token := requestCredentials(r)
+		isAdmin := isTokenEqual(s.Config.RestAdminToken, token)
+		isExecutor := s.isValidExecutorToken(executorID, token)
+
+		allowed := false
+		switch scope {
+		case scopePublic:
+			allowed = true
+		case scopeExecutor:
+			allowed = isAdmin || isExecutor
+		case scopeRead:
+			allowed = isAdmin || isExecutor || isTokenEqual(s.Config.RestReadToken, token) ||
+				(len(s.Config.RestReadToken) == 0 && len(s.Config.RestAdminToken) == 0)
+		case scopeAdmin:
+			allowed = isAdmin
+		}
+
+		if !allowed {
+			log.Warnln("Rejected", r.Method, r.URL.Path, "from", r.RemoteAddr)
+			writeError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		if isExecutor {
+			ctx = context.WithValue(ctx, authExecutorID, executorID)
+		}
+		if isAdmin {
+			ctx = context.WithValue(ctx, authAdmin, true)
+		}
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+//isCallerExecutor verifies the executor named in a request body is the one
+//that authenticated. Admins may act on behalf of any executor.
+func isCallerExecutor(r *http.Request, executorID string) bool {
+	if isAdmin, ok := r.Context().Value(authAdmin).(bool); ok && isAdmin {
+		return true
+	}
+	caller, ok := r.Context().Value(authExecutorID).(string)
+	return ok && caller == executorID
+}
@@ -162,7 +162,9 @@ func (s *RestServer) getInstanceList(client *ec2.EC2) ([]*pairHost, error) {
 			fmt.Println(*instance.PrivateDnsName)
 			fmt.Println(*instance.PublicDnsName)
 			node := s.findAwsInstanceInScaleIONode(instance)
-			if node != nil {
+			if node != nil && node.Maintenance {
+				log.Infoln("Node", node.Hostname, "is in maintenance. Skip!")
+			} else if node != nil {
 				hostList = append(hostList, &pairHost{
 					Ec2Instance: instance,
 					ScaleIONode: node,
@@ -322,7 +324,9 @@ func (s *RestServer) findAwsInstanceInScaleIONode(inst *ec2.Instance) *types.Sca
 	return nil
 }
 
-func (s *RestServer) checkForFull(state *types.ScaleIOFramework) (*pairDomainPool, error) {
+//checkForFull returns the StoragePools over the threshold or all of them when
+//an expand is forced
+func (s *RestServer) checkForFull(state *types.ScaleIOFramework, force bool) (*pairDomainPool, error) {
 	log.Infoln("checkForFull ENTER")
 
 	client, errClient := s.createScaleioClient(state)
@@ -335,6 +339,7 @@ func (s *RestServer) checkForFull(state *types.ScaleIOFramework) (*pairDomainPoo
 	system, errSystem := client.FindSystem(s.State.ScaleIO.ClusterID, s.State.ScaleIO.ClusterName, "")
 	if errSystem != nil {
 		log.Errorln("FindSystem Error:", errSystem)
+		s.Metrics.ScaleIOError("FindSystem")
 		log.Infoln("checkForFull LEAVE")
 		return nil, errSystem
 	}
@@ -342,6 +347,7 @@ func (s *RestServer) checkForFull(state *types.ScaleIOFramework) (*pairDomainPoo
 	tmpDomain, errDomain := system.FindProtectionDomain("", s.Config.ProtectionDomain, "")
 	if errDomain != nil {
 		log.Errorln("FindProtectionDomain Error:", errDomain)
+		s.Metrics.ScaleIOError("FindProtectionDomain")
 		log.Infoln("checkForFull LEAVE")
 		return nil, errDomain
 	}
@@ -352,6 +358,7 @@ func (s *RestServer) checkForFull(state *types.ScaleIOFramework) (*pairDomainPoo
 	storagePools, errPools := scaleioDomain.GetStoragePool("")
 	if errPools != nil {
 		log.Errorln("GetStoragePool Error:", errPools)
+		s.Metrics.ScaleIOError("GetStoragePool")
 		log.Infoln("checkForFull LEAVE")
 		return nil, errPools
 	}
@@ -368,12 +375,22 @@ func (s *RestServer) checkForFull(state *types.ScaleIOFramework) (*pairDomainPoo
 		stats, errStats := scaleioPool.GetStatistics()
 		if errStats != nil {
 			log.Warnln("GetStatistics Error:", errStats)
+			s.Metrics.ScaleIOError("GetStatistics")
 			continue
 		}
 
+		s.Metrics.PoolUsage(tmpDomain.Name, scaleioPool.StoragePool.Name,
+			uint64(stats.CapacityLimitInKb), uint64(stats.CapacityInUseInKb))
+
+		s.Lock()
 		fakeUsedData := s.State.ScaleIO.FakeUsedData
-		s.State.ScaleIO.CapacityData = stats.CapacityLimitInKb
-		s.State.ScaleIO.UsedData = stats.CapacityInUseInKb
+		if s.State.ScaleIO.CapacityData != stats.CapacityLimitInKb ||
+			s.State.ScaleIO.UsedData != stats.CapacityInUseInKb {
+			s.State.ScaleIO.CapacityData = stats.CapacityLimitInKb
+			s.State.ScaleIO.UsedData = stats.CapacityInUseInKb
+			s.Touch()
+		}
+		s.Unlock()
 		log.Infoln("Fake Used Data:", s.State.ScaleIO.FakeUsedData)
 		log.Infoln("Capacity:", s.State.ScaleIO.CapacityData)
 		log.Infoln("Actual Used Data:", s.State.ScaleIO.UsedData)
@@ -382,9 +399,10 @@ func (s *RestServer) checkForFull(state *types.ScaleIOFramework) (*pairDomainPoo
 		if stats.CapacityLimitInKb == 0 {
 			usedSpacePercent = 0
 		}
-		if usedSpacePercent > s.Config.UsedThreshold {
+		if force || usedSpacePercent > s.Config.UsedThreshold {
 			log.Infoln("Storage Pool Needs Expanding:", scaleioPool.StoragePool.Name,
-				"Percent Used:", usedSpacePercent, "Threshold:", s.Config.UsedThreshold)
+				"Percent Used:", usedSpacePercent, "Threshold:", s.Config.UsedThreshold,
+				"Forced:", force)
 			poolsNeedExpanding.Pools = append(poolsNeedExpanding.Pools, scaleioPool)
 		} else {
 			log.Infoln("Storage Pool:", scaleioPool.StoragePool.Name,
@@ -459,6 +477,7 @@ func getNextDevicePath(metaData *kvstore.Metadata, node *types.ScaleIONode) stri
 	log.Debugln("Creating new Device:", newDevPath)
 	metaData.ProtectionDomains[lastDomain.Name].Pools[lastDomain.Name].Devices[newDevPath] = &kvstore.Device{
 		Name: newDevPath,
+		Sds:  lastDomain.SdsForDevice(node.IPAddress, newDevPath),
 		Add:  true,
 	}
 
@@ -494,16 +513,21 @@ func (s *RestServer) expandPools(pools *pairDomainPool) error {
 		errCreate := createVolume(client, awsInfo, pairHost, s.Config.VolumeGrowthSize)
 		if errCreate != nil {
 			log.Errorln("createVolume Error:", errCreate)
+		} else {
+			s.Metrics.VolumeCreated()
 		}
 	}
 
 	//Attach Device on all hosts
 	for _, pool := range pools.Pools {
 		for _, pairHost := range pairHosts {
-			sdsID := "sds_" + pairHost.ScaleIONode.IPAddress
+			//new devices go to the first SDS of the node in the ProtectionDomain
+			domain := pairHost.ScaleIONode.ProvidesDomains[pools.Domain.ProtectionDomain.Name]
+			sdsID := domain.SdsForDevice(pairHost.ScaleIONode.IPAddress, "")
 			tmpSds, errSds := pools.Domain.FindSds("Name", sdsID)
 			if errSds != nil {
 				log.Errorln("Unable to find SDS:", sdsID)
+				s.Metrics.ScaleIOError("FindSds")
 				continue
 			}
 
@@ -517,6 +541,8 @@ func (s *RestServer) expandPools(pools *pairDomainPool) error {
 
 			_, errAttach := pool.AttachDevice(newDevice, tmpSds.ID)
 			if errAttach == nil {
+				s.RecordEvent(types.EventVolumeCreated, pairHost.ScaleIONode.Hostname,
+					"AWS volume "+newDevice+" attached to StoragePool "+pool.StoragePool.Name)
 				//Save updated metadata
 				err = s.Store.SetMetadata(pairHost.ScaleIONode.Hostname, metaData)
 				if err == nil {
@@ -526,6 +552,7 @@ func (s *RestServer) expandPools(pools *pairDomainPool) error {
 				}
 			} else {
 				log.Errorln("AttachDevice Error:", errAttach)
+				s.Metrics.ScaleIOError("AttachDevice")
 			}
 		}
 	}
@@ -536,13 +563,13 @@ func (s *RestServer) expandPools(pools *pairDomainPool) error {
 
 func setFakeData(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	if !server.Config.Debug {
-		http.Error(w, "This API is available only in debug mode.", http.StatusBadRequest)
+		writeError(w, "This API is available only in debug mode.", http.StatusBadRequest)
 		return
 	}
 
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 	if err != nil {
-		http.Error(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
 		return
 	}
 	if err := r.Body.Close(); err != nil {
@@ -554,13 +581,14 @@ func setFakeData(w http.ResponseWriter, r *http.Request, server *RestServer) {
 		FakeUsedData: 0,
 	}
 	if err := json.Unmarshal(body, &state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 		return
 	}
 
 	//update the object
 	server.Lock()
 	server.State.ScaleIO.FakeUsedData = state.FakeUsedData
+	server.Touch()
 	server.Unlock()
 
 	//acknowledged the state change
@@ -569,6 +597,6 @@ func setFakeData(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 	}
 }
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
+	siotypes "github.com/codedellemc/goscaleio/types/v1"
+	"github.com/gorilla/mux"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//saveDecommission saves the progress of a decommission. The caller must hold
+//the lock.
+func (s *RestServer) saveDecommission(node *types.ScaleIONode) {
+	if err := s.Store.SetNodeRecord(node); err != nil {
+		log.Warnln("Failed to save the decommission of", node.Hostname, ":", err)
+	}
+	s.Touch()
+}
+
+//decommissionFailed remembers why the decommission of a node can't continue.
+//It is tried again on the next pass.
+func (s *RestServer) decommissionFailed(hostname string, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	node := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, hostname)
+	if node == nil || node.Decommission == nil {
+		return
+	}
+	if node.Decommission.Error == err.Error() {
+		return
+	}
+	node.Decommission.Error = err.Error()
+	s.saveDecommission(node)
+	s.RecordEvent(types.EventDecommission, hostname, "Decommission failed: "+err.Error())
+}
+
+//findProtectionDomain looks up a ProtectionDomain by name. It is only gone
+//when ScaleIO lists the ProtectionDomains without it.
+func (s *RestServer) findProtectionDomain(system *goscaleio.System,
+	name string) (*siotypes.ProtectionDomain, bool, error) {
+	domains, err := system.GetProtectionDomain("")
+	if err != nil {
+		log.Errorln("GetProtectionDomain Error:", err)
+		s.Metrics.ScaleIOError("GetProtectionDomain")
+		return nil, false, err
+	}
+	for _, domain := range domains {
+		if domain.Name == name {
+			return domain, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+//findSds looks up an SDS of the ProtectionDomain by name. It is only gone
+//when ScaleIO lists the SDSs without it.
+func (s *RestServer) findSds(scaleioDomain *goscaleio.ProtectionDomain, name string) (*siotypes.Sds, bool, error) {
+	sdss, err := scaleioDomain.GetSds()
+	if err != nil {
+		log.Errorln("GetSds Error:", err)
+		s.Metrics.ScaleIOError("GetSds")
+		return nil, false, err
+	}
+	for i := range sdss {
+		if sdss[i].Name == name {
+			return &sdss[i], true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+//removeSdss asks ScaleIO to remove the SDSs on the node. ScaleIO migrates the
+//data to the other SDSs before the SDS goes away. Returns true once the SDSs
+//are gone and the data has been rebuilt.
+func (s *RestServer) removeSdss(node *types.ScaleIONode) (bool, error) {
+	session, err := s.openScaleIO()
+	if err != nil {
+		return false, err
+	}
+
+	metaData, err := s.Store.GetMetadata(node.Hostname)
+	if err != nil {
+		log.Debugln("No metadata for node", node.Hostname)
+		return s.checkClusterHealth()
+	}
+
+	remaining := false
+	for _, domain := range metaData.ProtectionDomains {
+		tmpDomain, found, err := s.findProtectionDomain(session.system, domain.Name)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			log.Debugln("ProtectionDomain", domain.Name, "is gone")
+			continue
+		}
+		scaleioDomain := goscaleio.NewProtectionDomainEx(session.client, tmpDomain)
+
+		for _, sds := range domain.Sdss {
+			tmpSds, found, err := s.findSds(scaleioDomain, sds.Name)
+			if err != nil {
+				return false, err
+			}
+			if !found {
+				log.Debugln("SDS", sds.Name, "is gone")
+				continue
+			}
+			remaining = true
+
+			if doesNeedleExist(node.Decommission.Removing, tmpSds.ID) {
+				log.Infoln("SDS", sds.Name, "is still migrating its data")
+				continue
+			}
+
+			err = s.scaleioAction(session.client, "Sds::"+tmpSds.ID, "removeSds")
+			if err != nil {
+				return false, err
+			}
+			log.Infoln("SDS", sds.Name, "is being removed")
+			s.RecordEvent(types.EventDecommission, node.Hostname,
+				"SDS "+sds.Name+" is being removed from ProtectionDomain "+domain.Name)
+
+			s.Lock()
+			realNode := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, node.Hostname)
+			if realNode != nil && realNode.Decommission != nil {
+				realNode.Decommission.Removing = append(realNode.Decommission.Removing, tmpSds.ID)
+				s.saveDecommission(realNode)
+			}
+			s.Unlock()
+		}
+	}
+	if remaining {
+		return false, nil
+	}
+
+	return s.checkClusterHealth()
+}
+
+//unmapVolumes unmaps every volume mapped to the SDC on the node
+func (s *RestServer) unmapVolumes(node *types.ScaleIONode) error {
+	session, err := s.openScaleIO()
+	if err != nil {
+		return err
+	}
+
+	sdc, err := s.findSdc(session, node.Hostname)
+	if err != nil {
+		log.Infoln("No SDC on node", node.Hostname, ". Nothing to unmap.")
+		return nil
+	}
+
+	volumes, err := session.client.GetVolume("", "", "", "", true)
+	if err != nil {
+		log.Errorln("GetVolume Error:", err)
+		s.Metrics.ScaleIOError("GetVolume")
+		return err
+	}
+
+	for _, volume := range volumes {
+		for _, mapped := range volume.MappedSdcInfo {
+			if mapped.SdcID != sdc.Sdc.ID {
+				continue
+			}
+
+			scaleioVolume := goscaleio.NewVolume(session.client)
+			scaleioVolume.Volume = volume
+			err = scaleioVolume.UnmapVolumeSdc(&siotypes.UnmapVolumeSdcParam{
+				SdcID: sdc.Sdc.ID,
+			})
+			if err != nil {
+				log.Errorln("UnmapVolumeSdc Error:", err)
+				s.Metrics.ScaleIOError("UnmapVolumeSdc")
+				return err
+			}
+			log.Infoln("Volume", volume.Name, "unmapped from", node.Hostname)
+			s.RecordEvent(types.EventVolumeUpdated, node.Hostname, "Volume "+volume.Name+" unmapped")
+		}
+	}
+
+	return nil
+}
+
+//removeNode forgets a node once the executor removed the packages. The SDC is
+//removed from ScaleIO when it is still known and the task is killed.
+func (s *RestServer) removeNode(node *types.ScaleIONode) {
+	session, err := s.openScaleIO()
+	if err == nil {
+		sdc, err := s.findSdc(session, node.Hostname)
+		if err == nil {
+			err = s.scaleioAction(session.client, "Sdc::"+sdc.Sdc.ID, "removeSdc")
+			if err != nil {
+				log.Warnln("Failed to remove the SDC on", node.Hostname, ":", err)
+			}
+		}
+	}
+
+	s.Lock()
+	nodes := make([]*types.ScaleIONode, 0)
+	for _, tmpNode := range s.State.ScaleIO.Nodes {
+		if tmpNode.Hostname != node.Hostname {
+			nodes = append(nodes, tmpNode)
+		}
+	}
+	s.State.ScaleIO.Nodes = nodes
+
+	err = s.Store.DeleteNode(node.Hostname)
+	if err != nil {
+		log.Warnln("Failed to delete", node.Hostname, "from the store:", err)
+	}
+	s.PublishNode(types.DeltaNodeRemoved, node)
+	s.RecordEvent(types.EventDecommission, node.Hostname, "Node decommissioned")
+	s.Unlock()
+
+	if s.KillTask != nil {
+		s.KillTask(node)
+	}
+}
+
+//progressDecommissions moves every node being decommissioned along. ScaleIO
+//work is done without holding the lock.
+func (s *RestServer) progressDecommissions() {
+	s.Lock()
+	nodes := make([]*types.ScaleIONode, 0)
+	for _, node := range cloneState(s.State).ScaleIO.Nodes {
+		if node.Decommission != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	s.Unlock()
+
+	for _, node := range nodes {
+		switch node.Decommission.Phase {
+		case types.DecommissionRemovingSds:
+			done, err := s.removeSdss(node)
+			if err != nil {
+				s.decommissionFailed(node.Hostname, err)
+				continue
+			}
+			if !done {
+				continue
+			}
+			s.setDecommissionPhase(node.Hostname, types.DecommissionUnmapping)
+
+		case types.DecommissionUnmapping:
+			err := s.unmapVolumes(node)
+			if err != nil {
+				s.decommissionFailed(node.Hostname, err)
+				continue
+			}
+			s.setDecommissionPhase(node.Hostname, types.DecommissionUninstalling)
+
+		case types.DecommissionUninstalling:
+			if node.State == types.StateDecommissioned {
+				s.removeNode(node)
+				continue
+			}
+			//a failed uninstall is retried from StateFatalInstall
+			if node.State == types.StateDecommission || node.State == types.StateFatalInstall {
+				continue
+			}
+
+			s.Lock()
+			realNode := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, node.Hostname)
+			if realNode != nil {
+				err := s.decommissionNode(realNode, "Decommissioned by an operator")
+				if err != nil {
+					log.Warnln("Failed to save state for", node.Hostname, ":", err)
+				}
+			}
+			s.Unlock()
+		}
+	}
+}
+
+//setDecommissionPhase moves the decommission of a node to the next phase
+func (s *RestServer) setDecommissionPhase(hostname string, phase string) {
+	s.Lock()
+	defer s.Unlock()
+
+	node := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, hostname)
+	if node == nil || node.Decommission == nil {
+		return
+	}
+	log.Infoln("Decommission of", hostname, "moving from", node.Decommission.Phase, "to", phase)
+	node.Decommission.Phase = phase
+	node.Decommission.Error = ""
+	s.saveDecommission(node)
+}
+
+func deleteNode(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	hostname := mux.Vars(r)["hostname"]
+
+	server.Lock()
+	node := common.FindScaleIONodeByHostname(server.State.ScaleIO.Nodes, hostname)
+	if node == nil {
+		server.Unlock()
+		writeError(w, "Unable to find the Node", http.StatusNotFound)
+		return
+	}
+	if node.Persona != types.PersonaNode {
+		server.Unlock()
+		writeError(w, "Only data nodes can be decommissioned. The node is a "+
+			common.PersonaIDToString(node.Persona), http.StatusConflict)
+		return
+	}
+	if node.Decommission != nil {
+		server.Unlock()
+		writeError(w, "The node is already being decommissioned", http.StatusConflict)
+		return
+	}
+	if upgradeInProgress(server.upgrade) {
+		server.Unlock()
+		writeError(w, "A rolling upgrade is in progress", http.StatusConflict)
+		return
+	}
+
+	//an SDS only exists once the cluster is configured
+	phase := types.DecommissionUninstalling
+	if server.State.ScaleIO.Configured {
+		phase = types.DecommissionRemovingSds
+	}
+	node.Decommission = &types.NodeDecommission{
+		Phase:    phase,
+		Started:  time.Now().Unix(),
+		Removing: make([]string, 0),
+	}
+	err := server.Store.SetNodeRecord(node)
+	server.Touch()
+	server.RecordEvent(types.EventDecommission, hostname, "Decommission started")
+	info := server.newNodeInfo(node)
+	server.Unlock()
+
+	if err != nil {
+		writeError(w, "SetNodeRecord Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	//picked up by MonitorForState on the next pass
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//DefaultEventsLimit number of events returned when no limit is given
+	DefaultEventsLimit = 100
+
+	//MaxEventsLimit most events returned by a single request
+	MaxEventsLimit = 1000
+
+	//eventQueueSize number of events waiting to be written to the journal
+	//before RecordEvent blocks
+	eventQueueSize = 1024
+)
+
+//RecordEvent queues an event for the journal in the store. Events are mostly
+//recorded while holding the lock so the store is written to by JournalEvents
+//in the background.
+func (s *RestServer) RecordEvent(eventType string, hostname string, message string) {
+	log.Infoln("[EVENT]", eventType, hostname, message)
+
+	s.events <- &types.Event{
+		Type:      eventType,
+		Hostname:  hostname,
+		Message:   message,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+//JournalEvents writes the queued events to the journal in the order they were
+//recorded
+func (s *RestServer) JournalEvents() {
+	for event := range s.events {
+		err := s.Store.AppendEvent(event)
+		if err != nil {
+			log.Warnln("Failed to record event", event.Type, ". Err:", err)
+		}
+	}
+}
+
+func getEvents(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	limit := uint64(DefaultEventsLimit)
+	if str := r.URL.Query().Get("limit"); len(str) > 0 {
+		var err error
+		limit, err = strconv.ParseUint(str, 10, 64)
+		if err != nil || limit == 0 || limit > MaxEventsLimit {
+			writeError(w, "Invalid limit parameter. Must be between 1 and "+
+				strconv.Itoa(MaxEventsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var events []*types.Event
+	var err error
+	if str := r.URL.Query().Get("since"); len(str) > 0 {
+		since, errSince := strconv.ParseUint(str, 10, 64)
+		if errSince != nil {
+			writeError(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		events, err = server.Store.GetEvents(since, limit)
+	} else {
+		//without since, the newest events
+		events, err = server.Store.GetLastEvents(limit)
+	}
+	if err != nil {
+		writeError(w, "GetEvents Err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -15,7 +15,7 @@ func downloadExecutor(w http.ResponseWriter, r *http.Request, server *RestServer
 		log.Debugln("AltExecutorPath = \"\" BEGIN")
 		pathTmp, err := xplatform.GetInstance().Fs.GetFullPath()
 		if err != nil {
-			http.Error(w, "Unable to determine executor location", http.StatusNotFound)
+			writeError(w, "Unable to determine executor location", http.StatusNotFound)
 			return
 		}
 		path = xplatform.GetInstance().Fs.AppendSlash(pathTmp) + "scaleio-executor"
@@ -25,8 +25,9 @@ func downloadExecutor(w http.ResponseWriter, r *http.Request, server *RestServer
 	log.Infoln("Path:", path)
 	_, err := os.Stat(path)
 	if err != nil {
-		http.Error(w, "File does not exist", http.StatusNotFound)
+		writeError(w, "File does not exist", http.StatusNotFound)
 		log.Errorln("Executor does not exist:", path)
+		return
 	}
 	log.Debugln("Path:", path)
 	http.ServeFile(w, r, path)
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//healthNone is the error state of a device without errors
+	healthNone = "None"
+
+	//healthNormal is the state of a device or SDS that is working
+	healthNormal = "Normal"
+)
+
+//severityRank orders the severities from the best to the worst
+var severityRank = map[string]int{
+	types.HealthOk:       0,
+	types.HealthInfo:     1,
+	types.HealthWarning:  2,
+	types.HealthCritical: 3,
+}
+
+//worseSeverity returns the worst of two severities
+func worseSeverity(a string, b string) string {
+	if severityRank[b] > severityRank[a] {
+		return b
+	}
+	return a
+}
+
+//addIssue adds an issue to the health and raises the severity to match
+func addIssue(health *types.ClusterHealth, issue *types.HealthIssue) {
+	health.Issues = append(health.Issues, issue)
+	health.Severity = worseSeverity(health.Severity, issue.Severity)
+}
+
+//mdmClusterSeverity maps the state of the MDM cluster to a severity
+func mdmClusterSeverity(state string) string {
+	switch state {
+	case "ClusteredNormal":
+		return types.HealthOk
+	case "ClusteredDegraded", "ClusteredTiebreakerDown":
+		return types.HealthWarning
+	case "ClusteredDegradedTiebreakerDown", "NotClustered":
+		return types.HealthCritical
+	default:
+		return types.HealthWarning
+	}
+}
+
+//newPoolHealth works out the severity of a StoragePool from its data. Data
+//that can't be read is critical, data with a single copy needs a rebuild and
+//a rebalance is routine work.
+func newPoolHealth(domain string, pool string, failedKb int, degradedKb int,
+	rebuildKb int, rebalanceKb int) *types.PoolHealth {
+	health := &types.PoolHealth{
+		Domain:      domain,
+		Pool:        pool,
+		Severity:    types.HealthOk,
+		FailedKb:    failedKb,
+		DegradedKb:  degradedKb,
+		RebuildKb:   rebuildKb,
+		RebalanceKb: rebalanceKb,
+	}
+	switch {
+	case failedKb > 0:
+		health.Severity = types.HealthCritical
+	case degradedKb > 0 || rebuildKb > 0:
+		health.Severity = types.HealthWarning
+	case rebalanceKb > 0:
+		health.Severity = types.HealthInfo
+	}
+	return health
+}
+
+//poolMessage describes the data of a StoragePool that isn't ok
+func poolMessage(pool *types.PoolHealth) string {
+	name := pool.Domain + "/" + pool.Pool
+	switch {
+	case pool.FailedKb > 0:
+		return "StoragePool " + name + " has data that is unavailable"
+	case pool.DegradedKb > 0:
+		return "StoragePool " + name + " has degraded data"
+	case pool.RebuildKb > 0:
+		return "StoragePool " + name + " is rebuilding"
+	default:
+		return "StoragePool " + name + " is rebalancing"
+	}
+}
+
+//sdsHostnames maps the SDS names to the hostname of the node running them
+func (s *RestServer) sdsHostnames() map[string]string {
+	s.Lock()
+	defer s.Unlock()
+
+	hosts := make(map[string]string)
+	for _, node := range s.State.ScaleIO.Nodes {
+		hosts[types.DefaultSdsName(node.IPAddress)] = node.Hostname
+		for _, domain := range node.ProvidesDomains {
+			for _, sds := range domain.GetSdss(node.IPAddress) {
+				hosts[sds.Name] = node.Hostname
+			}
+		}
+	}
+	return hosts
+}
+
+//checkHealth queries ScaleIO for the state of the MDM cluster, the SDSs, the
+//devices and the data in each StoragePool. Must be called without the lock.
+func (s *RestServer) checkHealth() *types.ClusterHealth {
+	log.Debugln("checkHealth ENTER")
+
+	health := &types.ClusterHealth{
+		Severity: types.HealthOk,
+		Checked:  time.Now().Unix(),
+		Issues:   make([]*types.HealthIssue, 0),
+		Pools:    make([]*types.PoolHealth, 0),
+	}
+
+	session, err := s.openScaleIO()
+	if err != nil {
+		addIssue(health, &types.HealthIssue{
+			Component: "system",
+			Name:      "gateway",
+			Severity:  types.HealthCritical,
+			Message:   "Unable to reach the ScaleIO Gateway: " + err.Error(),
+		})
+		log.Debugln("checkHealth LEAVE")
+		return health
+	}
+
+	system := session.system.System
+	health.MdmMode = system.MdmMode
+	health.MdmClusterState = system.MdmClusterState
+	if severity := mdmClusterSeverity(system.MdmClusterState); severity != types.HealthOk {
+		addIssue(health, &types.HealthIssue{
+			Component: "system",
+			Name:      system.Name,
+			Severity:  severity,
+			Message:   "The MDM cluster is " + system.MdmClusterState,
+		})
+	}
+
+	domains, err := session.system.GetProtectionDomain("")
+	if err != nil {
+		log.Errorln("GetProtectionDomain Error:", err)
+		s.Metrics.ScaleIOError("GetProtectionDomain")
+		addIssue(health, &types.HealthIssue{
+			Component: "system",
+			Name:      system.Name,
+			Severity:  types.HealthCritical,
+			Message:   "Unable to list the ProtectionDomains: " + err.Error(),
+		})
+		log.Debugln("checkHealth LEAVE")
+		return health
+	}
+
+	sdsHosts := s.sdsHostnames()
+	for _, tmpDomain := range domains {
+		scaleioDomain := goscaleio.NewProtectionDomainEx(session.client, tmpDomain)
+		sdsNames := s.checkSdsHealth(health, scaleioDomain, sdsHosts)
+		s.checkPoolHealth(health, session.client, scaleioDomain, sdsNames, sdsHosts)
+	}
+
+	log.Debugln("checkHealth Succeeded")
+	log.Debugln("checkHealth LEAVE")
+	return health
+}
+
+//checkSdsHealth adds an issue for each SDS of the ProtectionDomain that is not
+//connected or not working. Returns the SDS names by ID.
+func (s *RestServer) checkSdsHealth(health *types.ClusterHealth, scaleioDomain *goscaleio.ProtectionDomain,
+	sdsHosts map[string]string) map[string]string {
+	sdsNames := make(map[string]string)
+
+	sdss, err := scaleioDomain.GetSds()
+	if err != nil {
+		log.Errorln("GetSds Error:", err)
+		s.Metrics.ScaleIOError("GetSds")
+		addIssue(health, &types.HealthIssue{
+			Component: "system",
+			Name:      scaleioDomain.ProtectionDomain.Name,
+			Severity:  types.HealthWarning,
+			Message:   "Unable to list the SDSs: " + err.Error(),
+		})
+		return sdsNames
+	}
+
+	for _, sds := range sdss {
+		sdsNames[sds.ID] = sds.Name
+		issue := &types.HealthIssue{
+			Component: "sds",
+			Name:      sds.Name,
+			Hostname:  sdsHosts[sds.Name],
+		}
+		switch {
+		case sds.MdmConnectionState == "Disconnected":
+			issue.Severity = types.HealthCritical
+			issue.Message = "SDS " + sds.Name + " is disconnected from the MDM"
+		case sds.SdsState == removePending:
+			issue.Severity = types.HealthInfo
+			issue.Message = "SDS " + sds.Name + " is being removed"
+		case len(sds.SdsState) > 0 && sds.SdsState != healthNormal:
+			issue.Severity = types.HealthWarning
+			issue.Message = "SDS " + sds.Name + " is " + sds.SdsState
+		case len(sds.MembershipState) > 0 && sds.MembershipState != "Joined":
+			issue.Severity = types.HealthWarning
+			issue.Message = "SDS " + sds.Name + " is " + sds.MembershipState
+		default:
+			continue
+		}
+		addIssue(health, issue)
+	}
+	return sdsNames
+}
+
+//checkPoolHealth adds the data of each StoragePool of the ProtectionDomain and
+//an issue for each device with errors
+func (s *RestServer) checkPoolHealth(health *types.ClusterHealth, client *goscaleio.Client,
+	scaleioDomain *goscaleio.ProtectionDomain, sdsNames map[string]string, sdsHosts map[string]string) {
+	domainName := scaleioDomain.ProtectionDomain.Name
+
+	pools, err := scaleioDomain.GetStoragePool("")
+	if err != nil {
+		log.Errorln("GetStoragePool Error:", err)
+		s.Metrics.ScaleIOError("GetStoragePool")
+		addIssue(health, &types.HealthIssue{
+			Component: "system",
+			Name:      domainName,
+			Severity:  types.HealthWarning,
+			Message:   "Unable to list the StoragePools: " + err.Error(),
+		})
+		return
+	}
+
+	for _, tmpPool := range pools {
+		scaleioPool := goscaleio.NewStoragePoolEx(client, tmpPool)
+		name := domainName + "/" + tmpPool.Name
+
+		stats, err := scaleioPool.GetStatistics()
+		if err != nil {
+			log.Warnln("GetStatistics Error:", err)
+			s.Metrics.ScaleIOError("GetStatistics")
+			addIssue(health, &types.HealthIssue{
+				Component: "pool",
+				Name:      name,
+				Severity:  types.HealthWarning,
+				Message:   "Unable to read the statistics of StoragePool " + name + ": " + err.Error(),
+			})
+		} else {
+			pool := newPoolHealth(domainName, tmpPool.Name, stats.FailedCapacityInKb,
+				stats.DegradedFailedCapacityInKb+stats.DegradedHealthyCapacityInKb,
+				stats.PendingFwdRebuildCapacityInKb+stats.PendingBckRebuildCapacityInKb+
+					stats.ActiveFwdRebuildCapacityInKb+stats.ActiveBckRebuildCapacityInKb,
+				stats.PendingRebalanceCapacityInKb+stats.ActiveRebalanceCapacityInKb)
+			health.Pools = append(health.Pools, pool)
+			if pool.Severity != types.HealthOk {
+				addIssue(health, &types.HealthIssue{
+					Component: "pool",
+					Name:      name,
+					Severity:  pool.Severity,
+					Message:   poolMessage(pool),
+				})
+			}
+		}
+
+		devices, err := scaleioPool.GetDevice()
+		if err != nil {
+			log.Warnln("GetDevice Error:", err)
+			s.Metrics.ScaleIOError("GetDevice")
+			continue
+		}
+		for _, device := range devices {
+			sdsName := sdsNames[device.SdsID]
+			issue := &types.HealthIssue{
+				Component: "device",
+				Name:      device.DeviceCurrentPathname,
+				Hostname:  sdsHosts[sdsName],
+			}
+			switch {
+			case len(device.ErrorState) > 0 && device.ErrorState != healthNone:
+				issue.Severity = types.HealthCritical
+				issue.Message = "Device " + device.DeviceCurrentPathname + " on SDS " + sdsName +
+					" has errors (" + device.ErrorState + ")"
+			case device.DeviceState == removePending:
+				issue.Severity = types.HealthInfo
+				issue.Message = "Device " + device.DeviceCurrentPathname + " on SDS " + sdsName +
+					" is being removed"
+			case len(device.DeviceState) > 0 && device.DeviceState != healthNormal:
+				issue.Severity = types.HealthWarning
+				issue.Message = "Device " + device.DeviceCurrentPathname + " on SDS " + sdsName +
+					" is " + device.DeviceState
+			default:
+				continue
+			}
+			addIssue(health, issue)
+		}
+	}
+}
+
+//worstIssue returns the first of the worst issues or nil if there are none
+func worstIssue(health *types.ClusterHealth) *types.HealthIssue {
+	var worst *types.HealthIssue
+	for _, issue := range health.Issues {
+		if worst == nil || severityRank[issue.Severity] > severityRank[worst.Severity] {
+			worst = issue
+		}
+	}
+	return worst
+}
+
+//checkClusterHealth is true when the health check finds nothing wrong, which
+//is when another node can be taken down for an upgrade, a reboot or a
+//decommission. Warnings and routine work like a rebalance have to clear up
+//first. Returns an error if the cluster is critical. Must be called without
+//the lock.
+func (s *RestServer) checkClusterHealth() (bool, error) {
+	health := s.checkHealth()
+	s.setHealth(health)
+
+	worst := worstIssue(health)
+	switch health.Severity {
+	case types.HealthOk:
+		return true, nil
+	case types.HealthCritical:
+		return false, errors.New(worst.Message)
+	default:
+		log.Infoln("Waiting on the cluster:", worst.Message)
+		return false, nil
+	}
+}
+
+//setHealth keeps the result of a health check and tells everyone watching when
+//the severity changed
+func (s *RestServer) setHealth(health *types.ClusterHealth) {
+	s.Lock()
+	defer s.Unlock()
+
+	previous := s.health
+	if previous != nil && previous.Severity == health.Severity {
+		health.Changed = previous.Changed
+		s.health = health
+		return
+	}
+
+	health.Changed = health.Checked
+	s.health = health
+
+	message := "Cluster health is " + health.Severity
+	if worst := worstIssue(health); worst != nil {
+		message += ": " + worst.Message
+	}
+	if severityRank[health.Severity] >= severityRank[types.HealthWarning] {
+		log.Warnln(message)
+	} else {
+		log.Infoln(message)
+	}
+
+	s.RecordEvent(types.EventHealthChanged, "", message)
+	s.Publish(&types.Delta{
+		Type:   types.DeltaClusterHealth,
+		Value:  health.Severity,
+		Reason: message,
+	})
+}
+
+//MonitorHealth checks the health of the ScaleIO cluster once it is configured
+func (s *RestServer) MonitorHealth() {
+	if s.Config.HealthInterval <= 0 {
+		log.Infoln("Cluster health checks are disabled")
+		return
+	}
+
+	for {
+		time.Sleep(s.Config.HealthInterval)
+
+		s.Lock()
+		configured := s.State.ScaleIO.Configured
+		s.Unlock()
+		if !configured {
+			continue
+		}
+
+		s.setHealth(s.checkHealth())
+	}
+}
+
+func getHealth(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	health := &types.ClusterHealth{
+		Severity: types.HealthUnknown,
+		Issues:   make([]*types.HealthIssue, 0),
+		Pools:    make([]*types.PoolHealth, 0),
+	}
+
+	server.Lock()
+	if server.health != nil {
+		tmpHealth := *server.health
+		health = &tmpHealth
+	}
+	server.Unlock()
+
+	//?severity=warning only returns the issues that are at least that bad
+	if severity := strings.ToLower(r.URL.Query().Get("severity")); len(severity) > 0 {
+		if _, ok := severityRank[severity]; !ok {
+			writeError(w, "Invalid severity", http.StatusBadRequest)
+			return
+		}
+		issues := make([]*types.HealthIssue, 0)
+		for _, issue := range health.Issues {
+			if severityRank[issue.Severity] >= severityRank[severity] {
+				issues = append(issues, issue)
+			}
+		}
+		health.Issues = issues
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//isTaskGone returns true if Mesos says the task of the node is no longer
+//running
+func isTaskGone(taskState string) bool {
+	switch taskState {
+	case "TASK_FINISHED", "TASK_FAILED", "TASK_KILLED", "TASK_LOST", "TASK_ERROR",
+		"TASK_DROPPED", "TASK_GONE", "TASK_GONE_BY_OPERATOR", "TASK_UNREACHABLE":
+		return true
+	}
+	return false
+}
+
+//nodeLiveness works out the liveness of a node from the last ping and the
+//last status Mesos sent for its task
+func (s *RestServer) nodeLiveness(node *types.ScaleIONode, now int64) string {
+	if isTaskGone(node.TaskState) {
+		return types.LivenessOffline
+	}
+	if node.LastContact == 0 {
+		return types.LivenessUnknown
+	}
+
+	age := now - node.LastContact
+	if age >= int64(s.Config.LivenessOffline.Seconds()) {
+		return types.LivenessOffline
+	}
+	if age >= int64(s.Config.LivenessStale.Seconds()) {
+		return types.LivenessStale
+	}
+	return types.LivenessOnline
+}
+
+//updateLiveness sets the liveness of the node and tells everyone watching
+//when it changed. The caller must hold the lock.
+func (s *RestServer) updateLiveness(node *types.ScaleIONode, now int64) {
+	if node.State == types.StateDecommissioned {
+		return
+	}
+
+	liveness := s.nodeLiveness(node, now)
+	if liveness == node.Liveness {
+		return
+	}
+
+	previous := node.Liveness
+	node.Liveness = liveness
+	s.PublishNode(types.DeltaNodeLiveness, node)
+
+	//a node that never pinged is not news after a restart
+	if len(previous) == 0 && liveness == types.LivenessUnknown {
+		return
+	}
+
+	message := "Node is " + liveness
+	if liveness == types.LivenessOffline && isTaskGone(node.TaskState) {
+		message += " (" + node.TaskState + ")"
+	}
+	if liveness == types.LivenessOffline {
+		log.Warnln("Node", node.Hostname, "is offline")
+	} else {
+		log.Infoln("Node", node.Hostname, "is", liveness)
+	}
+	s.RecordEvent(types.EventLivenessChanged, node.Hostname, message)
+}
+
+//MonitorLiveness marks nodes stale or offline as they stop pinging
+func (s *RestServer) MonitorLiveness() {
+	for {
+		time.Sleep(time.Duration(common.PollLivenessInSeconds) * time.Second)
+
+		s.Lock()
+		now := time.Now().Unix()
+		for _, node := range s.State.ScaleIO.Nodes {
+			s.updateLiveness(node, now)
+		}
+		s.Unlock()
+	}
+}
+
+//UpdateTaskState records the status Mesos sent for the task of a node
+func (s *RestServer) UpdateTaskState(taskID string, taskState string) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, node := range s.State.ScaleIO.Nodes {
+		if node.TaskID != taskID {
+			continue
+		}
+		node.TaskState = taskState
+		s.updateLiveness(node, time.Now().Unix())
+		return
+	}
+	log.Debugln("No node found for task", taskID)
+}
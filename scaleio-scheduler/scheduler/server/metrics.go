@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	metricsPrefix = "scaleio_framework_"
+)
+
+//Metrics counts what the scheduler does so it can be scraped by Prometheus
+type Metrics struct {
+	offersReceived      uint64
+	offersAccepted      uint64
+	offersDeclined      uint64
+	addResourcesSeconds float64
+	addResourcesCount   uint64
+	scaleioErrors       map[string]uint64
+	pools               map[string]*types.PoolCapacity
+	volumesCreated      uint64
+
+	sync.Mutex
+}
+
+//NewMetrics creates a new Metrics object
+func NewMetrics() *Metrics {
+	return &Metrics{
+		scaleioErrors: make(map[string]uint64),
+		pools:         make(map[string]*types.PoolCapacity),
+	}
+}
+
+//OffersReceived counts offers from Mesos
+func (m *Metrics) OffersReceived(count int) {
+	m.Lock()
+	m.offersReceived += uint64(count)
+	m.Unlock()
+}
+
+//OfferAccepted counts an accepted offer
+func (m *Metrics) OfferAccepted() {
+	m.Lock()
+	m.offersAccepted++
+	m.Unlock()
+}
+
+//OfferDeclined counts a declined offer
+func (m *Metrics) OfferDeclined() {
+	m.Lock()
+	m.offersDeclined++
+	m.Unlock()
+}
+
+//AddResourcesDuration records how long addResourcesToScaleIO took
+func (m *Metrics) AddResourcesDuration(duration time.Duration) {
+	m.Lock()
+	m.addResourcesSeconds += duration.Seconds()
+	m.addResourcesCount++
+	m.Unlock()
+}
+
+//ScaleIOError counts a failed goscaleio call
+func (m *Metrics) ScaleIOError(operation string) {
+	m.Lock()
+	m.scaleioErrors[operation]++
+	m.Unlock()
+}
+
+//PoolUsage records the capacity and used space of a StoragePool
+func (m *Metrics) PoolUsage(domain string, pool string, capacityKb uint64, usedKb uint64) {
+	m.Lock()
+	m.pools[domain+"/"+pool] = &types.PoolCapacity{
+		Domain:     domain,
+		Pool:       pool,
+		CapacityKb: capacityKb,
+		UsedKb:     usedKb,
+		Timestamp:  time.Now().Unix(),
+	}
+	m.Unlock()
+}
+
+//Pools returns the last capacity read for each StoragePool
+func (m *Metrics) Pools() []*types.PoolCapacity {
+	m.Lock()
+	defer m.Unlock()
+
+	keys := make([]string, 0)
+	for key := range m.pools {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pools := make([]*types.PoolCapacity, 0)
+	for _, key := range keys {
+		pool := *m.pools[key]
+		pools = append(pools, &pool)
+	}
+	return pools
+}
+
+//VolumeCreated counts an AWS volume created to expand a StoragePool
+func (m *Metrics) VolumeCreated() {
+	m.Lock()
+	m.volumesCreated++
+	m.Unlock()
+}
+
+func escapeLabel(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	return strings.Replace(value, "\n", "\\n", -1)
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name string, metricType string, help string) {
+	fmt.Fprintf(buf, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(buf, "# TYPE %s%s %s\n", metricsPrefix, name, metricType)
+}
+
+func writeMetric(buf *bytes.Buffer, name string, labels string, value interface{}) {
+	if len(labels) > 0 {
+		fmt.Fprintf(buf, "%s%s{%s} %v\n", metricsPrefix, name, labels, value)
+	} else {
+		fmt.Fprintf(buf, "%s%s %v\n", metricsPrefix, name, value)
+	}
+}
+
+func writeLabeledMetrics(buf *bytes.Buffer, name string, values map[string]uint64) {
+	keys := make([]string, 0)
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeMetric(buf, name, key, values[key])
+	}
+}
+
+func getMetrics(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	buf := &bytes.Buffer{}
+	now := time.Now().Unix()
+
+	//nodes come from the state
+	nodeCounts := make(map[string]uint64)
+	livenessCounts := make(map[string]uint64)
+	lastContact := make(map[string]uint64)
+	server.Lock()
+	for _, node := range server.State.ScaleIO.Nodes {
+		labels := fmt.Sprintf("persona=\"%s\",state=\"%s\"",
+			common.PersonaIDToString(node.Persona), common.StateIDToString(node.State))
+		nodeCounts[labels]++
+		if len(node.Liveness) > 0 {
+			livenessCounts[fmt.Sprintf("liveness=\"%s\"", node.Liveness)]++
+		}
+		if node.LastContact > 0 && len(node.Hostname) > 0 {
+			labels := fmt.Sprintf("hostname=\"%s\"", escapeLabel(node.Hostname))
+			lastContact[labels] = uint64(now - node.LastContact)
+		}
+	}
+	revision := server.State.Revision
+	healthIssues := make(map[string]uint64)
+	if server.health != nil {
+		for _, issue := range server.health.Issues {
+			healthIssues[fmt.Sprintf("severity=\"%s\"", issue.Severity)]++
+		}
+	}
+	server.Unlock()
+
+	writeMetricHeader(buf, "nodes", "gauge", "Number of nodes by persona and state.")
+	writeLabeledMetrics(buf, "nodes", nodeCounts)
+	writeMetricHeader(buf, "nodes_liveness", "gauge", "Number of nodes by liveness.")
+	writeLabeledMetrics(buf, "nodes_liveness", livenessCounts)
+	writeMetricHeader(buf, "node_last_contact_seconds", "gauge", "Seconds since each node last pinged the scheduler.")
+	writeLabeledMetrics(buf, "node_last_contact_seconds", lastContact)
+	writeMetricHeader(buf, "health_issues", "gauge", "Number of issues found by the last health check by severity.")
+	writeLabeledMetrics(buf, "health_issues", healthIssues)
+	writeMetricHeader(buf, "state_revision", "gauge", "Revision of the state.")
+	writeMetric(buf, "state_revision", "", revision)
+
+	m := server.Metrics
+	m.Lock()
+	writeMetricHeader(buf, "offers_received_total", "counter", "Offers received from Mesos.")
+	writeMetric(buf, "offers_received_total", "", m.offersReceived)
+	writeMetricHeader(buf, "offers_accepted_total", "counter", "Offers accepted to launch an executor.")
+	writeMetric(buf, "offers_accepted_total", "", m.offersAccepted)
+	writeMetricHeader(buf, "offers_declined_total", "counter", "Offers declined.")
+	writeMetric(buf, "offers_declined_total", "", m.offersDeclined)
+	writeMetricHeader(buf, "add_resources_duration_seconds", "summary", "Time spent adding resources to ScaleIO.")
+	writeMetric(buf, "add_resources_duration_seconds_sum", "", m.addResourcesSeconds)
+	writeMetric(buf, "add_resources_duration_seconds_count", "", m.addResourcesCount)
+	writeMetricHeader(buf, "scaleio_errors_total", "counter", "Failed calls to the ScaleIO Gateway by operation.")
+	errors := make(map[string]uint64)
+	for operation, count := range m.scaleioErrors {
+		errors[fmt.Sprintf("operation=\"%s\"", escapeLabel(operation))] = count
+	}
+	writeLabeledMetrics(buf, "scaleio_errors_total", errors)
+	poolCapacity := make(map[string]uint64)
+	poolUsed := make(map[string]uint64)
+	for _, pool := range m.pools {
+		labels := fmt.Sprintf("domain=\"%s\",pool=\"%s\"", escapeLabel(pool.Domain), escapeLabel(pool.Pool))
+		poolCapacity[labels] = pool.CapacityKb
+		poolUsed[labels] = pool.UsedKb
+	}
+	writeMetricHeader(buf, "pool_capacity_kb", "gauge", "Capacity of each StoragePool in KB.")
+	writeLabeledMetrics(buf, "pool_capacity_kb", poolCapacity)
+	writeMetricHeader(buf, "pool_used_kb", "gauge", "Used space of each StoragePool in KB.")
+	writeLabeledMetrics(buf, "pool_used_kb", poolUsed)
+	writeMetricHeader(buf, "aws_volumes_created_total", "counter", "AWS volumes created to expand StoragePools.")
+	writeMetric(buf, "aws_volumes_created_total", "", m.volumesCreated)
+	m.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -16,7 +16,7 @@ import (
 func setNodeState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 	if err != nil {
-		http.Error(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
 		return
 	}
 	if err := r.Body.Close(); err != nil {
@@ -30,27 +30,54 @@ func setNodeState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 		KeyValue:     make(map[string]string),
 	}
 	if err := json.Unmarshal(body, &state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	if !isCallerExecutor(r, state.ExecutorID) {
+		writeError(w, "Executor does not match the token", http.StatusUnauthorized)
 		return
 	}
 
 	node := common.FindScaleIONodeByExecutorID(server.State.ScaleIO.Nodes, state.ExecutorID)
 	if node == nil {
-		http.Error(w, "Unable to find the Executor", http.StatusBadRequest)
+		writeError(w, "Unable to find the Executor", http.StatusBadRequest)
 		return
 	}
 
+	reason := state.Reason
+	if len(reason) == 0 && len(state.FailedStep) > 0 {
+		reason = state.FailedStep + " failed"
+	} else if len(reason) == 0 {
+		reason = "Reported by the executor"
+	}
+
 	server.Lock()
-	//set state on object...
-	node.State = state.State
+	fromState := node.State
 	node.LastContact = time.Now().Unix()
 
-	//save state in metadata...
-	err = server.Store.SetNodeInfo(node.Hostname, node.Persona, node.State)
+	if state.State == types.StateFatalInstall && fromState != types.StateFatalInstall {
+		server.recordFailure(node, state)
+	}
+
+	//only moves along the install lifecycle are allowed
+	changed, err := server.TransitionNode(node, state.State, reason)
+	if err == types.ErrInvalidStateTransition {
+		server.Touch()
+		server.Unlock()
+		writeError(w, "Unable to move the node from state "+common.StateIDToString(fromState)+
+			" to state "+common.StateIDToString(state.State), http.StatusConflict)
+		return
+	}
+	if err == nil && !changed {
+		//save the last contact
+		err = server.Store.SetNodeRecord(node)
+		server.Touch()
+	}
 	server.Unlock()
 
 	if err != nil {
-		http.Error(w, "SetNodeInfo Err: "+err.Error(), http.StatusBadRequest)
+		writeError(w, "SetNodeInfo Err: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -60,7 +87,7 @@ func setNodeState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 	}
 }
 
@@ -69,7 +96,7 @@ func setNodeDevices(w http.ResponseWriter, r *http.Request, server *RestServer)
 
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 	if err != nil {
-		http.Error(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
 		return
 	}
 	if err := r.Body.Close(); err != nil {
@@ -83,13 +110,18 @@ func setNodeDevices(w http.ResponseWriter, r *http.Request, server *RestServer)
 		KeyValue:     make(map[string]string),
 	}
 	if err := json.Unmarshal(body, &state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	if !isCallerExecutor(r, state.ExecutorID) {
+		writeError(w, "Executor does not match the token", http.StatusUnauthorized)
 		return
 	}
 
 	node := common.FindScaleIONodeByExecutorID(server.State.ScaleIO.Nodes, state.ExecutorID)
 	if node == nil {
-		http.Error(w, "Unable to find the Executor", http.StatusBadRequest)
+		writeError(w, "Unable to find the Executor", http.StatusBadRequest)
 		return
 	}
 
@@ -130,22 +162,35 @@ func setNodeDevices(w http.ResponseWriter, r *http.Request, server *RestServer)
 		log.Debugln("Add device")
 		sp.Devices = append(sp.Devices, device)
 	}
+
+	//save the devices so they survive a scheduler restart
+	err = server.Store.SetNodeRecord(node)
+	if err == nil {
+		server.PublishNode(types.DeltaDevicesAdvertised, node)
+	} else {
+		server.Touch()
+	}
 	server.Unlock()
 
+	if err != nil {
+		writeError(w, "SetNodeRecord Err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	//acknowledged the state change
 	state.Acknowledged = true
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 	}
 }
 
 func setNodePing(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 	if err != nil {
-		http.Error(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
 		return
 	}
 	if err := r.Body.Close(); err != nil {
@@ -158,26 +203,39 @@ func setNodePing(w http.ResponseWriter, r *http.Request, server *RestServer) {
 		KeyValue:     make(map[string]string),
 	}
 	if err := json.Unmarshal(body, &state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	if !isCallerExecutor(r, state.ExecutorID) {
+		writeError(w, "Executor does not match the token", http.StatusUnauthorized)
 		return
 	}
 
 	node := common.FindScaleIONodeByExecutorID(server.State.ScaleIO.Nodes, state.ExecutorID)
 	if node == nil {
-		http.Error(w, "Unable to find the Executor", http.StatusBadRequest)
+		writeError(w, "Unable to find the Executor", http.StatusBadRequest)
 		return
 	}
 
 	server.Lock()
+	//a ping only changes the revision when the liveness of the node changes
+	//so pings don't wake every long-poll
 	node.LastContact = time.Now().Unix()
+	server.updateLiveness(node, node.LastContact)
+	err = server.Store.SetNodeLastContact(node.Hostname, node.LastContact)
 	server.Unlock()
 
+	if err != nil {
+		log.Warnln("Unable to save LastContact for", node.Hostname, ":", err)
+	}
+
 	//acknowledged the state change
 	state.Acknowledged = true
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 	}
 }
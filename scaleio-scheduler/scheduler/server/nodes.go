@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//newNodeInfo merges the in-memory node with the domains, pools and devices
+//that have been added to ScaleIO according to the store
+func (s *RestServer) newNodeInfo(node *types.ScaleIONode) *types.NodeInfo {
+	info := &types.NodeInfo{
+		Hostname:        node.Hostname,
+		AgentID:         node.AgentID,
+		ExecutorID:      node.ExecutorID,
+		IPAddress:       node.IPAddress,
+		Persona:         node.Persona,
+		PersonaName:     common.PersonaIDToString(node.Persona),
+		State:           node.State,
+		StateName:       common.StateIDToString(node.State),
+		PreviousState:   node.PreviousState,
+		StateChanged:    node.StateChanged,
+		StateReason:     node.StateReason,
+		LastContact:     node.LastContact,
+		Liveness:        node.Liveness,
+		TaskState:       node.TaskState,
+		Imperative:      node.Imperative,
+		Advertised:      node.Advertised,
+		Maintenance:     node.Maintenance,
+		Failure:         node.Failure,
+		Decommission:    node.Decommission,
+		Domains:         make([]*types.NodeDomain, 0),
+		ProvidesDomains: node.ProvidesDomains,
+		ConsumesDomains: node.ConsumesDomains,
+	}
+
+	metaData, err := s.Store.GetMetadata(node.Hostname)
+	if err != nil {
+		log.Debugln("No metadata for node", node.Hostname)
+		return info
+	}
+
+	domainNames := make([]string, 0)
+	for name := range metaData.ProtectionDomains {
+		domainNames = append(domainNames, name)
+	}
+	sort.Strings(domainNames)
+
+	for _, domainName := range domainNames {
+		domain := metaData.ProtectionDomains[domainName]
+		nodeDomain := &types.NodeDomain{
+			Name:  domain.Name,
+			Sdss:  make([]*types.NodeSds, 0),
+			Pools: make([]*types.NodePool, 0),
+		}
+
+		sdsNames := make([]string, 0)
+		for name := range domain.Sdss {
+			sdsNames = append(sdsNames, name)
+		}
+		sort.Strings(sdsNames)
+
+		for _, sdsName := range sdsNames {
+			sds := domain.Sdss[sdsName]
+			nodeSds := &types.NodeSds{
+				Name:    sds.Name,
+				Mode:    sds.Mode,
+				IPs:     sds.IPs,
+				Port:    sds.Port,
+				Devices: make([]string, 0),
+			}
+			for _, pool := range domain.Pools {
+				for _, device := range pool.Devices {
+					if deviceSdsName(node, device) == sds.Name {
+						nodeSds.Devices = append(nodeSds.Devices, device.Name)
+					}
+				}
+			}
+			sort.Strings(nodeSds.Devices)
+			nodeDomain.Sdss = append(nodeDomain.Sdss, nodeSds)
+		}
+
+		poolNames := make([]string, 0)
+		for name := range domain.Pools {
+			poolNames = append(poolNames, name)
+		}
+		sort.Strings(poolNames)
+
+		for _, poolName := range poolNames {
+			pool := domain.Pools[poolName]
+			nodePool := &types.NodePool{
+				Name:    pool.Name,
+				Devices: make([]string, 0),
+			}
+			for _, device := range pool.Devices {
+				nodePool.Devices = append(nodePool.Devices, device.Name)
+			}
+			sort.Strings(nodePool.Devices)
+			nodeDomain.Pools = append(nodeDomain.Pools, nodePool)
+		}
+
+		info.Domains = append(info.Domains, nodeDomain)
+	}
+
+	return info
+}
+
+func parseFilter(value string, toID func(string) int) (int, bool) {
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, true
+	}
+	id := toID(value)
+	if id == 0 && value != "unknown" {
+		return 0, false
+	}
+	return id, true
+}
+
+func getNodes(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	persona := -1
+	if str := r.URL.Query().Get("persona"); len(str) > 0 {
+		id, ok := parseFilter(str, common.PersonaStringToID)
+		if !ok {
+			writeError(w, "Invalid persona parameter", http.StatusBadRequest)
+			return
+		}
+		persona = id
+	}
+
+	state := -1
+	if str := r.URL.Query().Get("state"); len(str) > 0 {
+		id, ok := parseFilter(str, common.StateStringToID)
+		if !ok {
+			writeError(w, "Invalid state parameter", http.StatusBadRequest)
+			return
+		}
+		state = id
+	}
+
+	nodes := make([]*types.NodeInfo, 0)
+
+	server.Lock()
+	for _, node := range server.State.ScaleIO.Nodes {
+		if persona != -1 && node.Persona != persona {
+			continue
+		}
+		if state != -1 && node.State != state {
+			continue
+		}
+		nodes = append(nodes, server.newNodeInfo(node))
+	}
+	server.Unlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(nodes); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func getNode(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	hostname := mux.Vars(r)["hostname"]
+
+	server.Lock()
+	node := common.FindScaleIONodeByHostname(server.State.ScaleIO.Nodes, hostname)
+	var info *types.NodeInfo
+	if node != nil {
+		info = server.newNodeInfo(node)
+	}
+	server.Unlock()
+
+	if info == nil {
+		writeError(w, "Unable to find the Node", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/config"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+var pathParamRegex = regexp.MustCompile(`{([^}]+)}`)
+
+var scopeNames = map[int]string{
+	scopePublic:   "public",
+	scopeExecutor: "executor",
+	scopeRead:     "read",
+	scopeAdmin:    "admin",
+}
+
+type openAPIBuilder struct {
+	schemas map[string]interface{}
+}
+
+//schema returns the JSON schema of a Go type. Named structs are added to the
+//components and referenced.
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			//placeholder so recursive types terminate
+			b.schemas[t.Name()] = nil
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (b *openAPIBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			//unexported
+			continue
+		}
+
+		name := field.Name
+		if tag := field.Tag.Get("json"); len(tag) > 0 {
+			if tag == "-" {
+				continue
+			}
+			if parts := strings.Split(tag, ","); len(parts[0]) > 0 {
+				name = parts[0]
+			}
+		}
+		properties[name] = b.schema(field.Type)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (b *openAPIBuilder) content(obj interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": b.schema(reflect.TypeOf(obj)),
+		},
+	}
+}
+
+func (b *openAPIBuilder) operation(rt *route) map[string]interface{} {
+	params := make([]interface{}, 0)
+	for _, match := range pathParamRegex.FindAllStringSubmatch(rt.Path, -1) {
+		params = append(params, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, name := range rt.Query {
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "query",
+			"required": false,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	success := map[string]interface{}{"description": "OK"}
+	if rt.Response != nil {
+		success["content"] = b.content(rt.Response)
+	} else {
+		produces := rt.Produces
+		if len(produces) == 0 {
+			produces = "application/octet-stream"
+		}
+		success["content"] = map[string]interface{}{
+			produces: map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string", "format": "binary"},
+			},
+		}
+	}
+
+	op := map[string]interface{}{
+		"summary":    rt.Summary,
+		"parameters": params,
+		"x-scope":    scopeNames[rt.Scope],
+		"responses": map[string]interface{}{
+			"200": success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     b.content(types.APIError{}),
+			},
+		},
+	}
+	if rt.Scope == scopePublic {
+		op["security"] = []interface{}{}
+	}
+	if rt.Request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  b.content(rt.Request),
+		}
+	}
+	return op
+}
+
+//generateOpenAPI describes the routes as an OpenAPI 3.0 document
+func generateOpenAPI(routes []*route) map[string]interface{} {
+	b := &openAPIBuilder{
+		schemas: make(map[string]interface{}),
+	}
+
+	paths := make(map[string]interface{})
+	for _, rt := range routes {
+		item, ok := paths[rt.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = b.operation(rt)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "ScaleIO Framework Scheduler",
+			"version": config.VersionStr,
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": types.APIPrefix},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []interface{}{}},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+			},
+		},
+	}
+}
+
+func getOpenAPI(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	doc := generateOpenAPI(apiRoutes())
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	kvstore "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/kvstore"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//isMdmPersona returns true if the node runs an MDM
+func isMdmPersona(node *types.ScaleIONode) bool {
+	return node.Persona == types.PersonaMdmPrimary ||
+		node.Persona == types.PersonaMdmSecondary ||
+		node.Persona == types.PersonaTb
+}
+
+//runsSds returns true if the node runs an SDS. A node that is client only in
+//every domain it uses only runs the SDC.
+func runsSds(node *types.ScaleIONode) bool {
+	if !node.Imperative || len(node.ConsumesDomains) == 0 {
+		return true
+	}
+	for domain := range node.ProvidesDomains {
+		if sdsMode(node, domain) != kvstore.SdsModeClient {
+			return true
+		}
+	}
+	return false
+}
+
+//saveRebootLeases saves the leases so a restarted scheduler still knows which
+//nodes are rebooting. The caller must hold the lock.
+func (s *RestServer) saveRebootLeases() {
+	if err := s.Store.SetRebootLeases(s.rebootLeases); err != nil {
+		log.Warnln("Failed to save the reboot leases:", err)
+	}
+}
+
+//expireRebootLeases drops the leases of nodes that did not come back in time.
+//The caller must hold the lock.
+func (s *RestServer) expireRebootLeases(now int64) {
+	expired := false
+	for hostname, lease := range s.rebootLeases {
+		if lease.Expires > now {
+			continue
+		}
+		log.Warnln("The reboot lease of", hostname, "expired")
+		delete(s.rebootLeases, hostname)
+		s.RecordEvent(types.EventReboot, hostname, "Reboot lease expired")
+		expired = true
+	}
+	if expired {
+		s.saveRebootLeases()
+	}
+}
+
+//rebootBlocker returns why the node can't reboot yet or an empty string if it
+//can. At most one MDM and -reboot.maxsds nodes running an SDS can be down at
+//the same time. A node that is offline is already down. The caller must hold
+//the lock.
+func (s *RestServer) rebootBlocker(node *types.ScaleIONode) string {
+	maxSds := s.Config.RebootMaxSds
+	if maxSds < 1 {
+		maxSds = 1
+	}
+
+	sdsCount := 0
+	for _, other := range s.State.ScaleIO.Nodes {
+		if other == node || other.State == types.StateDecommissioned {
+			continue
+		}
+
+		down := "rebooting"
+		if s.rebootLeases[other.Hostname] == nil {
+			if other.Liveness != types.LivenessOffline {
+				continue
+			}
+			down = "offline"
+		}
+
+		if isMdmPersona(node) && isMdmPersona(other) {
+			return "MDM node " + other.Hostname + " is " + down
+		}
+		if runsSds(other) {
+			sdsCount++
+		}
+	}
+
+	if runsSds(node) && sdsCount >= maxSds {
+		return "The maximum number of SDS nodes are rebooting or offline"
+	}
+	return ""
+}
+
+func setNodeReboot(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	lease := &types.RebootLease{
+		Acknowledged: false,
+		ExecutorID:   "",
+		KeyValue:     make(map[string]string),
+	}
+	if err := json.Unmarshal(body, &lease); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	if !isCallerExecutor(r, lease.ExecutorID) {
+		writeError(w, "Executor does not match the token", http.StatusUnauthorized)
+		return
+	}
+
+	server.Lock()
+	node := common.FindScaleIONodeByExecutorID(server.State.ScaleIO.Nodes, lease.ExecutorID)
+	if node == nil {
+		server.Unlock()
+		writeError(w, "Unable to find the Executor", http.StatusBadRequest)
+		return
+	}
+	hostname := node.Hostname
+	held := server.rebootLeases[hostname] != nil
+	configured := server.State.ScaleIO.Configured
+	server.Unlock()
+
+	//the cluster has to be healthy before the next node takes SDSs offline.
+	//There is no data before the cluster is configured.
+	healthy := true
+	reason := ""
+	if !lease.Release && !held && configured {
+		healthy, err = server.checkClusterHealth()
+		if err != nil {
+			healthy = false
+			reason = err.Error()
+		} else if !healthy {
+			reason = "The health of the cluster is not ok"
+		}
+	}
+
+	server.Lock()
+	now := time.Now().Unix()
+	server.expireRebootLeases(now)
+
+	current := server.rebootLeases[hostname]
+	switch {
+	case lease.Release:
+		if current != nil {
+			delete(server.rebootLeases, hostname)
+			server.saveRebootLeases()
+			server.RecordEvent(types.EventReboot, hostname, "Reboot lease released")
+		}
+		lease.Granted = false
+
+	case current != nil:
+		//asked again while holding the lease
+		lease.Granted = true
+		lease.Started = current.Started
+		lease.Expires = current.Expires
+
+	case !healthy:
+		lease.Granted = false
+		lease.Reason = reason
+
+	default:
+		lease.Reason = server.rebootBlocker(node)
+		lease.Granted = len(lease.Reason) == 0
+		if lease.Granted {
+			lease.Started = now
+			lease.Expires = now + int64(server.Config.RebootTimeout.Seconds())
+			server.rebootLeases[hostname] = &types.RebootLease{
+				ExecutorID: node.ExecutorID,
+				Hostname:   hostname,
+				Granted:    true,
+				Started:    lease.Started,
+				Expires:    lease.Expires,
+			}
+			server.saveRebootLeases()
+			server.RecordEvent(types.EventReboot, hostname, "Reboot lease granted")
+		}
+	}
+	server.Unlock()
+
+	if !lease.Granted && len(lease.Reason) > 0 {
+		log.Infoln("Reboot of", hostname, "held back:", lease.Reason)
+	}
+
+	lease.Hostname = hostname
+	lease.Acknowledged = true
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(lease); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func getRebootLeases(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	server.expireRebootLeases(time.Now().Unix())
+	hostnames := make([]string, 0)
+	for hostname := range server.rebootLeases {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	leases := make([]*types.RebootLease, 0)
+	for _, hostname := range hostnames {
+		tmpLease := *server.rebootLeases[hostname]
+		leases = append(leases, &tmpLease)
+	}
+	server.Unlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(leases); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
+	siotypes "github.com/codedellemc/goscaleio/types/v1"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	kvstore "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/kvstore"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//removePending is the state of a device or SDS that ScaleIO is removing
+	removePending = "RemovePending"
+)
+
+//poolRemoval is how far the removal of a StoragePool from a node has come
+type poolRemoval int
+
+const (
+	//poolRemovalPending the devices of the node are not gone yet
+	poolRemovalPending poolRemoval = iota
+
+	//poolRemovalReleased the node is done with the StoragePool but it is kept
+	//in ScaleIO for the devices of other nodes or its volumes
+	poolRemovalReleased
+
+	//poolRemovalDone the StoragePool was removed from ScaleIO
+	poolRemovalDone
+)
+
+//cascadeDeletions marks everything in a ProtectionDomain or StoragePool that
+//is being deleted for deletion too
+func cascadeDeletions(domain *kvstore.ProtectionDomain) {
+	for _, sds := range domain.Sdss {
+		if domain.Delete {
+			sds.Delete = true
+		}
+	}
+	for _, pool := range domain.Pools {
+		if domain.Delete {
+			pool.Delete = true
+		}
+		for _, device := range pool.Devices {
+			if pool.Delete {
+				device.Delete = true
+			}
+		}
+	}
+}
+
+//keepDeletions marks every deletion pending so nothing is removed from the
+//store. It is used when ScaleIO could not be updated. The deletions are found
+//again the next time the node is processed.
+func keepDeletions(metaData *kvstore.Metadata) {
+	for _, domain := range metaData.ProtectionDomains {
+		domain.RemovePending = domain.Delete
+		for _, sds := range domain.Sdss {
+			sds.RemovePending = sds.Delete
+		}
+		for _, pool := range domain.Pools {
+			pool.RemovePending = pool.Delete
+			for _, device := range pool.Devices {
+				device.RemovePending = device.Delete
+			}
+		}
+	}
+}
+
+//resyncLater processes the nodes again on the next pass to check on removals
+//that ScaleIO has not finished
+func (s *RestServer) resyncLater() {
+	s.Lock()
+	s.topologyChanged = true
+	s.Unlock()
+}
+
+//removeDevice removes a device of the node from a StoragePool. ScaleIO moves
+//the data on the device to the rest of the StoragePool first so the device is
+//only removed when the StoragePool has room for that data. Returns true once
+//the device is gone.
+func (s *RestServer) removeDevice(client *goscaleio.Client, scaleioPool *goscaleio.StoragePool,
+	scaleioSds *goscaleio.Sds, device *kvstore.Device) (bool, error) {
+	if scaleioSds == nil {
+		log.Infoln("No SDS for device", device.Name, ". It is gone.")
+		return true, nil
+	}
+
+	devices, err := scaleioPool.GetDevice()
+	if err != nil {
+		log.Errorln("GetDevice Error:", err)
+		s.Metrics.ScaleIOError("GetDevice")
+		return false, err
+	}
+
+	var tmpDevice *siotypes.Device
+	for i := range devices {
+		if devices[i].SdsID == scaleioSds.Sds.ID && devices[i].DeviceCurrentPathname == device.Name {
+			tmpDevice = &devices[i]
+			break
+		}
+	}
+	if tmpDevice == nil {
+		log.Infoln("Device removed:", device.Name)
+		return true, nil
+	}
+	if tmpDevice.DeviceState == removePending {
+		log.Infoln("Device", device.Name, "is still migrating its data")
+		return false, nil
+	}
+
+	stats, err := scaleioPool.GetStatistics()
+	if err != nil {
+		log.Errorln("GetStatistics Error:", err)
+		s.Metrics.ScaleIOError("GetStatistics")
+		return false, err
+	}
+
+	//the data has to fit in what is left without touching the spare capacity
+	capacity := stats.CapacityLimitInKb - tmpDevice.MaxCapacityInKb
+	usable := capacity * (100 - scaleioPool.StoragePool.SparePercentage) / 100
+	if stats.CapacityInUseInKb > usable {
+		log.Errorln("Unable to remove device", device.Name, ". In use:", stats.CapacityInUseInKb,
+			"KB. Usable without the device:", usable, "KB")
+		return false, common.ErrNotEnoughSpareCapacity
+	}
+
+	err = s.scaleioAction(client, "Device::"+tmpDevice.ID, "removeDevice")
+	if err != nil {
+		return false, err
+	}
+	log.Infoln("Device", device.Name, "is being removed")
+	return false, nil
+}
+
+//removePool removes a StoragePool once the devices of the node are gone. The
+//StoragePool is kept in ScaleIO while other nodes still have devices in it or
+//it still has volumes.
+func (s *RestServer) removePool(client *goscaleio.Client, scaleioPool *goscaleio.StoragePool,
+	pool *kvstore.StoragePool) (poolRemoval, error) {
+	for _, device := range pool.Devices {
+		if !device.IsRemoved() {
+			log.Infoln("StoragePool", pool.Name, "is waiting for device", device.Name)
+			return poolRemovalPending, nil
+		}
+	}
+
+	devices, err := scaleioPool.GetDevice()
+	if err != nil {
+		log.Errorln("GetDevice Error:", err)
+		s.Metrics.ScaleIOError("GetDevice")
+		return poolRemovalPending, err
+	}
+	if len(devices) > 0 {
+		log.Infoln("StoragePool", pool.Name, "still has devices on other nodes. Keep it.")
+		return poolRemovalReleased, nil
+	}
+
+	volumes, err := client.GetVolume("", "", "", "", true)
+	if err != nil {
+		log.Errorln("GetVolume Error:", err)
+		s.Metrics.ScaleIOError("GetVolume")
+		return poolRemovalPending, err
+	}
+	for _, volume := range volumes {
+		if volume.StoragePoolID == scaleioPool.StoragePool.ID {
+			log.Warnln("StoragePool", pool.Name, "still has volume", volume.Name, ". Keep it.")
+			return poolRemovalReleased, nil
+		}
+	}
+
+	err = s.scaleioAction(client, "StoragePool::"+scaleioPool.StoragePool.ID, "removeStoragePool")
+	if err != nil {
+		return poolRemovalPending, err
+	}
+	log.Infoln("StoragePool removed:", pool.Name)
+	return poolRemovalDone, nil
+}
+
+//removeSds removes an SDS of the node once the devices attached through it
+//are gone. Returns true once the SDS is gone.
+func (s *RestServer) removeSds(client *goscaleio.Client, scaleioDomain *goscaleio.ProtectionDomain,
+	domain *kvstore.ProtectionDomain, sds *kvstore.Sds, node *types.ScaleIONode) (bool, error) {
+	for _, pool := range domain.Pools {
+		for _, device := range pool.Devices {
+			if !device.IsRemoved() && deviceSdsName(node, device) == sds.Name {
+				log.Infoln("SDS", sds.Name, "is waiting for device", device.Name)
+				return false, nil
+			}
+		}
+	}
+
+	tmpSds, found, err := s.findSds(scaleioDomain, sds.Name)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		log.Infoln("SDS removed:", sds.Name)
+		return true, nil
+	}
+	if tmpSds.SdsState == removePending {
+		log.Infoln("SDS", sds.Name, "is still being removed")
+		return false, nil
+	}
+
+	err = s.scaleioAction(client, "Sds::"+tmpSds.ID, "removeSds")
+	if err != nil {
+		return false, err
+	}
+	log.Infoln("SDS", sds.Name, "is being removed")
+	s.RecordEvent(types.EventSdsRemoved, node.Hostname,
+		"SDS "+sds.Name+" removed from ProtectionDomain "+domain.Name)
+	return false, nil
+}
+
+//removeDomain removes the SDSs of the node from a ProtectionDomain once its
+//StoragePools are done and then the ProtectionDomain if nothing else is left
+//in it. Returns true once the node is done with it.
+func (s *RestServer) removeDomain(client *goscaleio.Client, scaleioDomain *goscaleio.ProtectionDomain,
+	domain *kvstore.ProtectionDomain, node *types.ScaleIONode) (bool, error) {
+	for _, pool := range domain.Pools {
+		if !pool.IsRemoved() {
+			log.Infoln("ProtectionDomain", domain.Name, "is waiting for StoragePool", pool.Name)
+			return false, nil
+		}
+	}
+
+	remaining := false
+	for _, sds := range domain.Sdss {
+		removed, err := s.removeSds(client, scaleioDomain, domain, sds, node)
+		if err != nil {
+			return false, err
+		}
+		if !removed {
+			remaining = true
+		}
+	}
+	if remaining {
+		return false, nil
+	}
+
+	sdss, err := scaleioDomain.GetSds()
+	if err != nil {
+		log.Errorln("GetSds Error:", err)
+		s.Metrics.ScaleIOError("GetSds")
+		return false, err
+	}
+	pools, err := scaleioDomain.GetStoragePool("")
+	if err != nil {
+		log.Errorln("GetStoragePool Error:", err)
+		s.Metrics.ScaleIOError("GetStoragePool")
+		return false, err
+	}
+	if len(sdss) > 0 || len(pools) > 0 {
+		log.Infoln("ProtectionDomain", domain.Name, "is still used by other nodes. Keep it.")
+		return true, nil
+	}
+
+	err = s.scaleioAction(client, "ProtectionDomain::"+scaleioDomain.ProtectionDomain.ID,
+		"removeProtectionDomain")
+	if err != nil {
+		return false, err
+	}
+	log.Infoln("ProtectionDomain removed:", domain.Name)
+	s.RecordEvent(types.EventDomainRemoved, node.Hostname, "ProtectionDomain "+domain.Name+" removed")
+	return true, nil
+}
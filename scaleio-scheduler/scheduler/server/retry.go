@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//maxFailureOutput is the most output kept for a failed step. The end of
+	//the output is kept since that is where the error is.
+	maxFailureOutput = 16384
+)
+
+//retryBackoff is how long to wait before retrying a step that has already
+//been retried the number of times given. The wait doubles on every retry up
+//to RetryBackoffMax.
+func (s *RestServer) retryBackoff(retries int) time.Duration {
+	backoff := s.Config.RetryBackoff
+	for i := 0; i < retries && backoff < s.Config.RetryBackoffMax; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > s.Config.RetryBackoffMax {
+		backoff = s.Config.RetryBackoffMax
+	}
+	return backoff
+}
+
+//recordFailure remembers the step that failed on a node which is about to move
+//to StateFatalInstall and schedules the next retry. Retries are counted per
+//step so failing in the same state again keeps the count. The caller must
+//hold the lock.
+func (s *RestServer) recordFailure(node *types.ScaleIONode, update *types.UpdateNode) {
+	output := update.Output
+	if len(output) > maxFailureOutput {
+		output = output[len(output)-maxFailureOutput:]
+	}
+
+	now := time.Now()
+	failure := &types.NodeFailure{
+		State:     node.State,
+		Step:      update.FailedStep,
+		Output:    output,
+		Timestamp: now.Unix(),
+	}
+	if node.Failure != nil && node.Failure.State == node.State {
+		failure.Retries = node.Failure.Retries
+	}
+
+	message := "Step " + failure.Step + " failed in state " + common.StateIDToString(failure.State)
+	if len(failure.Step) == 0 {
+		message = "Failed in state " + common.StateIDToString(failure.State)
+	}
+	if failure.Retries < s.Config.RetryLimit {
+		backoff := s.retryBackoff(failure.Retries)
+		failure.NextRetry = now.Add(backoff).Unix()
+		message += ". Retry in " + backoff.String()
+	} else {
+		message += ". No retries left"
+	}
+	node.Failure = failure
+
+	s.RecordEvent(types.EventNodeFailed, node.Hostname, message)
+}
+
+//RetryNode moves a node in StateFatalInstall back to the state it failed in
+//so the executor runs that step again. The caller must hold the lock.
+func (s *RestServer) RetryNode(node *types.ScaleIONode, reason string) error {
+	if !types.IsValidRetry(node.State, node.Failure) {
+		return types.ErrInvalidStateTransition
+	}
+
+	node.Failure.Retries++
+	node.Failure.NextRetry = 0
+	s.recordTransition(node, node.Failure.State, reason)
+
+	err := s.Store.SetNodeInfo(node.Hostname, node.Persona, node.State)
+	if err == nil {
+		err = s.Store.SetNodeRecord(node)
+	}
+	return err
+}
+
+//retryFailedNodes retries the failed steps that are due
+func (s *RestServer) retryFailedNodes() {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().Unix()
+	for _, node := range s.State.ScaleIO.Nodes {
+		if node.State != types.StateFatalInstall || node.Failure == nil {
+			continue
+		}
+		if node.Failure.NextRetry == 0 || node.Failure.NextRetry > now {
+			continue
+		}
+		if node.Maintenance {
+			log.Debugln("Node", node.Hostname, "is in maintenance. Skip retry!")
+			continue
+		}
+
+		err := s.RetryNode(node, "Retry "+strconv.Itoa(node.Failure.Retries+1)+" of "+
+			strconv.Itoa(s.Config.RetryLimit))
+		if err != nil {
+			log.Warnln("Failed to retry node", node.Hostname, ":", err)
+		}
+	}
+}
+
+func retryNode(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	hostname := mux.Vars(r)["hostname"]
+
+	server.Lock()
+	node := common.FindScaleIONodeByHostname(server.State.ScaleIO.Nodes, hostname)
+	if node == nil {
+		server.Unlock()
+		writeError(w, "Unable to find the Node", http.StatusNotFound)
+		return
+	}
+
+	err := server.RetryNode(node, "Retried by an operator")
+	if err == types.ErrInvalidStateTransition {
+		state := node.State
+		server.Unlock()
+		writeError(w, "Only a node in state "+common.StateIDToString(types.StateFatalInstall)+
+			" with a failed step can be retried. The node is in state "+
+			common.StateIDToString(state), http.StatusConflict)
+		return
+	}
+	info := server.newNodeInfo(node)
+	server.Unlock()
+
+	if err != nil {
+		writeError(w, "SetNodeInfo Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
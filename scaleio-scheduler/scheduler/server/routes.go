@@ -0,0 +1,433 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//route describes an endpoint of the REST API. Path is relative to
+//types.APIPrefix and Legacy is the unversioned path kept as an alias.
+type route struct {
+	Method   string
+	Path     string
+	Legacy   string
+	Scope    int
+	Summary  string
+	Query    []string
+	Request  interface{}
+	Response interface{}
+	Produces string
+	Handler  func(w http.ResponseWriter, r *http.Request, server *RestServer)
+}
+
+//apiRoutes is the contract of the REST API. The OpenAPI document is
+//generated from this table so keep them together.
+func apiRoutes() []*route {
+	return []*route{
+		{
+			Method:  "GET",
+			Path:    "/scaleio-executor",
+			Legacy:  "/scaleio-executor",
+			Scope:   scopeExecutor,
+			Summary: "Download the executor binary",
+			Query:   []string{"executor", "token"},
+			Handler: downloadExecutor,
+		},
+		{
+			Method:   "GET",
+			Path:     "/version",
+			Legacy:   "/version",
+			Scope:    scopePublic,
+			Summary:  "Get the version of the scheduler",
+			Response: types.Version{},
+			Handler:  getVersion,
+		},
+		{
+			Method:   "GET",
+			Path:     "/openapi.json",
+			Scope:    scopePublic,
+			Summary:  "Get the OpenAPI description of this API",
+			Response: map[string]interface{}{},
+			Handler:  getOpenAPI,
+		},
+		{
+			Method:   "GET",
+			Path:     "/state",
+			Legacy:   "/api/state",
+			Scope:    scopeRead,
+			Summary:  "Get the state of the framework",
+			Query:    []string{"since", "wait"},
+			Response: types.ScaleIOFramework{},
+			Handler:  getState,
+		},
+		{
+			Method:   "POST",
+			Path:     "/state",
+			Legacy:   "/api/state",
+			Scope:    scopeExecutor,
+			Summary:  "Mark the cluster as configured",
+			Request:  types.UpdateCluster{},
+			Response: types.UpdateCluster{},
+			Handler:  setState,
+		},
+		{
+			Method:   "GET",
+			Path:     "/watch",
+			Scope:    scopeRead,
+			Summary:  "Stream changes to the state as Server-Sent Events",
+			Query:    []string{"since"},
+			Response: types.Delta{},
+			Handler:  getWatch,
+		},
+		{
+			Method:   "GET",
+			Path:     "/metrics",
+			Legacy:   "/metrics",
+			Scope:    scopeRead,
+			Summary:  "Get metrics in the Prometheus text format",
+			Produces: "text/plain",
+			Handler:  getMetrics,
+		},
+		{
+			Method:   "GET",
+			Path:     "/events",
+			Legacy:   "/api/events",
+			Scope:    scopeRead,
+			Summary:  "List the events in the journal",
+			Query:    []string{"since", "limit"},
+			Response: []types.Event{},
+			Handler:  getEvents,
+		},
+		{
+			Method:   "GET",
+			Path:     "/nodes",
+			Legacy:   "/api/nodes",
+			Scope:    scopeRead,
+			Summary:  "List the nodes",
+			Query:    []string{"persona", "state"},
+			Response: []types.NodeInfo{},
+			Handler:  getNodes,
+		},
+		{
+			Method:   "GET",
+			Path:     "/nodes/{hostname}",
+			Legacy:   "/api/nodes/{hostname}",
+			Scope:    scopeRead,
+			Summary:  "Get a node",
+			Response: types.NodeInfo{},
+			Handler:  getNode,
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/nodes/{hostname}",
+			Scope:    scopeAdmin,
+			Summary:  "Decommission a data node and remove it from ScaleIO",
+			Response: types.NodeInfo{},
+			Handler:  deleteNode,
+		},
+		{
+			Method:   "POST",
+			Path:     "/nodes/{hostname}/reset",
+			Scope:    scopeAdmin,
+			Summary:  "Start the install of a failed node over",
+			Response: types.NodeInfo{},
+			Handler:  resetNode,
+		},
+		{
+			Method:   "POST",
+			Path:     "/nodes/{hostname}/retry",
+			Scope:    scopeAdmin,
+			Summary:  "Run the step that failed on a node again",
+			Response: types.NodeInfo{},
+			Handler:  retryNode,
+		},
+		{
+			Method:   "POST",
+			Path:     "/nodes/{hostname}/maintenance",
+			Scope:    scopeAdmin,
+			Summary:  "Put a node in or take it out of maintenance",
+			Request:  types.NodeMaintenance{},
+			Response: types.NodeMaintenance{},
+			Handler:  setNodeMaintenance,
+		},
+		{
+			Method:   "GET",
+			Path:     "/topology",
+			Scope:    scopeRead,
+			Summary:  "Get the declared topology",
+			Response: types.Topology{},
+			Handler:  getTopology,
+		},
+		{
+			Method:   "PUT",
+			Path:     "/topology",
+			Scope:    scopeAdmin,
+			Summary:  "Declare the ProtectionDomains, StoragePools and devices of the cluster",
+			Request:  types.Topology{},
+			Response: types.Topology{},
+			Handler:  setTopology,
+		},
+		{
+			Method:   "GET",
+			Path:     "/health",
+			Scope:    scopeRead,
+			Summary:  "Get the last health check of the ScaleIO cluster",
+			Response: types.ClusterHealth{},
+			Handler:  getHealth,
+		},
+		{
+			Method:   "GET",
+			Path:     "/reboots",
+			Scope:    scopeRead,
+			Summary:  "List the nodes holding a reboot lease",
+			Response: []types.RebootLease{},
+			Handler:  getRebootLeases,
+		},
+		{
+			Method:   "GET",
+			Path:     "/upgrade",
+			Scope:    scopeRead,
+			Summary:  "Get the progress of the last rolling upgrade",
+			Response: types.Upgrade{},
+			Handler:  getUpgrade,
+		},
+		{
+			Method:   "POST",
+			Path:     "/upgrade",
+			Scope:    scopeAdmin,
+			Summary:  "Start a rolling upgrade to new ScaleIO packages",
+			Request:  types.UpgradeRequest{},
+			Response: types.Upgrade{},
+			Handler:  startUpgrade,
+		},
+		{
+			Method:   "POST",
+			Path:     "/upgrade/pause",
+			Scope:    scopeAdmin,
+			Summary:  "Pause the rolling upgrade after the node being upgraded",
+			Response: types.Upgrade{},
+			Handler:  pauseUpgrade,
+		},
+		{
+			Method:   "POST",
+			Path:     "/upgrade/resume",
+			Scope:    scopeAdmin,
+			Summary:  "Resume a paused rolling upgrade",
+			Response: types.Upgrade{},
+			Handler:  resumeUpgrade,
+		},
+		{
+			Method:   "POST",
+			Path:     "/upgrade/rollback",
+			Scope:    scopeAdmin,
+			Summary:  "Roll back the upgraded nodes to the previous packages",
+			Response: types.Upgrade{},
+			Handler:  rollbackUpgrade,
+		},
+		{
+			Method:   "GET",
+			Path:     "/volumes",
+			Scope:    scopeRead,
+			Summary:  "List the volumes",
+			Query:    []string{"snapshots"},
+			Response: []types.VolumeInfo{},
+			Handler:  getVolumes,
+		},
+		{
+			Method:   "POST",
+			Path:     "/volumes",
+			Scope:    scopeAdmin,
+			Summary:  "Create a volume",
+			Request:  types.CreateVolume{},
+			Response: types.VolumeInfo{},
+			Handler:  createScaleioVolume,
+		},
+		{
+			Method:   "GET",
+			Path:     "/volumes/{name}",
+			Scope:    scopeRead,
+			Summary:  "Get a volume",
+			Response: types.VolumeInfo{},
+			Handler:  getScaleioVolume,
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/volumes/{name}",
+			Scope:    scopeAdmin,
+			Summary:  "Delete a volume that is not mapped",
+			Response: types.VolumeInfo{},
+			Handler:  deleteVolume,
+		},
+		{
+			Method:   "POST",
+			Path:     "/volumes/{name}/resize",
+			Scope:    scopeAdmin,
+			Summary:  "Grow a volume",
+			Request:  types.ResizeVolume{},
+			Response: types.VolumeInfo{},
+			Handler:  resizeVolume,
+		},
+		{
+			Method:   "POST",
+			Path:     "/volumes/{name}/map",
+			Scope:    scopeAdmin,
+			Summary:  "Map a volume to the SDC on a node",
+			Request:  types.VolumeMapping{},
+			Response: types.VolumeInfo{},
+			Handler:  mapVolume,
+		},
+		{
+			Method:   "POST",
+			Path:     "/volumes/{name}/unmap",
+			Scope:    scopeAdmin,
+			Summary:  "Unmap a volume from the SDC on a node",
+			Request:  types.VolumeMapping{},
+			Response: types.VolumeInfo{},
+			Handler:  unmapVolume,
+		},
+		{
+			Method:   "GET",
+			Path:     "/snapshots/policies",
+			Scope:    scopeRead,
+			Summary:  "List the snapshot policies and their last run",
+			Response: []types.SnapshotPolicy{},
+			Handler:  getSnapshotPolicies,
+		},
+		{
+			Method:   "GET",
+			Path:     "/snapshots/policies/{name}",
+			Scope:    scopeRead,
+			Summary:  "Get a snapshot policy and its last run",
+			Response: types.SnapshotPolicy{},
+			Handler:  getSnapshotPolicy,
+		},
+		{
+			Method:   "PUT",
+			Path:     "/snapshots/policies/{name}",
+			Scope:    scopeAdmin,
+			Summary:  "Create or replace a snapshot policy",
+			Request:  types.SnapshotPolicy{},
+			Response: types.SnapshotPolicy{},
+			Handler:  setSnapshotPolicy,
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/snapshots/policies/{name}",
+			Scope:    scopeAdmin,
+			Summary:  "Delete a snapshot policy. The snapshots it took are kept",
+			Response: types.SnapshotPolicy{},
+			Handler:  deleteSnapshotPolicy,
+		},
+		{
+			Method:   "GET",
+			Path:     "/capacity",
+			Scope:    scopeRead,
+			Summary:  "Get the capacity of the cluster and each StoragePool",
+			Response: types.Capacity{},
+			Handler:  getCapacity,
+		},
+		{
+			Method:   "POST",
+			Path:     "/expand",
+			Scope:    scopeAdmin,
+			Summary:  "Expand all StoragePools in AWS",
+			Response: []types.PoolCapacity{},
+			Handler:  expandStoragePools,
+		},
+		{
+			Method:   "POST",
+			Path:     "/node/credentials",
+			Legacy:   "/api/node/credentials",
+			Scope:    scopeExecutor,
+			Summary:  "Get the secrets for an executor",
+			Request:  types.NodeCredentials{},
+			Response: types.NodeCredentials{},
+			Handler:  getNodeCredentials,
+		},
+		{
+			Method:   "POST",
+			Path:     "/node/state",
+			Legacy:   "/api/node/state",
+			Scope:    scopeExecutor,
+			Summary:  "Update the install state of a node",
+			Request:  types.UpdateNode{},
+			Response: types.UpdateNode{},
+			Handler:  setNodeState,
+		},
+		{
+			Method:   "POST",
+			Path:     "/node/device",
+			Legacy:   "/api/node/device",
+			Scope:    scopeExecutor,
+			Summary:  "Advertise the devices on a node",
+			Request:  types.UpdateDevices{},
+			Response: types.UpdateDevices{},
+			Handler:  setNodeDevices,
+		},
+		{
+			Method:   "POST",
+			Path:     "/node/ping",
+			Legacy:   "/api/node/ping",
+			Scope:    scopeExecutor,
+			Summary:  "Tell the scheduler a node is alive",
+			Request:  types.PingNode{},
+			Response: types.PingNode{},
+			Handler:  setNodePing,
+		},
+		{
+			Method:   "POST",
+			Path:     "/node/reboot",
+			Scope:    scopeExecutor,
+			Summary:  "Ask for or give back the lease to reboot a node",
+			Request:  types.RebootLease{},
+			Response: types.RebootLease{},
+			Handler:  setNodeReboot,
+		},
+		{
+			Method:   "POST",
+			Path:     "/debug/fake",
+			Legacy:   "/api/fake",
+			Scope:    scopeAdmin,
+			Summary:  "Simulate used data. Only available in debug mode",
+			Request:  types.UpdateUsedData{},
+			Response: types.UpdateUsedData{},
+			Handler:  setFakeData,
+		},
+	}
+}
+
+//addRoutes registers each route under types.APIPrefix and its legacy alias
+func (s *RestServer) addRoutes(router *mux.Router) {
+	for _, rt := range apiRoutes() {
+		handler := rt.Handler
+		wrapped := s.authorize(rt.Scope, func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r, s)
+		})
+
+		router.HandleFunc(types.APIPrefix+rt.Path, wrapped).Methods(rt.Method)
+		if len(rt.Legacy) > 0 {
+			router.HandleFunc(rt.Legacy, wrapped).Methods(rt.Method)
+		}
+	}
+}
+
+//writeError returns a structured error in place of http.Error
+func writeError(w http.ResponseWriter, message string, code int) {
+	apiErr := &types.APIError{
+		Code:    code,
+		Status:  http.StatusText(code),
+		Message: message,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(apiErr); err != nil {
+		log.Warnln("Unable to write the error response:", err)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//ExecutorToken returns the token the given executor uses to authenticate
+func (s *RestServer) ExecutorToken(executorID string) string {
+	mac := hmac.New(sha256.New, s.secretKey)
+	mac.Write([]byte(executorID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
+
+func (s *RestServer) isValidExecutorToken(executorID string, token string) bool {
+	if len(executorID) == 0 || len(token) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(s.ExecutorToken(executorID)), []byte(token))
+}
+
+//redactState removes all secrets from a copy of the state
+func redactState(state *types.ScaleIOFramework) *types.ScaleIOFramework {
+	state.ScaleIO.AdminPassword = types.RedactedSecret
+	return state
+}
+
+func getNodeCredentials(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	creds := &types.NodeCredentials{
+		Acknowledged: false,
+		ExecutorID:   "",
+		KeyValue:     make(map[string]string),
+	}
+	if err := json.Unmarshal(body, &creds); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	if !isCallerExecutor(r, creds.ExecutorID) {
+		log.Warnln("Rejected credentials request for", creds.ExecutorID, "from", r.RemoteAddr)
+		writeError(w, "Invalid executor token", http.StatusUnauthorized)
+		return
+	}
+
+	server.Lock()
+	node := common.FindScaleIONodeByExecutorID(server.State.ScaleIO.Nodes, creds.ExecutorID)
+	creds.AdminPassword = server.State.ScaleIO.AdminPassword
+	server.Unlock()
+
+	if node == nil {
+		writeError(w, "Unable to find the Executor", http.StatusBadRequest)
+		return
+	}
+
+	creds.Acknowledged = true
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(creds); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -1,13 +1,15 @@
 package server
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
 	negroni "github.com/codegangsta/negroni"
 	"github.com/gorilla/mux"
 
@@ -29,6 +31,27 @@ type RestServer struct {
 	State  *types.ScaleIOFramework
 	Index  int
 
+	Metrics *Metrics
+
+	//KillTask asks Mesos to kill the task of a node. Set by the scheduler.
+	KillTask func(node *types.ScaleIONode)
+
+	//connectScaleIO logs in to the ScaleIO Gateway. The tests point it at a
+	//fake Gateway. Guarded by the lock.
+	connectScaleIO func(state *types.ScaleIOFramework) (*goscaleio.Client, error)
+
+	secretKey       []byte
+	instanceID      string
+	deltas          *deltaHub
+	changed         chan struct{}
+	events          chan *types.Event
+	expandRequested bool
+	topology        *types.Topology
+	topologyChanged bool
+	upgrade         *types.Upgrade
+	rebootLeases    map[string]*types.RebootLease
+	health          *types.ClusterHealth
+
 	sync.Mutex
 }
 
@@ -38,7 +61,7 @@ func NewRestServer(cfg *config.Config, store *kvstore.KvStore) *RestServer {
 		cfg.TieBreakerMdmAddress != ""
 
 	scaleio := &types.ScaleIOFramework{
-		SchedulerAddress: fmt.Sprintf("http://%s:%d", cfg.RestAddress, cfg.RestPort),
+		SchedulerAddress: cfg.RestURI(),
 		LogLevel:         cfg.LogLevel,
 		Debug:            cfg.Debug,
 		Experimental:     cfg.Experimental,
@@ -88,55 +111,106 @@ func NewRestServer(cfg *config.Config, store *kvstore.KvStore) *RestServer {
 		},
 	}
 
+	//restore the node registry so executors can find themselves after a restart
+	nodes, err := store.GetNodeRecords()
+	if err != nil {
+		log.Warnln("Unable to restore nodes from the store:", err)
+	}
+	for _, node := range nodes {
+		log.Infoln("Restored node", node.Hostname, "from the store")
+		if node.Imperative {
+			scaleio.ScaleIO.AtLeastOneImperative = true
+		}
+		scaleio.ScaleIO.Nodes = append(scaleio.ScaleIO.Nodes, node)
+	}
+
+	secretKey, err := store.GetSecretKey()
+	if err != nil {
+		log.Errorln("Unable to get the secret key from the store. Executor tokens",
+			"will not survive a restart. Err:", err)
+		secretKey = make([]byte, 32)
+		rand.Read(secretKey)
+	}
+
+	//revisions start over when the scheduler restarts. The instance ID tells
+	//the revisions of this run apart from the ones of the last run.
+	instanceID := make([]byte, 8)
+	rand.Read(instanceID)
+
 	restServer := &RestServer{
-		Config: cfg,
-		Store:  store,
-		State:  scaleio,
-		Index:  1,
+		Config:     cfg,
+		Store:      store,
+		State:      scaleio,
+		Index:      1,
+		Metrics:    NewMetrics(),
+		secretKey:  secretKey,
+		instanceID: hex.EncodeToString(instanceID),
+		deltas:     newDeltaHub(),
+		changed:    make(chan struct{}),
+		events:     make(chan *types.Event, eventQueueSize),
+
+		rebootLeases: make(map[string]*types.RebootLease),
+	}
+	restServer.connectScaleIO = restServer.createScaleioClient
+
+	//the topology declared through the REST API, if any
+	topology, err := store.GetTopology()
+	if err == nil {
+		log.Infoln("Restored the topology from the store")
+		restServer.topology = topology
+	}
+
+	//the last rolling upgrade picks up where it left off
+	upgrade, err := store.GetUpgrade()
+	if err == nil {
+		log.Infoln("Restored the upgrade from the store")
+		restServer.upgrade = upgrade
+	}
+
+	//nodes that were rebooting keep their leases until they expire
+	leases, err := store.GetRebootLeases()
+	if err == nil {
+		log.Infoln("Restored", len(leases), "reboot leases from the store")
+		restServer.rebootLeases = leases
 	}
 
 	mux := mux.NewRouter()
-	mux.HandleFunc("/scaleio-executor", func(w http.ResponseWriter, r *http.Request) {
-		downloadExecutor(w, r, restServer)
-	}).Methods("GET")
-	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
-		getVersion(w, r, restServer)
-	}).Methods("GET")
-	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
-		getState(w, r, restServer)
-	}).Methods("GET")
-	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
-		setState(w, r, restServer)
-	}).Methods("POST")
-	mux.HandleFunc("/api/node/state", func(w http.ResponseWriter, r *http.Request) {
-		setNodeState(w, r, restServer)
-	}).Methods("POST")
-	mux.HandleFunc("/api/node/device", func(w http.ResponseWriter, r *http.Request) {
-		setNodeDevices(w, r, restServer)
-	}).Methods("POST")
-	mux.HandleFunc("/api/node/ping", func(w http.ResponseWriter, r *http.Request) {
-		setNodePing(w, r, restServer)
-	}).Methods("POST")
-	mux.HandleFunc("/api/fake", func(w http.ResponseWriter, r *http.Request) {
-		setFakeData(w, r, restServer)
-	}).Methods("POST")
-	mux.HandleFunc("/ui", func(w http.ResponseWriter, r *http.Request) {
-		displayState(w, r, restServer)
-	}).Methods("GET")
-	//TODO delete this below when a real UI is embedded
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		displayState(w, r, restServer)
-	}).Methods("GET")
+	restServer.addRoutes(mux)
+	mux.HandleFunc("/ui", getUI).Methods("GET")
+	mux.HandleFunc("/", getUI).Methods("GET")
 	server := negroni.Classic()
 	server.UseHandler(mux)
 
+	if len(cfg.RestAdminToken) == 0 {
+		log.Warnln("No admin token is configured. Admin endpoints are disabled.")
+	}
+
 	//Run is a blocking call for Negroni... so go routine it
 	go func() {
-		server.Run(cfg.RestAddress + ":" + strconv.Itoa(cfg.RestPort))
+		addr := cfg.RestAddress + ":" + strconv.Itoa(cfg.RestPort)
+		if cfg.IsRestTLS() {
+			log.Infoln("Listening on", addr, "with TLS")
+			err := http.ListenAndServeTLS(addr, cfg.RestTLSCert, cfg.RestTLSKey, server)
+			log.Fatalln("ListenAndServeTLS:", err)
+		} else {
+			server.Run(addr)
+		}
 	}()
 
 	restServer.Server = server
 
+	//JournalEvents writes the recorded events to the store
+	go restServer.JournalEvents()
+
+	//WatchStore applies changes made directly in the store
+	go restServer.WatchStore()
+
+	//MonitorLiveness tracks which executors are still pinging
+	go restServer.MonitorLiveness()
+
+	//MonitorHealth checks the ScaleIO cluster once it is configured
+	go restServer.MonitorHealth()
+
 	//MonitorForState watch for state changes
 	go func() {
 		err := restServer.MonitorForState()
@@ -151,6 +225,7 @@ func NewRestServer(cfg *config.Config, store *kvstore.KvStore) *RestServer {
 func cloneState(src *types.ScaleIOFramework) *types.ScaleIOFramework {
 	dst := &types.ScaleIOFramework{}
 
+	dst.Revision = src.Revision
 	dst.Debug = src.Debug
 	dst.Experimental = src.Experimental
 	dst.LogLevel = src.LogLevel
@@ -207,13 +282,28 @@ func cloneState(src *types.ScaleIOFramework) *types.ScaleIOFramework {
 			Hostname:        node.Hostname,
 			Persona:         node.Persona,
 			State:           node.State,
+			PreviousState:   node.PreviousState,
+			StateChanged:    node.StateChanged,
+			StateReason:     node.StateReason,
 			LastContact:     node.LastContact,
+			Liveness:        node.Liveness,
+			TaskState:       node.TaskState,
 			Imperative:      node.Imperative,
 			Advertised:      node.Advertised,
+			Maintenance:     node.Maintenance,
 			KeyValue:        make(map[string]string),
 			ProvidesDomains: make(map[string]*types.ProtectionDomain),
 			ConsumesDomains: make(map[string]*types.ProtectionDomain),
 		}
+		if node.Failure != nil {
+			failure := *node.Failure
+			dstNode.Failure = &failure
+		}
+		if node.Decommission != nil {
+			decommission := *node.Decommission
+			decommission.Removing = append([]string{}, node.Decommission.Removing...)
+			dstNode.Decommission = &decommission
+		}
 		for key, val := range node.KeyValue {
 			dstNode.KeyValue[key] = val
 		}
@@ -226,6 +316,14 @@ func cloneState(src *types.ScaleIOFramework) *types.ScaleIOFramework {
 			for key, val := range pDomain.KeyValue {
 				dstPDomain.KeyValue[key] = val
 			}
+			for _, pSds := range pDomain.Sdss {
+				dstPDomain.Sdss = append(dstPDomain.Sdss, &types.Sds{
+					Name:    pSds.Name,
+					IPs:     append([]string{}, pSds.IPs...),
+					Port:    pSds.Port,
+					Devices: append([]string{}, pSds.Devices...),
+				})
+			}
 			for keyPool, pPool := range pDomain.Pools {
 				dstPool := &types.StoragePool{
 					Name:     pPool.Name,
@@ -282,26 +380,68 @@ func (s *RestServer) MonitorForState() error {
 	for {
 		time.Sleep(time.Duration(common.PollStatusInSeconds) * time.Second)
 
+		s.retryFailedNodes()
+
 		//must make a copy of the state because these operations can take a long time
 		s.Lock()
 		copyState := cloneState(s.State)
+		expandNow := s.expandRequested
+		s.expandRequested = false
+		resync := s.topologyChanged && s.State.ScaleIO.Configured
+		if resync {
+			s.topologyChanged = false
+		}
 		s.Unlock()
 
 		if common.SyncRunState(copyState, types.StateAddResourcesToScaleIO, true) {
+			//offline data nodes that are behind are added when they come back
+			ready := make([]*types.ScaleIONode, 0)
+			for _, node := range copyState.ScaleIO.Nodes {
+				if node.State >= types.StateAddResourcesToScaleIO {
+					ready = append(ready, node)
+				}
+			}
+			copyState.ScaleIO.Nodes = ready
+
 			log.Debugln("Calling addResourcesToScaleIO()...")
+			start := time.Now()
+			err := s.addResourcesToScaleIO(copyState)
+			s.Metrics.AddResourcesDuration(time.Since(start))
+			if err != nil {
+				log.Errorln("addResourcesToScaleIO err:", err)
+			}
+			s.updateNodeState(types.StateInstallRexRay, "Resources added to ScaleIO")
+		} else if resync {
+			//only nodes that are past adding resources have an SDS to change
+			installed := make([]*types.ScaleIONode, 0)
+			for _, node := range copyState.ScaleIO.Nodes {
+				if node.State >= types.StateInstallRexRay && node.State != types.StateFatalInstall {
+					installed = append(installed, node)
+				}
+			}
+			copyState.ScaleIO.Nodes = installed
+
+			log.Debugln("Calling addResourcesToScaleIO() for the new topology...")
+			start := time.Now()
 			err := s.addResourcesToScaleIO(copyState)
+			s.Metrics.AddResourcesDuration(time.Since(start))
 			if err != nil {
 				log.Errorln("addResourcesToScaleIO err:", err)
 			}
-			s.updateNodeState(types.StateInstallRexRay)
 		}
 		//to add more else if { SyncRunState(otherState) }
 
+		if copyState.ScaleIO.Configured {
+			s.runSnapshotPolicies()
+			s.progressUpgrade()
+		}
+		s.progressDecommissions()
+
 		//if in AWS, check for full and expand if needed
-		if !copyState.ScaleIO.AtLeastOneImperative && (cnt%uint64(s.Config.CheckFull)) == 0 &&
-			len(s.Config.AccessKey) > 0 && len(s.Config.SecretKey) > 0 {
+		if !copyState.ScaleIO.AtLeastOneImperative && (expandNow || (cnt%uint64(s.Config.CheckFull)) == 0) &&
+			s.isAwsConfigured() {
 			log.Debugln("Calling checkForFull()...")
-			pairDomainPool, errCheck := s.checkForFull(copyState)
+			pairDomainPool, errCheck := s.checkForFull(copyState, expandNow)
 			if errCheck != nil {
 				log.Errorln("checkForFull err:", errCheck)
 			} else if len(pairDomainPool.Pools) == 0 {
@@ -321,14 +461,19 @@ func (s *RestServer) MonitorForState() error {
 	return err
 }
 
-func (s *RestServer) updateNodeState(state int) {
+func (s *RestServer) updateNodeState(state int, reason string) {
 	s.Lock()
 
-	for i := 0; i < len(s.State.ScaleIO.Nodes); i++ {
-		if s.State.ScaleIO.Nodes[i].State > state { //only update state if less than current
+	for _, node := range s.State.ScaleIO.Nodes {
+		if !types.IsValidTransition(node.State, state) { //only nodes that can move to the state
 			continue
 		}
-		s.State.ScaleIO.Nodes[i].State = state
+
+		//save the state so the store watcher doesnt see a stale value
+		_, err := s.TransitionNode(node, state, reason)
+		if err != nil {
+			log.Warnln("Failed to save state for", node.Hostname, ":", err)
+		}
 	}
 
 	s.Unlock()
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha512"
 	"encoding/json"
@@ -8,16 +9,22 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
+	siotypes "github.com/codedellemc/goscaleio/types/v1"
+	store "github.com/docker/libkv/store"
 	assert "github.com/stretchr/testify/assert"
 
 	config "github.com/codedellemc/scaleio-framework/scaleio-scheduler/config"
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
 	kvstore "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/kvstore"
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
@@ -25,6 +32,7 @@ import (
 const (
 	TestInputFile  = "/tmp/inputfile.txt"
 	TestOutputFile = "/tmp/outputfile.txt"
+	TestAdminToken = "admintoken"
 )
 
 var server *RestServer
@@ -37,6 +45,8 @@ func TestMain(m *testing.M) {
 	cfg := config.NewConfig()
 	cfg.Store = "boltdb"
 	cfg.StoreURI = "/tmp/bolt-test"
+	cfg.RestAdminToken = TestAdminToken
+	os.Remove(cfg.StoreURI)
 
 	//store
 	store, err := kvstore.NewKvStore(cfg)
@@ -52,24 +62,28 @@ func TestMain(m *testing.M) {
 	server.State.ScaleIO.Nodes = append(server.State.ScaleIO.Nodes, &types.ScaleIONode{
 		AgentID:    "127.0.0.1",
 		ExecutorID: "executor1",
+		Hostname:   "node1",
 		Persona:    types.PersonaMdmPrimary,
-		State:      types.StateUnknown,
+		State:      types.StateCleanPrereqsReboot,
 	})
 	server.State.ScaleIO.Nodes = append(server.State.ScaleIO.Nodes, &types.ScaleIONode{
 		AgentID:    "127.0.0.2",
 		ExecutorID: "executor2",
+		Hostname:   "node2",
 		Persona:    types.PersonaMdmSecondary,
 		State:      types.StateUnknown,
 	})
 	server.State.ScaleIO.Nodes = append(server.State.ScaleIO.Nodes, &types.ScaleIONode{
 		AgentID:    "127.0.0.3",
 		ExecutorID: "executor3",
+		Hostname:   "node3",
 		Persona:    types.PersonaTb,
 		State:      types.StateUnknown,
 	})
 	server.State.ScaleIO.Nodes = append(server.State.ScaleIO.Nodes, &types.ScaleIONode{
 		AgentID:    "127.0.0.4",
 		ExecutorID: "executor4",
+		Hostname:   "node4",
 		Persona:    types.PersonaNode,
 		State:      types.StateUnknown,
 	})
@@ -84,6 +98,24 @@ func TestMain(m *testing.M) {
 	m.Run()
 }
 
+func setExecutorAuth(req *http.Request, executorID string) {
+	req.Header.Set("Authorization", "Bearer "+server.ExecutorToken(executorID))
+	req.Header.Set(types.ExecutorIDHeader, executorID)
+}
+
+func setAdminAuth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+TestAdminToken)
+}
+
+func getAsAdmin(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setAdminAuth(req)
+	return http.DefaultClient.Do(req)
+}
+
 func TestDownload(t *testing.T) {
 	//create a test file to serve
 	input, err := os.Create(TestInputFile)
@@ -100,7 +132,8 @@ func TestDownload(t *testing.T) {
 
 	//get the "executor" file
 	resp, err := http.Get("http://" + server.Config.RestAddress + ":" +
-		strconv.Itoa(server.Config.RestPort) + "/scaleio-executor")
+		strconv.Itoa(server.Config.RestPort) + "/scaleio-executor?executor=executor1&token=" +
+		server.ExecutorToken("executor1"))
 
 	assert.Equal(t, resp.StatusCode, http.StatusOK)
 
@@ -136,7 +169,7 @@ func TestDownload(t *testing.T) {
 
 func TestVersion(t *testing.T) {
 	url := "http://" + server.Config.RestAddress + ":" +
-		strconv.Itoa(server.Config.RestPort) + "/version"
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/version"
 
 	req, err := http.NewRequest("GET", url, nil)
 	//req.Header.Set("X-Custom-Header", "myvalue")
@@ -163,6 +196,34 @@ func TestVersion(t *testing.T) {
 	assert.Equal(t, ver.VersionStr, config.VersionStr)
 }
 
+func TestOpenAPI(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/openapi.json"
+
+	resp, err := http.Get(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var doc struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	err = json.Unmarshal(body, &doc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "3.0.0", doc.OpenAPI)
+	assert.NotNil(t, doc.Paths["/state"]["get"])
+	assert.NotNil(t, doc.Paths["/state"]["post"])
+	assert.NotNil(t, doc.Paths["/nodes/{hostname}"]["get"])
+}
+
 func TestState(t *testing.T) {
 	url := "http://" + server.Config.RestAddress + ":" +
 		strconv.Itoa(server.Config.RestPort) + "/api/state"
@@ -170,6 +231,7 @@ func TestState(t *testing.T) {
 	req, err := http.NewRequest("GET", url, nil)
 	//req.Header.Set("X-Custom-Header", "myvalue")
 	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -191,7 +253,7 @@ func TestState(t *testing.T) {
 	assert.Equal(t, "scaleio", state.ScaleIO.ClusterName)
 	assert.Equal(t, "default", state.ScaleIO.ProtectionDomain)
 	assert.Equal(t, "default", state.ScaleIO.StoragePool)
-	assert.Equal(t, "Scaleio123", state.ScaleIO.AdminPassword)
+	assert.Equal(t, types.RedactedSecret, state.ScaleIO.AdminPassword)
 
 	for _, node := range state.ScaleIO.Nodes {
 		switch node.ExecutorID {
@@ -213,6 +275,114 @@ func TestState(t *testing.T) {
 	assert.Equal(t, "mymdm", state.ScaleIO.Ubuntu14.Mdm)
 }
 
+func TestStateRevision(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/state"
+
+	resp, err := getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var state types.ScaleIOFramework
+	err = json.NewDecoder(resp.Body).Decode(&state)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, stateETag(server.instanceID, state.Revision), etag)
+
+	//nothing changed so the long-poll times out and the etag still matches
+	revision := strconv.FormatUint(state.Revision, 10)
+	req, err := http.NewRequest("GET", url+"?wait=1s&since="+revision, nil)
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+	req.Header.Set("If-None-Match", etag)
+	setAdminAuth(req)
+
+	client := &http.Client{}
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp.Body.Close()
+
+	//the etag of the same revision before a restart does not match and the
+	//long-poll does not wait on a revision from before the restart
+	req, err = http.NewRequest("GET", url+"?wait=10s&since="+
+		strconv.FormatUint(state.Revision+100, 10), nil)
+	assert.NoError(t, err)
+	req.Header.Set("If-None-Match", stateETag("0000000000000000", state.Revision))
+	setAdminAuth(req)
+
+	start := time.Now()
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	resp.Body.Close()
+
+	//an invalid wait is rejected
+	resp, err = getAsAdmin(url + "?wait=abc")
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestNodeCredentials(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/node/credentials"
+
+	creds := types.NodeCredentials{
+		Acknowledged: false,
+		ExecutorID:   "executor1",
+	}
+
+	request, err := json.MarshalIndent(creds, "", "  ")
+	assert.NotNil(t, request)
+	assert.NoError(t, err)
+
+	//no token
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(request))
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	//valid token
+	req, err = http.NewRequest("POST", url, bytes.NewBuffer(request))
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor1")
+
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var newcreds types.NodeCredentials
+	err = json.Unmarshal(body, &newcreds)
+	assert.NoError(t, err)
+
+	assert.Equal(t, true, newcreds.Acknowledged)
+	assert.Equal(t, "Scaleio123", newcreds.AdminPassword)
+}
+
 func TestNodeStateOk(t *testing.T) {
 	url := "http://" + server.Config.RestAddress + ":" +
 		strconv.Itoa(server.Config.RestPort) + "/api/node/state"
@@ -231,6 +401,7 @@ func TestNodeStateOk(t *testing.T) {
 	assert.NotNil(t, req)
 	assert.NoError(t, err)
 	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor1")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -262,6 +433,116 @@ func TestNodeStateOk(t *testing.T) {
 	assert.Equal(t, types.StatePrerequisitesInstalled, newstate.State)
 }
 
+func TestWatch(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/watch?since=0"
+
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+	setAdminAuth(req)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	defer resp.Body.Close()
+
+	//read the first event
+	reader := bufio.NewReader(resp.Body)
+	var data string
+	for {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		if err != nil || line == "\n" {
+			break
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	var delta types.Delta
+	err = json.Unmarshal([]byte(data), &delta)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(1), delta.Revision)
+	assert.Equal(t, types.DeltaNodeState, delta.Type)
+	assert.Equal(t, "node1", delta.Hostname)
+	assert.Equal(t, types.StatePrerequisitesInstalled, delta.State)
+}
+
+func TestNodeRecord(t *testing.T) {
+	node, err := server.Store.GetNodeRecord("node1")
+	assert.NotNil(t, node)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "127.0.0.1", node.AgentID)
+	assert.Equal(t, "executor1", node.ExecutorID)
+	assert.Equal(t, types.PersonaMdmPrimary, node.Persona)
+	assert.Equal(t, types.StatePrerequisitesInstalled, node.State)
+
+	nodes, err := server.Store.GetNodeRecords()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(nodes))
+
+	//the node list is not a setting
+	_, err = server.Store.Store.Get(server.Store.RootKey + "/configuration/nodes")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
+
+func TestEvents(t *testing.T) {
+	events := waitForEvents(t, "?since=0", func(events []*types.Event) bool {
+		return len(events) > 0
+	})
+	assert.Equal(t, 1, len(events))
+
+	assert.Equal(t, uint64(1), events[0].Sequence)
+	assert.Equal(t, types.EventNodeStateChanged, events[0].Type)
+	assert.Equal(t, "node1", events[0].Hostname)
+}
+
+func TestNodes(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/nodes?persona=primary"
+
+	req, err := http.NewRequest("GET", url, nil)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var nodes []*types.NodeInfo
+	err = json.Unmarshal(body, &nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(nodes))
+
+	assert.Equal(t, "node1", nodes[0].Hostname)
+	assert.Equal(t, "primary", nodes[0].PersonaName)
+	assert.Equal(t, "prerequisitesinstalled", nodes[0].StateName)
+
+	url = "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/nodes/node5"
+
+	resp2, err := getAsAdmin(url)
+	assert.NotNil(t, resp2)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp2.StatusCode)
+	resp2.Body.Close()
+}
+
 func TestNodeStateBad(t *testing.T) {
 	url := "http://" + server.Config.RestAddress + ":" +
 		strconv.Itoa(server.Config.RestPort) + "/api/node/state"
@@ -281,6 +562,7 @@ func TestNodeStateBad(t *testing.T) {
 	assert.NoError(t, err)
 
 	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor5")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -294,7 +576,42 @@ func TestNodeStateBad(t *testing.T) {
 	assert.NotNil(t, body)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "Unable to find the Executor", strings.TrimSpace(string(body)))
+	var apiErr types.APIError
+	err = json.Unmarshal(body, &apiErr)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, apiErr.Code)
+	assert.Equal(t, "Unable to find the Executor", apiErr.Message)
+}
+
+func TestNodeStateWrongExecutor(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/node/state"
+
+	state := types.UpdateNode{
+		Acknowledged: false,
+		ExecutorID:   "executor1",
+		State:        types.StatePrerequisitesInstalled,
+	}
+
+	response, err := json.MarshalIndent(state, "", "  ")
+	assert.NotNil(t, response)
+	assert.NoError(t, err)
+
+	//executor2 cannot update the state of executor1
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor2")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
 }
 
 func TestNodePing(t *testing.T) {
@@ -314,6 +631,7 @@ func TestNodePing(t *testing.T) {
 	assert.NotNil(t, req)
 	assert.NoError(t, err)
 	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor1")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -341,6 +659,25 @@ func TestNodePing(t *testing.T) {
 
 	assert.Equal(t, true, newstate.Acknowledged)
 	assert.Equal(t, "executor1", newstate.ExecutorID)
+
+	//another ping leaves the revision alone
+	server.Lock()
+	revision := server.State.Revision
+	server.Unlock()
+
+	req, err = http.NewRequest("POST", url, bytes.NewBuffer(response))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor1")
+
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	server.Lock()
+	assert.Equal(t, revision, server.State.Revision)
+	server.Unlock()
 }
 
 func TestNodeDevice(t *testing.T) {
@@ -363,6 +700,7 @@ func TestNodeDevice(t *testing.T) {
 	assert.NotNil(t, req)
 	assert.NoError(t, err)
 	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor1")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -391,3 +729,1691 @@ func TestNodeDevice(t *testing.T) {
 	assert.Equal(t, true, newstate.Acknowledged)
 	assert.Equal(t, "executor1", newstate.ExecutorID)
 }
+
+func TestMetrics(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/metrics"
+
+	resp, err := getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	metrics := string(body)
+	assert.Contains(t, metrics,
+		"scaleio_framework_nodes{persona=\"primary\",state=\"prerequisitesinstalled\"} 1")
+	assert.Contains(t, metrics, "scaleio_framework_node_last_contact_seconds{hostname=\"node1\"}")
+	assert.Contains(t, metrics, "scaleio_framework_offers_received_total 0")
+}
+
+func TestUI(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/ui"
+
+	resp, err := http.Get(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	//the page is static so no node data is rendered server side
+	assert.Contains(t, string(body), types.APIPrefix)
+	assert.NotContains(t, string(body), "executor1")
+}
+
+func TestNodeResetConflict(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/nodes/node3/reset"
+
+	req, err := http.NewRequest("POST", url, nil)
+	assert.NoError(t, err)
+	setAdminAuth(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var apiErr types.APIError
+	err = json.Unmarshal(body, &apiErr)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, apiErr.Code)
+}
+
+func TestTopology(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/topology"
+
+	topology := types.Topology{
+		Domains: []*types.TopologyDomain{
+			&types.TopologyDomain{
+				Name: "pd1",
+				Pools: []*types.TopologyPool{
+					&types.TopologyPool{
+						Name: "sp1",
+						Devices: map[string][]string{
+							"node4": []string{"/dev/xvdf", "/dev/xvdg"},
+						},
+					},
+				},
+				Consumers: []string{"node4"},
+			},
+			&types.TopologyDomain{
+				Name: "pd1",
+			},
+		},
+	}
+
+	//duplicate domain
+	response, err := json.Marshal(topology)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(response))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	topology.Domains = topology.Domains[:1]
+	response, err = json.Marshal(topology)
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest("PUT", url, bytes.NewBuffer(response))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	saved, err := server.Store.GetTopology()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(saved.Domains))
+
+	server.Lock()
+	defer server.Unlock()
+
+	node := server.State.ScaleIO.Nodes[3]
+	assert.Equal(t, "node4", node.Hostname)
+	assert.True(t, node.Imperative)
+	assert.Equal(t, []string{"/dev/xvdf", "/dev/xvdg"}, node.ProvidesDomains["pd1"].Pools["sp1"].Devices)
+	assert.NotNil(t, node.ConsumesDomains["pd1"])
+	assert.Nil(t, server.State.ScaleIO.Nodes[0].ProvidesDomains["pd1"])
+}
+
+func TestVolumesNotConfigured(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/volumes"
+
+	resp, err := getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var apiErr types.APIError
+	err = json.Unmarshal(body, &apiErr)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.Code)
+}
+
+func TestSnapshotPolicy(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/snapshots/policies/hourly"
+
+	policy := types.SnapshotPolicy{
+		Prefix:            "db-",
+		IntervalInMinutes: 60,
+		Retention:         0,
+	}
+
+	//no retention
+	response, err := json.Marshal(policy)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(response))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	policy.Retention = 24
+	response, err = json.Marshal(policy)
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest("PUT", url, bytes.NewBuffer(response))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var saved types.SnapshotPolicy
+	err = json.Unmarshal(body, &saved)
+	assert.NoError(t, err)
+	assert.Equal(t, "hourly", saved.Name)
+	assert.Equal(t, 24, saved.Retention)
+	assert.NotNil(t, saved.Status)
+	assert.True(t, isSnapshotPolicyDue(&saved, time.Now().Unix()))
+
+	assert.Equal(t, "averyveryverylongvolumen-"+strconv.FormatInt(1500000000, 36),
+		snapshotName("averyveryverylongvolumename", 1500000000))
+
+	//vol2 was deleted and only one of its snapshots is left
+	status := &types.SnapshotPolicyStatus{
+		Snapshots: map[string][]string{
+			"vol1": []string{"snap1"},
+			"vol2": []string{"snap2", "snap3"},
+			"vol3": []string{"snap4"},
+		},
+	}
+	forgetDeletedSnapshots(status, []*siotypes.Volume{
+		&siotypes.Volume{ID: "vol1"},
+		&siotypes.Volume{ID: "snap1", AncestorVolumeID: "vol1"},
+		&siotypes.Volume{ID: "snap3", AncestorVolumeID: "vol2"},
+	})
+	assert.Equal(t, map[string][]string{
+		"vol1": []string{"snap1"},
+		"vol2": []string{"snap3"},
+	}, status.Snapshots)
+}
+
+func TestNodeStateInvalidTransition(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/node/state"
+
+	//node2 has not installed anything yet
+	state := types.UpdateNode{
+		Acknowledged: false,
+		ExecutorID:   "executor2",
+		State:        types.StateFinishInstall,
+	}
+
+	response, err := json.MarshalIndent(state, "", "  ")
+	assert.NotNil(t, response)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor2")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, types.StateUnknown, server.State.ScaleIO.Nodes[1].State)
+
+	//the accepted transition of node1 is recorded
+	node, err := server.Store.GetNodeRecord("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, types.StatePrerequisitesInstalled, node.State)
+	assert.Equal(t, types.StateCleanPrereqsReboot, node.PreviousState)
+	assert.NotEqual(t, int64(0), node.StateChanged)
+	assert.Equal(t, "Reported by the executor", node.StateReason)
+
+	assert.True(t, types.IsValidTransition(types.StatePrerequisitesInstalled, types.StateAddResourcesToScaleIO))
+	assert.True(t, types.IsValidTransition(types.StateInstallRexRay, types.StateFatalInstall))
+	assert.False(t, types.IsValidTransition(types.StateFatalInstall, types.StateFinishInstall))
+	assert.False(t, types.IsValidTransition(types.StateUnknown, 12345))
+}
+
+func TestNodeRetry(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/node/state"
+
+	state := types.UpdateNode{
+		Acknowledged: false,
+		ExecutorID:   "executor3",
+		State:        types.StateFatalInstall,
+		FailedStep:   "NodeSetup",
+		Output:       "dpkg: error processing package emc-scaleio-sds",
+	}
+
+	response, err := json.MarshalIndent(state, "", "  ")
+	assert.NotNil(t, response)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor3")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	node := server.State.ScaleIO.Nodes[2]
+	assert.Equal(t, types.StateFatalInstall, node.State)
+	assert.NotNil(t, node.Failure)
+	assert.Equal(t, types.StateUnknown, node.Failure.State)
+	assert.Equal(t, "NodeSetup", node.Failure.Step)
+	assert.NotEqual(t, int64(0), node.Failure.NextRetry)
+
+	retryURL := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/nodes/node3/retry"
+
+	resp, err = http.Post(retryURL, "application/json", nil)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	var info types.NodeInfo
+	err = json.Unmarshal(body, &info)
+	assert.NoError(t, err)
+	assert.Equal(t, types.StateUnknown, info.State)
+	assert.Equal(t, 1, info.Failure.Retries)
+
+	//nothing left to retry
+	resp, err = http.Post(retryURL, "application/json", nil)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, 2*time.Minute, server.retryBackoff(1))
+	assert.Equal(t, time.Hour, server.retryBackoff(10))
+}
+
+func TestUpgrade(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/upgrade"
+
+	resp, err := getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	request := types.UpgradeRequest{
+		Ubuntu14: types.Ubuntu14Packages{
+			Mdm: "http://localhost/EMC-ScaleIO-mdm-2.0-13000.211.Ubuntu.14.04.x86_64.deb",
+		},
+	}
+
+	response, err := json.MarshalIndent(request, "", "  ")
+	assert.NotNil(t, response)
+	assert.NoError(t, err)
+
+	//the test cluster is never configured
+	resp, err = http.Post(url, "application/json", bytes.NewBuffer(response))
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Post(url+"/resume", "application/json", nil)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	order := upgradeOrder(server.State.ScaleIO.Nodes)
+	assert.Equal(t, []string{"node3", "node2", "node1", "node4"}, order)
+
+	upgrade := &types.Upgrade{
+		Order:    order,
+		Upgraded: []string{"node3", "node2"},
+	}
+	assert.Equal(t, "node1", nextUpgradeNode(upgrade))
+
+	upgrade.Rollback = true
+	assert.Equal(t, "node2", nextUpgradeNode(upgrade))
+}
+
+func TestDecommissionNode(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/nodes/"
+
+	client := &http.Client{}
+
+	//only data nodes can be decommissioned
+	req, err := http.NewRequest("DELETE", url+"node1", nil)
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+	setAdminAuth(req)
+
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	req, err = http.NewRequest("DELETE", url+"node5", nil)
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+	setAdminAuth(req)
+
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.False(t, types.IsValidTransition(types.StateFinishInstall, types.StateDecommission))
+	assert.False(t, types.IsValidTransition(types.StateFatalInstall, types.StateDecommission))
+	assert.True(t, types.IsValidTransition(types.StateDecommission, types.StateDecommissioned))
+	assert.False(t, types.IsValidTransition(types.StateDecommissioned, types.StateUnknown))
+	assert.False(t, types.IsValidTransition(types.StateDecommissioned, types.StateFatalInstall))
+}
+
+func TestSdsMode(t *testing.T) {
+	node := &types.ScaleIONode{
+		Imperative: true,
+		ProvidesDomains: map[string]*types.ProtectionDomain{
+			"domain1": {Name: "domain1"},
+			"domain2": {Name: "domain2"},
+		},
+		ConsumesDomains: make(map[string]*types.ProtectionDomain),
+	}
+
+	//no sdc attributes means the SDS is used for everything
+	assert.Equal(t, kvstore.SdsModeAll, sdsMode(node, "domain1"))
+
+	node.ConsumesDomains["domain1"] = &types.ProtectionDomain{Name: "domain1"}
+	assert.Equal(t, kvstore.SdsModeAll, sdsMode(node, "domain1"))
+	assert.Equal(t, kvstore.SdsModeServer, sdsMode(node, "domain2"))
+
+	metaData := &kvstore.Metadata{
+		ProtectionDomains: make(map[string]*kvstore.ProtectionDomain),
+	}
+	assert.True(t, server.processAdditions(metaData, node))
+	for _, sds := range metaData.ProtectionDomains["domain2"].Sdss {
+		assert.Equal(t, kvstore.SdsModeServer, sds.Mode)
+	}
+
+	assert.True(t, runsSds(node))
+
+	//a consumer only node never gets an SDS
+	node.ProvidesDomains = make(map[string]*types.ProtectionDomain)
+	assert.Equal(t, kvstore.SdsModeClient, sdsMode(node, "domain1"))
+	assert.False(t, runsSds(node))
+
+	metaData = &kvstore.Metadata{
+		ProtectionDomains: make(map[string]*kvstore.ProtectionDomain),
+	}
+	assert.False(t, server.processAdditions(metaData, node))
+	assert.Equal(t, 0, len(metaData.ProtectionDomains))
+}
+
+func TestSdsLayout(t *testing.T) {
+	domain := &types.TopologyDomain{
+		Name: "pd1",
+		Pools: []*types.TopologyPool{
+			&types.TopologyPool{
+				Name: "sp1",
+				Devices: map[string][]string{
+					"node4": []string{"/dev/nvme0n1", "/dev/nvme1n1"},
+				},
+			},
+		},
+		Sdss: map[string][]*types.Sds{
+			"node4": []*types.Sds{
+				&types.Sds{Name: "sds0", Devices: []string{"/dev/nvme0n1"}},
+				&types.Sds{Name: "sds1", Devices: []string{"/dev/nvme0n1"}},
+			},
+		},
+	}
+	topology := &types.Topology{Domains: []*types.TopologyDomain{domain}}
+
+	//a device can only be attached through one SDS
+	assert.Error(t, validateTopology(topology))
+
+	//two SDSs on the node IP and default port
+	domain.Sdss["node4"][1].Devices = []string{"/dev/nvme1n1"}
+	assert.Error(t, validateTopology(topology))
+
+	domain.Sdss["node4"][1].Port = 7073
+	assert.NoError(t, validateTopology(topology))
+
+	provides, _, declared := topologyForHost(topology, "node4")
+	assert.True(t, declared)
+	assert.Equal(t, "sds1", provides["pd1"].SdsForDevice("10.0.0.4", "/dev/nvme1n1"))
+	assert.Equal(t, "sds0", provides["pd1"].SdsForDevice("10.0.0.4", "/dev/nvme2n1"))
+
+	node := &types.ScaleIONode{
+		Hostname:        "node4",
+		IPAddress:       "10.0.0.4",
+		Imperative:      true,
+		ProvidesDomains: provides,
+		ConsumesDomains: make(map[string]*types.ProtectionDomain),
+	}
+	metaData := &kvstore.Metadata{
+		ProtectionDomains: make(map[string]*kvstore.ProtectionDomain),
+	}
+	assert.True(t, server.processAdditions(metaData, node))
+
+	mDomain := metaData.ProtectionDomains["pd1"]
+	assert.Equal(t, 2, len(mDomain.Sdss))
+	assert.Equal(t, 7073, mDomain.Sdss["sds1"].Port)
+	assert.Equal(t, []string{"10.0.0.4"}, mDomain.Sdss["sds1"].IPs)
+	assert.Equal(t, "sds1", mDomain.Pools["sp1"].Devices["/dev/nvme1n1"].Sds)
+
+	//dropping an SDS removes it and moves its devices to the first SDS
+	provides["pd1"].Sdss = provides["pd1"].Sdss[:1]
+	assert.True(t, server.processDeletions(metaData, node))
+	assert.True(t, mDomain.Sdss["sds1"].Delete)
+	assert.False(t, mDomain.Sdss["sds0"].Delete)
+	assert.True(t, mDomain.Pools["sp1"].Devices["/dev/nvme1n1"].Delete)
+	assert.False(t, mDomain.Pools["sp1"].Devices["/dev/nvme0n1"].Delete)
+}
+
+func requestRebootLease(t *testing.T, executorID string, release bool) types.RebootLease {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/node/reboot"
+
+	lease := types.RebootLease{
+		Acknowledged: false,
+		ExecutorID:   executorID,
+		Release:      release,
+	}
+
+	response, err := json.MarshalIndent(lease, "", "  ")
+	assert.NotNil(t, response)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+	assert.NotNil(t, req)
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, executorID)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NotNil(t, body)
+	assert.NoError(t, err)
+
+	var newlease types.RebootLease
+	err = json.Unmarshal(body, &newlease)
+	assert.NoError(t, err)
+	assert.True(t, newlease.Acknowledged)
+	return newlease
+}
+
+func TestRebootLease(t *testing.T) {
+	lease := requestRebootLease(t, "executor1", false)
+	assert.True(t, lease.Granted)
+	assert.Equal(t, "node1", lease.Hostname)
+	assert.NotEqual(t, int64(0), lease.Expires)
+
+	//a restarted scheduler gets the lease back from the store
+	stored, err := server.Store.GetRebootLeases()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(stored))
+	assert.Equal(t, lease.Expires, stored["node1"].Expires)
+
+	//asking again keeps the lease
+	lease = requestRebootLease(t, "executor1", false)
+	assert.True(t, lease.Granted)
+
+	//one MDM at a time
+	lease = requestRebootLease(t, "executor2", false)
+	assert.False(t, lease.Granted)
+	assert.Contains(t, lease.Reason, "MDM")
+
+	//one SDS at a time by default
+	lease = requestRebootLease(t, "executor4", false)
+	assert.False(t, lease.Granted)
+	assert.NotEmpty(t, lease.Reason)
+
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/reboots"
+
+	resp, err := getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	var leases []types.RebootLease
+	err = json.Unmarshal(body, &leases)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(leases))
+	assert.Equal(t, "node1", leases[0].Hostname)
+
+	lease = requestRebootLease(t, "executor1", true)
+	assert.False(t, lease.Granted)
+
+	lease = requestRebootLease(t, "executor2", false)
+	assert.True(t, lease.Granted)
+
+	//expired leases are dropped
+	server.Lock()
+	server.rebootLeases["node2"].Expires = time.Now().Unix() - 1
+	server.Unlock()
+
+	lease = requestRebootLease(t, "executor4", false)
+	assert.True(t, lease.Granted)
+
+	stored, err = server.Store.GetRebootLeases()
+	assert.NoError(t, err)
+	assert.Nil(t, stored["node2"])
+	assert.NotNil(t, stored["node4"])
+
+	requestRebootLease(t, "executor4", true)
+
+	stored, err = server.Store.GetRebootLeases()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(stored))
+}
+
+func TestLiveness(t *testing.T) {
+	now := time.Now().Unix()
+	node := &types.ScaleIONode{
+		Hostname: "node9",
+		Persona:  types.PersonaNode,
+		State:    types.StateBasePackagedInstalled,
+	}
+	assert.Equal(t, types.LivenessUnknown, server.nodeLiveness(node, now))
+
+	node.LastContact = now - 10
+	assert.Equal(t, types.LivenessOnline, server.nodeLiveness(node, now))
+
+	node.LastContact = now - int64(server.Config.LivenessStale.Seconds())
+	assert.Equal(t, types.LivenessStale, server.nodeLiveness(node, now))
+
+	node.LastContact = now - int64(server.Config.LivenessOffline.Seconds())
+	assert.Equal(t, types.LivenessOffline, server.nodeLiveness(node, now))
+
+	//Mesos says the task is gone
+	node.LastContact = now
+	node.TaskState = "TASK_LOST"
+	assert.Equal(t, types.LivenessOffline, server.nodeLiveness(node, now))
+
+	server.Lock()
+	server.updateLiveness(node, now)
+	server.Unlock()
+	assert.Equal(t, types.LivenessOffline, node.Liveness)
+
+	//the install barrier does not wait on an offline data node
+	state := &types.ScaleIOFramework{
+		ScaleIO: &types.ScaleIOConfig{
+			Nodes: []*types.ScaleIONode{
+				{Persona: types.PersonaMdmPrimary, State: types.StateAddResourcesToScaleIO},
+				node,
+			},
+		},
+	}
+	assert.True(t, common.SyncRunState(state, types.StateAddResourcesToScaleIO, true))
+	node.Liveness = types.LivenessStale
+	assert.False(t, common.SyncRunState(state, types.StateAddResourcesToScaleIO, true))
+
+	//an offline SDS node uses up the reboot budget
+	server.Lock()
+	data := server.State.ScaleIO.Nodes[3]
+	mdm := server.State.ScaleIO.Nodes[1]
+	previous := data.Liveness
+	data.Liveness = types.LivenessOffline
+	assert.Contains(t, server.rebootBlocker(server.State.ScaleIO.Nodes[0]), "SDS nodes are rebooting or offline")
+	data.Liveness = previous
+
+	previous = mdm.Liveness
+	mdm.Liveness = types.LivenessOffline
+	assert.Contains(t, server.rebootBlocker(server.State.ScaleIO.Nodes[0]), "node2 is offline")
+	mdm.Liveness = previous
+	server.Unlock()
+}
+
+func TestHealth(t *testing.T) {
+	assert.Equal(t, types.HealthOk, mdmClusterSeverity("ClusteredNormal"))
+	assert.Equal(t, types.HealthWarning, mdmClusterSeverity("ClusteredTiebreakerDown"))
+	assert.Equal(t, types.HealthCritical, mdmClusterSeverity("NotClustered"))
+
+	assert.Equal(t, types.HealthOk, newPoolHealth("pd", "sp", 0, 0, 0, 0).Severity)
+	assert.Equal(t, types.HealthInfo, newPoolHealth("pd", "sp", 0, 0, 0, 1024).Severity)
+	assert.Equal(t, types.HealthWarning, newPoolHealth("pd", "sp", 0, 1024, 1024, 0).Severity)
+	assert.Equal(t, types.HealthCritical, newPoolHealth("pd", "sp", 1024, 1024, 0, 0).Severity)
+
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + "/health"
+
+	//not checked yet
+	resp, err := getAsAdmin(url)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	var health types.ClusterHealth
+	err = json.Unmarshal(body, &health)
+	assert.NoError(t, err)
+	assert.Equal(t, types.HealthUnknown, health.Severity)
+
+	check := &types.ClusterHealth{
+		Severity: types.HealthOk,
+		Checked:  time.Now().Unix(),
+		Issues:   make([]*types.HealthIssue, 0),
+		Pools:    []*types.PoolHealth{newPoolHealth("pd", "sp", 0, 0, 4096, 0)},
+	}
+	addIssue(check, &types.HealthIssue{
+		Component: "pool",
+		Name:      "pd/sp",
+		Severity:  types.HealthWarning,
+		Message:   poolMessage(check.Pools[0]),
+	})
+	addIssue(check, &types.HealthIssue{
+		Component: "sds",
+		Name:      "sds_127.0.0.4",
+		Hostname:  "node4",
+		Severity:  types.HealthCritical,
+		Message:   "SDS sds_127.0.0.4 is disconnected from the MDM",
+	})
+	assert.Equal(t, types.HealthCritical, check.Severity)
+	assert.Equal(t, "sds", worstIssue(check).Component)
+	server.setHealth(check)
+	assert.Equal(t, check.Checked, check.Changed)
+
+	resp, err = getAsAdmin(url + "?severity=critical")
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	err = json.Unmarshal(body, &health)
+	assert.NoError(t, err)
+	assert.Equal(t, types.HealthCritical, health.Severity)
+	assert.Equal(t, 1, len(health.Issues))
+	assert.Equal(t, "node4", health.Issues[0].Hostname)
+	assert.Equal(t, 1, len(health.Pools))
+	assert.Equal(t, 4096, health.Pools[0].RebuildKb)
+
+	resp, err = getAsAdmin(url + "?severity=bad")
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	//the gates refuse to take a node down when ScaleIO can't be reached
+	healthy, err := server.checkClusterHealth()
+	assert.False(t, healthy)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ScaleIO Gateway")
+
+	server.Lock()
+	assert.Equal(t, types.HealthCritical, server.health.Severity)
+	server.health = nil
+	server.Unlock()
+}
+
+func TestSyncFromStore(t *testing.T) {
+	now := time.Now().Unix()
+	node := &types.ScaleIONode{
+		ExecutorID:  "executor9",
+		Hostname:    "node9",
+		Persona:     types.PersonaNode,
+		State:       types.StateAddResourcesToScaleIO,
+		LastContact: now,
+		Liveness:    types.LivenessOnline,
+		Failure: &types.NodeFailure{
+			State:   types.StateAddResourcesToScaleIO,
+			Retries: 2,
+		},
+	}
+	defer server.Store.DeleteNode(node.Hostname)
+
+	//the store was edited to send the node back a step which the state
+	//machine doesn't allow
+	err := server.Store.SetNodeInfo(node.Hostname, node.Persona, types.StateBasePackagedInstalled)
+	assert.NoError(t, err)
+
+	server.Lock()
+	nodes := snapshotNodes([]*types.ScaleIONode{node})
+	server.Unlock()
+
+	snapshot := server.readStore(nodes)
+	assert.Equal(t, 1, len(snapshot.nodes))
+
+	server.Lock()
+	server.mergeStore(snapshot)
+	server.Unlock()
+
+	assert.Equal(t, types.StateAddResourcesToScaleIO, node.State)
+	_, state, err := server.Store.GetNodeInfo(node.Hostname)
+	assert.NoError(t, err)
+	assert.Equal(t, types.StateAddResourcesToScaleIO, state)
+
+	//the store was edited to move the node on
+	err = server.Store.SetNodeInfo(node.Hostname, node.Persona, types.StateInstallRexRay)
+	assert.NoError(t, err)
+
+	server.Lock()
+	nodes = snapshotNodes([]*types.ScaleIONode{node})
+	server.Unlock()
+
+	snapshot = server.readStore(nodes)
+
+	server.Lock()
+	server.mergeStore(snapshot)
+	server.Unlock()
+
+	assert.Equal(t, types.StateInstallRexRay, node.State)
+	assert.Equal(t, types.StateAddResourcesToScaleIO, node.PreviousState)
+	assert.Equal(t, now, node.LastContact)
+	assert.Equal(t, types.LivenessOnline, node.Liveness)
+	assert.NotNil(t, node.Failure)
+	assert.Equal(t, 2, node.Failure.Retries)
+
+	//a failed node set back to the step it failed in is retried
+	server.Lock()
+	node.State = types.StateFatalInstall
+	nodes = snapshotNodes([]*types.ScaleIONode{node})
+	server.Unlock()
+
+	err = server.Store.SetNodeInfo(node.Hostname, node.Persona, types.StateAddResourcesToScaleIO)
+	assert.NoError(t, err)
+	snapshot = server.readStore(nodes)
+
+	server.Lock()
+	server.mergeStore(snapshot)
+	server.Unlock()
+
+	assert.Equal(t, types.StateAddResourcesToScaleIO, node.State)
+	assert.NotNil(t, node.Failure)
+	assert.Equal(t, 3, node.Failure.Retries)
+
+	//a failed node set to unknown is reset
+	server.Lock()
+	node.State = types.StateFatalInstall
+	nodes = snapshotNodes([]*types.ScaleIONode{node})
+	server.Unlock()
+
+	err = server.Store.SetNodeInfo(node.Hostname, node.Persona, types.StateUnknown)
+	assert.NoError(t, err)
+	snapshot = server.readStore(nodes)
+
+	server.Lock()
+	server.mergeStore(snapshot)
+	server.Unlock()
+
+	assert.Equal(t, types.StateUnknown, node.State)
+	assert.Nil(t, node.Failure)
+
+	server.Lock()
+	node.State = types.StateAddResourcesToScaleIO
+	server.Unlock()
+
+	//the node moved on while the store was read
+	err = server.Store.SetNodeInfo(node.Hostname, node.Persona, types.StateAddResourcesToScaleIO)
+	assert.NoError(t, err)
+
+	server.Lock()
+	nodes = snapshotNodes([]*types.ScaleIONode{node})
+	server.Unlock()
+
+	snapshot = server.readStore(nodes)
+
+	server.Lock()
+	node.State = types.StateInitializeCluster
+	server.mergeStore(snapshot)
+	server.Unlock()
+
+	assert.Equal(t, types.StateInitializeCluster, node.State)
+
+	//nothing to do when the store matches
+	server.Lock()
+	nodes = snapshotNodes([]*types.ScaleIONode{node})
+	server.Unlock()
+
+	err = server.Store.SetNodeInfo(node.Hostname, node.Persona, types.StateInitializeCluster)
+	assert.NoError(t, err)
+	snapshot = server.readStore(nodes)
+
+	server.Lock()
+	changed := node.StateChanged
+	server.mergeStore(snapshot)
+	server.Unlock()
+
+	assert.Equal(t, types.StateInitializeCluster, node.State)
+	assert.Equal(t, changed, node.StateChanged)
+}
+
+func getEventsPage(t *testing.T, query string) (int, []*types.Event) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/events" + query
+
+	req, err := http.NewRequest("GET", url, nil)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	var events []*types.Event
+	if resp.StatusCode == http.StatusOK {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(body, &events))
+	}
+	return resp.StatusCode, events
+}
+
+//waitForEvents reads the journal until done is true. Events are written to
+//the journal in the background.
+func waitForEvents(t *testing.T, query string, done func([]*types.Event) bool) []*types.Event {
+	var events []*types.Event
+	for i := 0; i < 50; i++ {
+		_, events = getEventsPage(t, query)
+		if done(events) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return events
+}
+
+func TestEventsLimit(t *testing.T) {
+	server.Lock()
+	for i := 1; i <= 5; i++ {
+		server.RecordEvent(types.EventConfigChanged, "node9", "page "+strconv.Itoa(i))
+	}
+	server.Unlock()
+
+	//the newest events
+	events := waitForEvents(t, "?limit=2", func(events []*types.Event) bool {
+		return len(events) == 2 && events[1].Message == "page 5"
+	})
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "page 4", events[0].Message)
+	assert.Equal(t, "page 5", events[1].Message)
+
+	//page forward from a sequence
+	since := events[1].Sequence - 5
+	code, events := getEventsPage(t, "?limit=2&since="+strconv.FormatUint(since, 10))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "page 1", events[0].Message)
+	assert.Equal(t, "page 2", events[1].Message)
+
+	code, events = getEventsPage(t, "?limit=2&since="+strconv.FormatUint(events[1].Sequence, 10))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "page 3", events[0].Message)
+
+	code, _ = getEventsPage(t, "?limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = getEventsPage(t, "?limit=1001")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAdminWithoutToken(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.RestReadToken = ""
+	cfg.RestAdminToken = ""
+	s := &RestServer{Config: cfg}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	call := func(scope int, token string) int {
+		req := httptest.NewRequest("POST", "/api/v1/expand", nil)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.authorize(scope, ok)(w, req)
+		return w.Code
+	}
+
+	//without an admin token nobody gets in, whatever they send
+	assert.Equal(t, http.StatusUnauthorized, call(scopeAdmin, ""))
+	assert.Equal(t, http.StatusUnauthorized, call(scopeAdmin, TestAdminToken))
+	assert.Equal(t, http.StatusOK, call(scopeRead, ""))
+
+	cfg.RestAdminToken = TestAdminToken
+	assert.Equal(t, http.StatusUnauthorized, call(scopeAdmin, ""))
+	assert.Equal(t, http.StatusUnauthorized, call(scopeAdmin, "wrongtoken"))
+	assert.Equal(t, http.StatusOK, call(scopeAdmin, TestAdminToken))
+	assert.Equal(t, http.StatusUnauthorized, call(scopeRead, ""))
+}
+
+func TestNodeStateDecommissionRejected(t *testing.T) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + "/api/node/state"
+
+	state := types.UpdateNode{
+		Acknowledged: false,
+		ExecutorID:   "executor4",
+		State:        types.StateDecommission,
+	}
+
+	response, err := json.MarshalIndent(state, "", "  ")
+	assert.NotNil(t, response)
+	assert.NoError(t, err)
+
+	server.Lock()
+	previous := server.State.ScaleIO.Nodes[3].State
+	server.Unlock()
+
+	//neither the executor nor an admin can skip the DELETE on the node
+	for _, admin := range []bool{false, true} {
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(response))
+		assert.NotNil(t, req)
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+		if admin {
+			setAdminAuth(req)
+		} else {
+			setExecutorAuth(req, "executor4")
+		}
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		assert.NotNil(t, resp)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	server.Lock()
+	assert.Equal(t, previous, server.State.ScaleIO.Nodes[3].State)
+	server.Unlock()
+}
+
+func TestNodeResetOnlyByOperator(t *testing.T) {
+	assert.False(t, types.IsValidTransition(types.StateFatalInstall, types.StateUnknown))
+
+	server.Lock()
+	node := server.State.ScaleIO.Nodes[3]
+	previous := node.State
+	node.State = types.StateFatalInstall
+	node.Failure = &types.NodeFailure{State: types.StateAddResourcesToScaleIO, Step: "NodeSetup"}
+	server.Unlock()
+
+	//the executor can't restart the install by itself
+	state := types.UpdateNode{
+		Acknowledged: false,
+		ExecutorID:   "executor4",
+		State:        types.StateUnknown,
+	}
+	response, err := json.MarshalIndent(state, "", "  ")
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "http://"+server.Config.RestAddress+":"+
+		strconv.Itoa(server.Config.RestPort)+"/api/node/state", bytes.NewBuffer(response))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setExecutorAuth(req, "executor4")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	server.Lock()
+	assert.Equal(t, types.StateFatalInstall, node.State)
+	server.Unlock()
+
+	//an operator can
+	req, err = http.NewRequest("POST", "http://"+server.Config.RestAddress+":"+
+		strconv.Itoa(server.Config.RestPort)+types.APIPrefix+"/nodes/node4/reset", nil)
+	assert.NoError(t, err)
+	setAdminAuth(req)
+
+	resp, err = client.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	server.Lock()
+	assert.Equal(t, types.StateUnknown, node.State)
+	assert.Nil(t, node.Failure)
+	node.State = previous
+	server.Unlock()
+}
+
+//fakeScaleIO is a ScaleIO Gateway that serves the objects it is given,
+//creates volumes and records the actions posted to it
+type fakeScaleIO struct {
+	sync.Mutex
+	systems []siotypes.System
+	domains []siotypes.ProtectionDomain
+	pools   []siotypes.StoragePool
+	sdcs    []siotypes.Sdc
+	devices []siotypes.Device
+	sdss    []siotypes.Sds
+	volumes []siotypes.Volume
+	actions []string
+	bodies  []string
+}
+
+func (f *fakeScaleIO) findVolume(id string, name string) *siotypes.Volume {
+	for i := range f.volumes {
+		if f.volumes[i].ID == id || f.volumes[i].Name == name {
+			return &f.volumes[i]
+		}
+	}
+	return nil
+}
+
+func (f *fakeScaleIO) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	var response interface{}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/action/queryIdByKey"):
+		query := struct {
+			Name string `json:"name"`
+		}{}
+		json.Unmarshal(body, &query)
+		volume := f.findVolume("", query.Name)
+		if volume == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(&siotypes.Error{
+				Message:        "Could not find the volume",
+				HTTPStatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		//the Gateway answers with the bare ID in quotes
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("\"" + volume.ID + "\""))
+		return
+	case strings.Contains(r.URL.Path, "/action/"):
+		f.actions = append(f.actions, r.URL.Path[strings.Index(r.URL.Path, "/instances/")+11:])
+		f.bodies = append(f.bodies, string(body))
+		response = struct{}{}
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/types/Volume/instances"):
+		param := &siotypes.VolumeParam{}
+		json.Unmarshal(body, param)
+		sizeInKb, _ := strconv.Atoi(param.VolumeSizeInKb)
+		volume := siotypes.Volume{
+			ID:            "vol" + strconv.Itoa(len(f.volumes)+1),
+			Name:          param.Name,
+			SizeInKb:      sizeInKb,
+			StoragePoolID: param.StoragePoolID,
+			VolumeType:    param.VolumeType,
+		}
+		f.volumes = append(f.volumes, volume)
+		response = &siotypes.VolumeResp{ID: volume.ID}
+	case strings.HasSuffix(r.URL.Path, "/types/System/instances"):
+		response = f.systems
+	case strings.HasSuffix(r.URL.Path, "/relationships/ProtectionDomain"):
+		response = f.domains
+	case strings.HasSuffix(r.URL.Path, "/relationships/StoragePool"):
+		response = f.pools
+	case strings.HasSuffix(r.URL.Path, "/relationships/Sdc"):
+		response = f.sdcs
+	case strings.HasSuffix(r.URL.Path, "/relationships/Device"):
+		response = f.devices
+	case strings.HasSuffix(r.URL.Path, "/relationships/Sds"):
+		response = f.sdss
+	case strings.HasSuffix(r.URL.Path, "/types/Volume/instances"):
+		response = f.volumes
+	case strings.Contains(r.URL.Path, "/instances/Volume::"):
+		volume := f.findVolume(r.URL.Path[strings.Index(r.URL.Path, "::")+2:], "")
+		if volume == nil {
+			http.NotFound(w, r)
+			return
+		}
+		response = volume
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeScaleIO) Actions() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string{}, f.actions...)
+}
+
+func newFakeScaleIO(t *testing.T) (*fakeScaleIO, *httptest.Server, *goscaleio.Client) {
+	fake := &fakeScaleIO{}
+	gateway := httptest.NewServer(fake)
+
+	client, err := goscaleio.NewClientWithArgs(gateway.URL+"/api", server.Config.APIVersion, true, false)
+	assert.NoError(t, err)
+	return fake, gateway, client
+}
+
+func TestFindSds(t *testing.T) {
+	fake, gateway, client := newFakeScaleIO(t)
+
+	scaleioDomain := goscaleio.NewProtectionDomainEx(client, &siotypes.ProtectionDomain{ID: "pd1"})
+	fake.Lock()
+	fake.sdss = []siotypes.Sds{{ID: "sds1", Name: "sds1"}}
+	fake.Unlock()
+
+	tmpSds, found, err := server.findSds(scaleioDomain, "sds1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "sds1", tmpSds.ID)
+
+	_, found, err = server.findSds(scaleioDomain, "sds2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	//an SDS is not gone just because ScaleIO can't be reached
+	gateway.Close()
+	_, found, err = server.findSds(scaleioDomain, "sds1")
+	assert.Error(t, err)
+	assert.False(t, found)
+}
+
+func TestRemoveDevice(t *testing.T) {
+	fake, gateway, client := newFakeScaleIO(t)
+	defer gateway.Close()
+
+	scaleioPool := goscaleio.NewStoragePoolEx(client, &siotypes.StoragePool{ID: "pool1"})
+	scaleioSds := goscaleio.NewSdsEx(client, &siotypes.Sds{ID: "sds1", Name: "sds1"})
+	device := &kvstore.Device{Name: "/dev/xvdf", Delete: true}
+
+	//already gone along with its SDS
+	removed, err := server.removeDevice(client, scaleioPool, nil, device)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	//ScaleIO is still migrating the data off the device
+	fake.Lock()
+	fake.devices = []siotypes.Device{{
+		ID:                    "device1",
+		SdsID:                 "sds1",
+		DeviceCurrentPathname: "/dev/xvdf",
+		DeviceState:           removePending,
+	}}
+	fake.Unlock()
+
+	removed, err = server.removeDevice(client, scaleioPool, scaleioSds, device)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, 0, len(fake.Actions()))
+
+	//ScaleIO is done
+	fake.Lock()
+	fake.devices = nil
+	fake.Unlock()
+
+	removed, err = server.removeDevice(client, scaleioPool, scaleioSds, device)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	assert.Equal(t, 0, len(fake.Actions()))
+}
+
+func TestRemoveSds(t *testing.T) {
+	fake, gateway, client := newFakeScaleIO(t)
+	defer gateway.Close()
+
+	node := &types.ScaleIONode{Hostname: "node9", IPAddress: "10.0.0.9"}
+	scaleioDomain := goscaleio.NewProtectionDomainEx(client, &siotypes.ProtectionDomain{ID: "pd1"})
+	sds := &kvstore.Sds{Name: "sds1", Delete: true}
+	device := &kvstore.Device{Name: "/dev/xvdf", Sds: "sds1", Delete: true, RemovePending: true}
+	domain := &kvstore.ProtectionDomain{
+		Name: "pd1",
+		Pools: map[string]*kvstore.StoragePool{
+			"pool1": {
+				Name:    "pool1",
+				Delete:  true,
+				Devices: map[string]*kvstore.Device{device.Name: device},
+			},
+		},
+		Sdss: map[string]*kvstore.Sds{sds.Name: sds},
+	}
+
+	//the SDS and the StoragePool wait on a device ScaleIO is still removing
+	removed, err := server.removeSds(client, scaleioDomain, domain, sds, node)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+	removal, err := server.removePool(client, nil, domain.Pools["pool1"])
+	assert.NoError(t, err)
+	assert.Equal(t, poolRemovalPending, removal)
+	assert.Equal(t, 0, len(fake.Actions()))
+
+	//the device is gone so the removal of the SDS starts
+	device.RemovePending = false
+	fake.Lock()
+	fake.sdss = []siotypes.Sds{{ID: "sds1", Name: "sds1"}}
+	fake.Unlock()
+
+	removed, err = server.removeSds(client, scaleioDomain, domain, sds, node)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, []string{"Sds::sds1/action/removeSds"}, fake.Actions())
+
+	//ScaleIO is still removing the SDS
+	fake.Lock()
+	fake.sdss[0].SdsState = removePending
+	fake.Unlock()
+
+	removed, err = server.removeSds(client, scaleioDomain, domain, sds, node)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, 1, len(fake.Actions()))
+
+	//ScaleIO is done
+	fake.Lock()
+	fake.sdss = nil
+	fake.Unlock()
+
+	removed, err = server.removeSds(client, scaleioDomain, domain, sds, node)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	assert.Equal(t, 1, len(fake.Actions()))
+}
+
+func TestRemovePool(t *testing.T) {
+	fake, gateway, client := newFakeScaleIO(t)
+	defer gateway.Close()
+
+	scaleioPool := goscaleio.NewStoragePoolEx(client, &siotypes.StoragePool{ID: "pool1"})
+	pool := &kvstore.StoragePool{
+		Name:   "pool1",
+		Delete: true,
+		Devices: map[string]*kvstore.Device{
+			"/dev/xvdf": {Name: "/dev/xvdf", Delete: true},
+		},
+	}
+
+	//another node still has a device in the StoragePool
+	fake.Lock()
+	fake.devices = []siotypes.Device{{ID: "device2", SdsID: "sds2", DeviceCurrentPathname: "/dev/xvdf"}}
+	fake.Unlock()
+
+	removal, err := server.removePool(client, scaleioPool, pool)
+	assert.NoError(t, err)
+	assert.Equal(t, poolRemovalReleased, removal)
+
+	//the StoragePool still has a volume
+	fake.Lock()
+	fake.devices = nil
+	fake.volumes = []siotypes.Volume{{ID: "volume1", Name: "volume1", StoragePoolID: "pool1"}}
+	fake.Unlock()
+
+	removal, err = server.removePool(client, scaleioPool, pool)
+	assert.NoError(t, err)
+	assert.Equal(t, poolRemovalReleased, removal)
+	assert.Equal(t, 0, len(fake.Actions()))
+
+	//nothing is left so it is removed from ScaleIO
+	fake.Lock()
+	fake.volumes = nil
+	fake.Unlock()
+
+	removal, err = server.removePool(client, scaleioPool, pool)
+	assert.NoError(t, err)
+	assert.Equal(t, poolRemovalDone, removal)
+	assert.Equal(t, []string{"StoragePool::pool1/action/removeStoragePool"}, fake.Actions())
+}
+
+func TestRemovePendingKeptInStore(t *testing.T) {
+	defer server.Store.DeleteNode("node9")
+
+	pending := &kvstore.Device{Name: "/dev/xvdf", Delete: true, RemovePending: true}
+	done := &kvstore.Device{Name: "/dev/xvdg", Delete: true}
+	kept := &kvstore.Device{Name: "/dev/xvdh"}
+	metaData := &kvstore.Metadata{
+		ProtectionDomains: map[string]*kvstore.ProtectionDomain{
+			"pd1": {
+				Name: "pd1",
+				Pools: map[string]*kvstore.StoragePool{
+					"pool1": {
+						Name: "pool1",
+						Devices: map[string]*kvstore.Device{
+							pending.Name: pending,
+							done.Name:    done,
+							kept.Name:    kept,
+						},
+					},
+				},
+				Sdss: map[string]*kvstore.Sds{
+					"sds1": {Name: "sds1"},
+				},
+			},
+		},
+	}
+
+	err := server.Store.SetMetadata("node9", metaData)
+	assert.NoError(t, err)
+
+	//the deletions are still there in memory
+	assert.True(t, pending.Delete)
+	assert.True(t, done.Delete)
+
+	saved, err := server.Store.GetMetadata("node9")
+	assert.NoError(t, err)
+	devices := saved.ProtectionDomains["pd1"].Pools["pool1"].Devices
+	assert.NotNil(t, devices[pending.Name])
+	assert.Nil(t, devices[done.Name])
+	assert.NotNil(t, devices[kept.Name])
+
+	//a failed pass keeps every deletion in the store
+	keepDeletions(metaData)
+	assert.True(t, done.RemovePending)
+	assert.False(t, kept.RemovePending)
+}
+
+//newFakeVolumeGateway points the server at a fake Gateway with one system,
+//ProtectionDomain, StoragePool and SDC. The SDC is on the node with the
+//returned hostname. Call the returned func to put the server back.
+func newFakeVolumeGateway(t *testing.T) (*fakeScaleIO, string, func()) {
+	fake, gateway, client := newFakeScaleIO(t)
+
+	node := &types.ScaleIONode{
+		ExecutorID: "executor8",
+		Hostname:   "node8",
+		IPAddress:  "10.0.0.8",
+		Persona:    types.PersonaNode,
+		State:      types.StateFinishInstall,
+	}
+
+	server.Lock()
+	configured := server.State.ScaleIO.Configured
+	server.State.ScaleIO.Configured = true
+	server.State.ScaleIO.Nodes = append(server.State.ScaleIO.Nodes, node)
+	clusterName := server.State.ScaleIO.ClusterName
+	server.Unlock()
+
+	fake.Lock()
+	fake.systems = []siotypes.System{{
+		ID:   "system1",
+		Name: clusterName,
+		Links: []*siotypes.Link{{
+			Rel:  "/api/System/relationship/ProtectionDomain",
+			HREF: "/api/instances/System::system1/relationships/ProtectionDomain",
+		}},
+	}}
+	fake.domains = []siotypes.ProtectionDomain{{
+		ID:   "pd1",
+		Name: server.Config.ProtectionDomain,
+		Links: []*siotypes.Link{{
+			Rel:  "/api/ProtectionDomain/relationship/StoragePool",
+			HREF: "/api/instances/ProtectionDomain::pd1/relationships/StoragePool",
+		}},
+	}}
+	fake.pools = []siotypes.StoragePool{{
+		ID:                 "pool1",
+		Name:               server.Config.StoragePool,
+		ProtectionDomainID: "pd1",
+	}}
+	fake.sdcs = []siotypes.Sdc{{ID: "sdc8", SdcIp: node.IPAddress}}
+	fake.Unlock()
+
+	server.Lock()
+	server.connectScaleIO = func(state *types.ScaleIOFramework) (*goscaleio.Client, error) {
+		return client, nil
+	}
+	server.Unlock()
+
+	return fake, node.Hostname, func() {
+		gateway.Close()
+
+		server.Lock()
+		server.connectScaleIO = server.createScaleioClient
+		server.State.ScaleIO.Configured = configured
+		server.State.ScaleIO.Nodes = server.State.ScaleIO.Nodes[:len(server.State.ScaleIO.Nodes)-1]
+		server.Unlock()
+	}
+}
+
+func sendVolumeRequest(t *testing.T, method string, path string, request interface{}) (int, *types.VolumeInfo) {
+	url := "http://" + server.Config.RestAddress + ":" +
+		strconv.Itoa(server.Config.RestPort) + types.APIPrefix + path
+
+	var body io.Reader
+	if request != nil {
+		buf, err := json.Marshal(request)
+		assert.NoError(t, err)
+		body = bytes.NewBuffer(buf)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	setAdminAuth(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NotNil(t, resp)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return resp.StatusCode, nil
+	}
+	info := &types.VolumeInfo{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(info))
+	return resp.StatusCode, info
+}
+
+func TestVolumeCreate(t *testing.T) {
+	fake, _, done := newFakeVolumeGateway(t)
+	defer done()
+
+	code, _ := sendVolumeRequest(t, "POST", "/volumes", &types.CreateVolume{Name: "vol-a"})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = sendVolumeRequest(t, "POST", "/volumes", &types.CreateVolume{
+		Name:     "vol-a",
+		SizeInGB: 8,
+		Pool:     "missing",
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, info := sendVolumeRequest(t, "POST", "/volumes", &types.CreateVolume{
+		Name:     "vol-a",
+		SizeInGB: 8,
+		Tags:     []string{"db"},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.NotNil(t, info)
+	assert.Equal(t, "vol1", info.ID)
+	assert.Equal(t, 8*1024*1024, info.SizeInKb)
+	assert.Equal(t, server.Config.ProtectionDomain, info.Domain)
+	assert.Equal(t, server.Config.StoragePool, info.Pool)
+	assert.Equal(t, []string{"db"}, info.Tags)
+
+	fake.Lock()
+	assert.Equal(t, 1, len(fake.volumes))
+	assert.Equal(t, "pool1", fake.volumes[0].StoragePoolID)
+	fake.Unlock()
+
+	code, _ = sendVolumeRequest(t, "POST", "/volumes", &types.CreateVolume{Name: "vol-a", SizeInGB: 8})
+	assert.Equal(t, http.StatusConflict, code)
+
+	server.Store.DeleteVolumeTags(info.ID)
+}
+
+func TestVolumeResize(t *testing.T) {
+	fake, _, done := newFakeVolumeGateway(t)
+	defer done()
+
+	fake.Lock()
+	fake.volumes = []siotypes.Volume{{ID: "vol1", Name: "vol-a", SizeInKb: 16 * 1024 * 1024}}
+	fake.Unlock()
+
+	//not a multiple of 8GB
+	code, _ := sendVolumeRequest(t, "POST", "/volumes/vol-a/resize", &types.ResizeVolume{SizeInGB: 20})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	//volumes can't shrink
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-a/resize", &types.ResizeVolume{SizeInGB: 8})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-a/resize", &types.ResizeVolume{SizeInGB: 16})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-b/resize", &types.ResizeVolume{SizeInGB: 24})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, 0, len(fake.Actions()))
+
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-a/resize", &types.ResizeVolume{SizeInGB: 24})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Volume::vol1/action/setVolumeSize"}, fake.Actions())
+
+	fake.Lock()
+	assert.Contains(t, fake.bodies[0], `"24"`)
+	fake.Unlock()
+}
+
+func TestVolumeMapping(t *testing.T) {
+	fake, hostname, done := newFakeVolumeGateway(t)
+	defer done()
+
+	fake.Lock()
+	fake.volumes = []siotypes.Volume{{ID: "vol1", Name: "vol-a", SizeInKb: 8 * 1024 * 1024}}
+	fake.Unlock()
+
+	code, _ := sendVolumeRequest(t, "POST", "/volumes/vol-a/map", &types.VolumeMapping{})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	//the framework doesn't know the node
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-a/map", &types.VolumeMapping{Hostname: "node99"})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, 0, len(fake.Actions()))
+
+	//the hostname is resolved to the SDC on the node
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-a/map", &types.VolumeMapping{Hostname: hostname})
+	assert.Equal(t, http.StatusOK, code)
+
+	//the SDC is shown by the hostname of its node
+	fake.Lock()
+	fake.volumes[0].MappedSdcInfo = []*siotypes.MappedSdcInfo{{SdcID: "sdc8", SdcIP: "10.0.0.8"}}
+	fake.Unlock()
+
+	code, info := sendVolumeRequest(t, "GET", "/volumes/vol-a", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{hostname}, info.MappedHosts)
+
+	code, _ = sendVolumeRequest(t, "POST", "/volumes/vol-a/unmap", &types.VolumeMapping{Hostname: hostname})
+	assert.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, []string{
+		"Volume::vol1/action/addMappedSdc",
+		"Volume::vol1/action/removeMappedSdc",
+	}, fake.Actions())
+
+	fake.Lock()
+	for _, body := range fake.bodies {
+		assert.Contains(t, body, `"sdc8"`)
+	}
+	fake.Unlock()
+}
+
+func TestVolumeDelete(t *testing.T) {
+	fake, _, done := newFakeVolumeGateway(t)
+	defer done()
+
+	fake.Lock()
+	fake.volumes = []siotypes.Volume{{
+		ID:            "vol1",
+		Name:          "vol-a",
+		SizeInKb:      8 * 1024 * 1024,
+		MappedSdcInfo: []*siotypes.MappedSdcInfo{{SdcID: "sdc8", SdcIP: "10.0.0.8"}},
+	}}
+	fake.Unlock()
+
+	code, _ := sendVolumeRequest(t, "DELETE", "/volumes/vol-b", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	//still mapped
+	code, _ = sendVolumeRequest(t, "DELETE", "/volumes/vol-a", nil)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, 0, len(fake.Actions()))
+
+	fake.Lock()
+	fake.volumes[0].MappedSdcInfo = nil
+	fake.Unlock()
+
+	code, info := sendVolumeRequest(t, "DELETE", "/volumes/vol-a", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "vol1", info.ID)
+	assert.Equal(t, []string{"Volume::vol1/action/removeVolume"}, fake.Actions())
+}
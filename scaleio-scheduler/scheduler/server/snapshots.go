@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
+	siotypes "github.com/codedellemc/goscaleio/types/v1"
+	"github.com/gorilla/mux"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//maxVolumeName is the longest name ScaleIO accepts for a volume
+	maxVolumeName = 31
+)
+
+//snapshotName fits the volume name and the time into a ScaleIO volume name
+func snapshotName(volumeName string, now int64) string {
+	suffix := "-" + strconv.FormatInt(now, 36)
+	if len(volumeName)+len(suffix) > maxVolumeName {
+		volumeName = volumeName[:maxVolumeName-len(suffix)]
+	}
+	return volumeName + suffix
+}
+
+//isSnapshotPolicyDue is true when the interval has passed since the last run
+func isSnapshotPolicyDue(policy *types.SnapshotPolicy, now int64) bool {
+	return policy.Status.LastRun+int64(policy.IntervalInMinutes)*60 <= now
+}
+
+//forgetDeletedSnapshots drops the snapshots that no longer exist. The
+//snapshots of a deleted volume are kept, and listed in the status, since they
+//may be all that is left of it. A volume is forgotten once none are left.
+func forgetDeletedSnapshots(status *types.SnapshotPolicyStatus, volumes []*siotypes.Volume) {
+	exists := make(map[string]bool)
+	for _, volume := range volumes {
+		exists[volume.ID] = true
+	}
+
+	for volumeID, snapshots := range status.Snapshots {
+		if exists[volumeID] {
+			continue
+		}
+		left := make([]string, 0)
+		for _, snapshot := range snapshots {
+			if exists[snapshot] {
+				left = append(left, snapshot)
+			}
+		}
+		if len(left) == 0 {
+			delete(status.Snapshots, volumeID)
+		} else {
+			status.Snapshots[volumeID] = left
+		}
+	}
+}
+
+//runSnapshotPolicies runs the snapshot policies that are due
+func (s *RestServer) runSnapshotPolicies() {
+	policies, err := s.Store.GetSnapshotPolicies()
+	if err != nil {
+		log.Errorln("GetSnapshotPolicies Err:", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	due := make([]*types.SnapshotPolicy, 0)
+	for _, policy := range policies {
+		if isSnapshotPolicyDue(policy, now) {
+			due = append(due, policy)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	log.Debugln("runSnapshotPolicies ENTER")
+
+	var pools map[string]*poolRef
+	var volumes []*siotypes.Volume
+	session, err := s.openScaleIO()
+	if err == nil {
+		pools, err = s.pools(session)
+	}
+	if err == nil {
+		volumes, err = session.client.GetVolume("", "", "", "", true)
+		if err != nil {
+			log.Errorln("GetVolume Error:", err)
+			s.Metrics.ScaleIOError("GetVolume")
+		}
+	}
+
+	for _, policy := range due {
+		if err != nil {
+			//try again on the next interval
+			policy.Status.LastRun = now
+			policy.Status.Error = err.Error()
+			if errSet := s.Store.SetSnapshotPolicyStatus(policy.Name, policy.Status); errSet != nil {
+				log.Errorln("SetSnapshotPolicyStatus Err:", errSet)
+			}
+			continue
+		}
+		s.runSnapshotPolicy(session, pools, volumes, policy, now)
+	}
+
+	log.Debugln("runSnapshotPolicies LEAVE")
+}
+
+//runSnapshotPolicy snapshots the matching volumes and deletes the oldest
+//snapshots past the retention
+func (s *RestServer) runSnapshotPolicy(session *scaleioSession, pools map[string]*poolRef,
+	volumes []*siotypes.Volume, policy *types.SnapshotPolicy, now int64) {
+	log.Infoln("Running snapshot policy", policy.Name)
+
+	domain := policy.SourceDomain
+	if len(domain) == 0 {
+		domain = s.Config.ProtectionDomain
+	}
+	pool := policy.SourcePool
+	if len(pool) == 0 {
+		pool = s.Config.StoragePool
+	}
+
+	status := policy.Status
+	status.LastRun = now
+	status.Taken = 0
+	status.Pruned = 0
+	status.Error = ""
+
+	for _, volume := range volumes {
+		if len(volume.AncestorVolumeID) > 0 {
+			continue
+		}
+		ref := pools[volume.StoragePoolID]
+		if ref == nil || ref.Domain != domain || ref.Pool != pool {
+			continue
+		}
+		if len(policy.Prefix) > 0 && !strings.HasPrefix(volume.Name, policy.Prefix) {
+			continue
+		}
+		if len(policy.Tag) > 0 && !doesNeedleExist(s.Store.GetVolumeTags(volume.ID), policy.Tag) {
+			continue
+		}
+
+		resp, err := session.system.CreateSnapshotConsistencyGroup(&siotypes.SnapshotVolumesParam{
+			SnapshotDefs: []*siotypes.SnapshotDef{
+				&siotypes.SnapshotDef{
+					VolumeID:     volume.ID,
+					SnapshotName: snapshotName(volume.Name, now),
+				},
+			},
+		})
+		if err != nil {
+			log.Errorln("CreateSnapshotConsistencyGroup Error:", err)
+			s.Metrics.ScaleIOError("CreateSnapshotConsistencyGroup")
+			status.Error = "Snapshot of " + volume.Name + " failed: " + err.Error()
+			continue
+		}
+		status.Snapshots[volume.ID] = append(status.Snapshots[volume.ID], resp.VolumeIDList...)
+		status.Taken++
+
+		for len(status.Snapshots[volume.ID]) > policy.Retention {
+			oldest := status.Snapshots[volume.ID][0]
+
+			snapshot := goscaleio.NewVolume(session.client)
+			snapshot.Volume = &siotypes.Volume{ID: oldest}
+			err := snapshot.RemoveVolume("ONLY_ME")
+			if err != nil {
+				if _, errGet := session.client.GetVolume("", oldest, "", "", true); errGet == nil {
+					log.Errorln("RemoveVolume Error:", err)
+					s.Metrics.ScaleIOError("RemoveVolume")
+					status.Error = "Removing snapshot " + oldest + " failed: " + err.Error()
+					break
+				}
+				//already deleted outside of the framework
+				log.Warnln("Snapshot", oldest, "no longer exists")
+			} else {
+				status.Pruned++
+			}
+			status.Snapshots[volume.ID] = status.Snapshots[volume.ID][1:]
+		}
+	}
+
+	forgetDeletedSnapshots(status, volumes)
+
+	if len(status.Error) == 0 {
+		status.LastSuccess = now
+	}
+
+	err := s.Store.SetSnapshotPolicyStatus(policy.Name, status)
+	if err != nil {
+		log.Errorln("SetSnapshotPolicyStatus Err:", err)
+	}
+
+	message := "Snapshot policy " + policy.Name + " took " + strconv.Itoa(status.Taken) +
+		" and pruned " + strconv.Itoa(status.Pruned) + " snapshots"
+	if len(status.Error) > 0 {
+		message += ". Err: " + status.Error
+	}
+	s.RecordEvent(types.EventSnapshotPolicyRun, "", message)
+}
+
+func getSnapshotPolicies(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	policies, err := server.Store.GetSnapshotPolicies()
+	if err != nil {
+		writeError(w, "GetSnapshotPolicies Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(policies); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func getSnapshotPolicy(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	name := mux.Vars(r)["name"]
+
+	policy, err := server.Store.GetSnapshotPolicy(name)
+	if err != nil {
+		writeError(w, "Unable to find the snapshot policy", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func setSnapshotPolicy(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	name := mux.Vars(r)["name"]
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	policy := &types.SnapshotPolicy{}
+	if err := json.Unmarshal(body, &policy); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+	policy.Name = name
+	policy.Status = nil
+
+	if len(policy.Prefix) == 0 && len(policy.Tag) == 0 {
+		writeError(w, "A prefix or a tag is required", http.StatusBadRequest)
+		return
+	}
+	if policy.IntervalInMinutes <= 0 {
+		writeError(w, "The interval must be at least 1 minute", http.StatusBadRequest)
+		return
+	}
+	if policy.Retention <= 0 {
+		writeError(w, "The retention must keep at least 1 snapshot", http.StatusBadRequest)
+		return
+	}
+
+	err = server.Store.SetSnapshotPolicy(policy)
+	if err != nil {
+		writeError(w, "SetSnapshotPolicy Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	server.RecordEvent(types.EventConfigChanged, "", "Snapshot policy "+name+" saved")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func deleteSnapshotPolicy(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	name := mux.Vars(r)["name"]
+
+	policy, err := server.Store.GetSnapshotPolicy(name)
+	if err != nil {
+		writeError(w, "Unable to find the snapshot policy", http.StatusNotFound)
+		return
+	}
+
+	//the snapshots already taken are kept
+	err = server.Store.DeleteSnapshotPolicy(name)
+	if err != nil {
+		writeError(w, "DeleteSnapshotPolicy Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	server.RecordEvent(types.EventConfigChanged, "", "Snapshot policy "+name+" deleted")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
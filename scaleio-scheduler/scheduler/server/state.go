@@ -7,93 +7,17 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
 )
 
-func displayState(w http.ResponseWriter, r *http.Request, server *RestServer) {
-	response := "<html><head><title>Output</title><meta http-equiv=\"refresh\" content=\"2\" /></head><body>"
-
-	server.Lock()
-	for _, node := range server.State.ScaleIO.Nodes {
-		response += node.ExecutorID
-		response += " = "
-		switch node.State {
-		case types.StateUnknown:
-			response += "Installing Prerequisite Packages"
-
-		case types.StateCleanPrereqsReboot:
-			response += "Sync on Prerequisite Install"
-
-		case types.StatePrerequisitesInstalled:
-			response += "Installing ScaleIO Packages"
-
-		case types.StateBasePackagedInstalled:
-			response += "Creating ScaleIO Cluster"
-
-		case types.StateInitializeCluster:
-			response += "Initializing ScaleIO"
-
-		case types.StateAddResourcesToScaleIO:
-			response += "Adding resources to ScaleIO cluster"
-
-		case types.StateInstallRexRay:
-			response += "Installing REX-Ray"
-
-		case types.StateCleanInstallReboot:
-			response += "Sync Before for Reboot"
-
-		case types.StateSystemReboot:
-			response += "System is Rebooting"
-
-		case types.StateFinishInstall:
-			response += "ScaleIO Running"
-
-		case types.StateFatalInstall:
-			response += "Installation Failed"
-		}
-		response += "<br />"
-	}
-
-	capacityData := server.State.ScaleIO.CapacityData
-	usedData := server.State.ScaleIO.UsedData
-	fakeUsedData := server.State.ScaleIO.FakeUsedData
-
-	usedSpacePercent := int(float64(usedData+fakeUsedData) / float64(capacityData) * 100)
-	if capacityData == 0 {
-		usedSpacePercent = 0
-	}
-
-	if len(server.Config.AccessKey) > 0 && len(server.Config.SecretKey) > 0 {
-		response += "<br /><br /><br />"
-		response += "Capacity (KB): "
-		response += strconv.Itoa(capacityData)
-		response += "<br />"
-		response += "Fake Used Data (KB): "
-		response += strconv.Itoa(fakeUsedData)
-		response += "<br /><br />"
-		response += "Percent Used: "
-		response += strconv.Itoa(usedSpacePercent)
-		response += "<br />"
-		response += "Threshold Percent: "
-		response += strconv.Itoa(server.Config.UsedThreshold)
-		response += "<br />"
-	}
-
-	server.Unlock()
-
-	response += "</body></html>"
-
-	//log.Debugln("response:", string(response))
-	fmt.Fprintf(w, string(response))
-}
-
 func setState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 	if err != nil {
-		http.Error(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
 		return
 	}
 	if err := r.Body.Close(); err != nil {
@@ -105,19 +29,22 @@ func setState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 		KeyValue:     make(map[string]string),
 	}
 	if err := json.Unmarshal(body, &state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 		return
 	}
 
 	//update the object
 	server.Lock()
 	server.State.ScaleIO.Configured = true
+	server.Publish(&types.Delta{
+		Type: types.DeltaClusterConfigured,
+	})
 	server.Unlock()
 
 	//update the store
 	err = server.Store.SetConfigured()
 	if err != nil {
-		http.Error(w, "Failed to update the Cluster configured bit", http.StatusBadRequest)
+		writeError(w, "Failed to update the Cluster configured bit", http.StatusBadRequest)
 		return
 	}
 
@@ -127,20 +54,91 @@ func setState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(state); err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 	}
 }
 
+//parseWait returns the revision and how long to wait for a change after it.
+//wait accepts a duration (ie 30s) or a number of seconds.
+func parseWait(r *http.Request, current uint64) (uint64, time.Duration, error) {
+	waitStr := r.URL.Query().Get("wait")
+	if len(waitStr) == 0 {
+		return current, 0, nil
+	}
+
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil {
+		secs, errSecs := strconv.Atoi(waitStr)
+		if errSecs != nil {
+			return 0, 0, err
+		}
+		wait = time.Duration(secs) * time.Second
+	}
+	if wait > time.Duration(StateMaxWaitInSeconds)*time.Second {
+		wait = time.Duration(StateMaxWaitInSeconds) * time.Second
+	}
+
+	since := current
+	if sinceStr := r.URL.Query().Get("since"); len(sinceStr) > 0 {
+		since, err = strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return since, wait, nil
+}
+
+//stateETag includes the instance ID so an ETag from before a restart never
+//matches a revision of this run
+func stateETag(instanceID string, revision uint64) string {
+	return fmt.Sprintf("\"%s-%d\"", instanceID, revision)
+}
+
 func getState(w http.ResponseWriter, r *http.Request, server *RestServer) {
 	server.Lock()
-	response, err := json.MarshalIndent(server.State, "", "  ")
+	since, wait, err := parseWait(r, server.State.Revision)
+	if err != nil {
+		server.Unlock()
+		writeError(w, "Invalid wait or since parameter", http.StatusBadRequest)
+		return
+	}
+
+	//long-poll until the state moves past since. A since ahead of the
+	//revision was handed out before a restart so there is no need to wait.
+	if wait > 0 && server.State.Revision == since {
+		changed := server.changed
+		server.Unlock()
+
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+
+		server.Lock()
+	}
+
+	//never hand out secrets in the public view of the state
+	state := redactState(cloneState(server.State))
 	server.Unlock()
 
+	etag := stateETag(server.instanceID, state.Revision)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response, err := json.MarshalIndent(state, "", "  ")
+
 	if err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 		return
 	}
 
 	log.Debugln("response:", string(response))
-	fmt.Fprintf(w, string(response))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(response)
 }
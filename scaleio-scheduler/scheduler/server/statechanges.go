@@ -1,8 +1,17 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
 	log "github.com/Sirupsen/logrus"
 	goscaleio "github.com/codedellemc/goscaleio"
+	siotypes "github.com/codedellemc/goscaleio/types/v1"
 
 	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
 	kvstore "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/kvstore"
@@ -54,10 +63,15 @@ func (s *RestServer) processDeletions(metaData *kvstore.Metadata, node *types.Sc
 			bHasChange = true
 		}
 
+		sdsNames := make([]string, 0)
+		for _, sds := range nDomain.GetSdss(node.IPAddress) {
+			sdsNames = append(sdsNames, sds.Name)
+		}
+
 		log.Debugln("domain.Sdss size:", len(mDomain.Sdss))
 		for keyS, mSds := range mDomain.Sdss {
 			log.Debugln("Sds:", keyS)
-			if mDomain.Delete {
+			if mDomain.Delete || !doesNeedleExist(sdsNames, mSds.Name) {
 				log.Debugln("Delete SDS :", mSds.Name)
 				mSds.Delete = true
 				bHasChange = true
@@ -91,6 +105,11 @@ func (s *RestServer) processDeletions(metaData *kvstore.Metadata, node *types.Sc
 					log.Debugln("Delete Device:", mDevice.Name)
 					mDevice.Delete = true
 					bHasChange = true
+				} else if deviceSdsName(node, mDevice) != nDomain.SdsForDevice(node.IPAddress, mDevice.Name) {
+					//added again through the new SDS once it is removed
+					log.Debugln("Delete Device (", mDevice.Name, ") because it moved to another SDS")
+					mDevice.Delete = true
+					bHasChange = true
 				}
 			}
 		}
@@ -102,6 +121,27 @@ func (s *RestServer) processDeletions(metaData *kvstore.Metadata, node *types.Sc
 	return bHasChange
 }
 
+//deviceSdsName returns the SDS a device in the metadata is attached through
+func deviceSdsName(node *types.ScaleIONode, device *kvstore.Device) string {
+	if len(device.Sds) == 0 {
+		return types.DefaultSdsName(node.IPAddress)
+	}
+	return device.Sds
+}
+
+//sdsMode returns how the SDS of the node is used in a ProtectionDomain. A
+//domain the node only consumes is client only and gets no SDS. A node that does
+//not list the domains it consumes keeps using its SDS for both.
+func sdsMode(node *types.ScaleIONode, domain string) int {
+	if node.ProvidesDomains[domain] == nil && node.ConsumesDomains[domain] != nil {
+		return kvstore.SdsModeClient
+	}
+	if len(node.ConsumesDomains) == 0 || node.ConsumesDomains[domain] != nil {
+		return kvstore.SdsModeAll
+	}
+	return kvstore.SdsModeServer
+}
+
 func (s *RestServer) processAdditions(metaData *kvstore.Metadata, node *types.ScaleIONode) bool {
 	log.Debugln("processAdditions ENTER")
 
@@ -135,21 +175,43 @@ func (s *RestServer) processAdditions(metaData *kvstore.Metadata, node *types.Sc
 		mDomain := metaData.ProtectionDomains[keyD]
 
 		//Sds
-		//TODO assume only a single Sds per ProtectionDomain. Will change later.
-		//As such, the SDS is implicitly created.
-		sdsName := "sds_" + node.IPAddress
+		//Without a declared layout, a single SDS named after the node IP is
+		//implicitly created. Only the domains a node provides get an SDS. A
+		//consumer only needs the SDC.
+		mode := sdsMode(node, keyD)
 		if mDomain.Sdss == nil {
 			mDomain.Sdss = make(map[string]*kvstore.Sds)
 		}
-		if mDomain.Sdss[sdsName] == nil {
-			mDomain.Sdss[sdsName] = &kvstore.Sds{
-				Name: sdsName,
-				Add:  true,
-				Mode: kvstore.SdsModeAll,
+		for _, nSds := range nDomain.GetSdss(node.IPAddress) {
+			mSds := mDomain.Sdss[nSds.Name]
+			if mSds == nil {
+				log.Debugln("Creating new SDS (", nSds.Name, ") for domain (", nDomain.Name, ")")
+				mDomain.Sdss[nSds.Name] = &kvstore.Sds{
+					Name: nSds.Name,
+					Add:  true,
+					Mode: mode,
+					IPs:  nSds.IPs,
+					Port: nSds.Port,
+				}
+				bHasChange = true
+				continue
+			}
+			if len(mSds.IPs) == 0 {
+				//saved before the IPs were kept
+				mSds.IPs = nSds.IPs
+				bHasChange = true
+			}
+			if mSds.Port != nSds.Port || strings.Join(mSds.IPs, ",") != strings.Join(nSds.IPs, ",") {
+				log.Warnln("SDS (", nSds.Name, ") was created with IPs", mSds.IPs, "and port", mSds.Port,
+					". Rename the SDS to change them.")
+			}
+			if mSds.Mode != mode {
+				log.Debugln("SDS (", nSds.Name, ") mode changed to", mode)
+				mSds.Mode = mode
+				bHasChange = true
+			} else {
+				log.Debugln("SDS (", nSds.Name, ") already exists")
 			}
-			bHasChange = true
-		} else {
-			log.Debugln("SDS (", sdsName, ") already exists")
 		}
 
 		//Pool
@@ -178,6 +240,7 @@ func (s *RestServer) processAdditions(metaData *kvstore.Metadata, node *types.Sc
 					}
 					mPool.Devices[device] = &kvstore.Device{
 						Name: device,
+						Sds:  nDomain.SdsForDevice(node.IPAddress, device),
 						Add:  true,
 					}
 					bHasChange = true
@@ -201,20 +264,31 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 	system, err := client.FindSystem(s.State.ScaleIO.ClusterID, s.State.ScaleIO.ClusterName, "")
 	if err != nil {
 		log.Errorln("FindSystem Error:", err)
+		s.Metrics.ScaleIOError("FindSystem")
 		log.Debugln("processMetadata LEAVE")
 		return err
 	}
 
 	//ProtectionDomain
+	pending := false
 	for _, domain := range metaData.ProtectionDomains {
+		cascadeDeletions(domain)
+
 		tmpDomain, errDomain := system.FindProtectionDomain("", domain.Name, "")
 		if errDomain != nil {
+			if domain.Delete {
+				log.Infoln("ProtectionDomain already removed:", domain.Name)
+				continue
+			}
 			if !domain.Delete && domain.Add {
 				_, err := system.CreateProtectionDomain(domain.Name)
 				if err == nil {
 					log.Infoln("ProtectionDomain created:", domain.Name)
+					s.RecordEvent(types.EventDomainCreated, node.Hostname,
+						"ProtectionDomain "+domain.Name+" created")
 				} else {
 					log.Errorln("CreateProtectionDomain Error:", err)
+					s.Metrics.ScaleIOError("CreateProtectionDomain")
 					log.Debugln("processMetadata LEAVE")
 					return err
 				}
@@ -224,6 +298,7 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 				log.Infoln("ProtectionDomain found:", domain.Name)
 			} else {
 				log.Errorln("FindProtectionDomain Error:", errDomain)
+				s.Metrics.ScaleIOError("FindProtectionDomain")
 				log.Debugln("processMetadata LEAVE")
 				return errDomain
 			}
@@ -233,18 +308,24 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 		scaleioDomain := goscaleio.NewProtectionDomainEx(client, tmpDomain)
 
 		//Sds
-		var scaleioSds *goscaleio.Sds
+		scaleioSdss := make(map[string]*goscaleio.Sds)
 
 		for _, sds := range domain.Sdss {
 			tmpSds, errSds := scaleioDomain.FindSds("Name", sds.Name)
 			if errSds != nil {
+				if sds.Delete {
+					log.Infoln("SDS already removed:", sds.Name)
+					continue
+				}
 				if !sds.Delete && sds.Add {
-					//TODO fix the IPAddress when ServerOnly and ClientOnly is implemented
-					_, err := scaleioDomain.CreateSds(sds.Name, []string{node.IPAddress})
+					err := s.createSds(client, scaleioDomain, node, sds)
 					if err == nil {
 						log.Infoln("SDS created:", sds.Name)
+						s.RecordEvent(types.EventSdsCreated, node.Hostname,
+							"SDS "+sds.Name+" created in ProtectionDomain "+domain.Name)
 					} else {
 						log.Errorln("CreateSds Error:", err)
+						s.Metrics.ScaleIOError("CreateSds")
 						log.Debugln("processMetadata LEAVE")
 						return err
 					}
@@ -255,6 +336,7 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 					log.Infoln("SDS found:", sds.Name)
 				} else {
 					log.Errorln("FindSds Error:", errSds)
+					s.Metrics.ScaleIOError("FindSds")
 					log.Debugln("processMetadata LEAVE")
 					return errSds
 				}
@@ -268,19 +350,26 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 			}
 
 			log.Debugln("Using SDS", sds.Name, "as it is server or all.")
-			scaleioSds = goscaleio.NewSdsEx(client, tmpSds)
+			scaleioSdss[sds.Name] = goscaleio.NewSdsEx(client, tmpSds)
 		}
 
 		//StoragePool
 		for _, pool := range domain.Pools {
 			tmpPool, errPool := scaleioDomain.FindStoragePool("", pool.Name, "")
 			if errPool != nil {
+				if pool.Delete {
+					log.Infoln("StoragePool already removed:", pool.Name)
+					continue
+				}
 				if !pool.Delete && pool.Add {
 					_, err := scaleioDomain.CreateStoragePool(pool.Name)
 					if err == nil {
 						log.Infoln("StoragePool created:", pool.Name)
+						s.RecordEvent(types.EventPoolCreated, node.Hostname,
+							"StoragePool "+pool.Name+" created in ProtectionDomain "+domain.Name)
 					} else {
 						log.Errorln("CreateStoragePool Error:", err)
+						s.Metrics.ScaleIOError("CreateStoragePool")
 						log.Debugln("processMetadata LEAVE")
 						return err
 					}
@@ -291,6 +380,7 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 					log.Infoln("StoragePool found:", pool.Name)
 				} else {
 					log.Errorln("FindStoragePool Error:", errPool)
+					s.Metrics.ScaleIOError("FindStoragePool")
 					log.Debugln("processMetadata LEAVE")
 					return errPool
 				}
@@ -300,14 +390,39 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 			scaleioPool := goscaleio.NewStoragePoolEx(client, tmpPool)
 
 			for _, device := range pool.Devices {
+				scaleioSds := scaleioSdss[deviceSdsName(node, device)]
 				if device.Delete {
-					//TODO API Call DEL Device from Pool
+					removed, err := s.removeDevice(client, scaleioPool, scaleioSds, device)
+					if err != nil {
+						log.Errorln("removeDevice Error:", err)
+						log.Debugln("processMetadata LEAVE")
+						return err
+					}
+					if removed {
+						s.RecordEvent(types.EventDeviceRemoved, node.Hostname,
+							"Device "+device.Name+" removed from StoragePool "+pool.Name)
+						//a device that moved to another SDS is added back on the
+						//next pass
+						pending = true
+					} else {
+						//keep the device in the store until ScaleIO is done
+						device.RemovePending = true
+						pending = true
+					}
 				} else if device.Add {
+					if scaleioSds == nil {
+						log.Errorln("No SDS", deviceSdsName(node, device), "for device", device.Name)
+						log.Debugln("processMetadata LEAVE")
+						return common.ErrSdsNotFound
+					}
 					_, err := scaleioPool.AttachDevice(device.Name, scaleioSds.Sds.ID)
 					if err == nil {
 						log.Infoln("Device attached:", device.Name)
+						s.RecordEvent(types.EventDeviceAttached, node.Hostname,
+							"Device "+device.Name+" attached to StoragePool "+pool.Name)
 					} else {
 						log.Errorln("AttachDevice Error:", err)
+						s.Metrics.ScaleIOError("AttachDevice")
 						log.Debugln("processMetadata LEAVE")
 						return err
 					}
@@ -315,16 +430,66 @@ func (s *RestServer) processMetadata(client *goscaleio.Client, node *types.Scale
 			}
 
 			if pool.Delete {
-				//TODO API Call DEL Pool
+				removal, err := s.removePool(client, scaleioPool, pool)
+				if err != nil {
+					log.Errorln("removePool Error:", err)
+					log.Debugln("processMetadata LEAVE")
+					return err
+				}
+				switch removal {
+				case poolRemovalDone:
+					s.RecordEvent(types.EventPoolRemoved, node.Hostname,
+						"StoragePool "+pool.Name+" removed from ProtectionDomain "+domain.Name)
+				case poolRemovalReleased:
+					log.Infoln("StoragePool", pool.Name, "released by", node.Hostname)
+				default:
+					pool.RemovePending = true
+					pending = true
+				}
+			}
+		}
+
+		//SDSs dropped from the layout of the node
+		for _, sds := range domain.Sdss {
+			if domain.Delete || !sds.Delete {
+				continue
+			}
+			removed, err := s.removeSds(client, scaleioDomain, domain, sds, node)
+			if err != nil {
+				log.Errorln("removeSds Error:", err)
+				log.Debugln("processMetadata LEAVE")
+				return err
+			}
+			if !removed {
+				sds.RemovePending = true
+				pending = true
 			}
 		}
 
 		if domain.Delete {
-			//TODO API Call DEL SDS
-			//TODO API Call DEL Domain
+			removed, err := s.removeDomain(client, scaleioDomain, domain, node)
+			if err != nil {
+				log.Errorln("removeDomain Error:", err)
+				log.Debugln("processMetadata LEAVE")
+				return err
+			}
+			if !removed {
+				domain.RemovePending = true
+				for _, sds := range domain.Sdss {
+					sds.RemovePending = sds.Delete
+				}
+				pending = true
+			}
 		}
 	}
 
+	//check on the removals ScaleIO is still working on
+	if pending {
+		s.resyncLater()
+	}
+
+	log.Debugln("processMetadata Succeeded")
+	log.Debugln("processMetadata LEAVE")
 	return nil
 }
 
@@ -345,6 +510,7 @@ func (s *RestServer) createScaleioClient(state *types.ScaleIOFramework) (*goscal
 	client, err := goscaleio.NewClientWithArgs(endpoint, s.Config.APIVersion, true, false)
 	if err != nil {
 		log.Errorln("NewClientWithArgs Error:", err)
+		s.Metrics.ScaleIOError("NewClientWithArgs")
 		log.Debugln("createScaleioClient LEAVE")
 		return nil, err
 	}
@@ -356,6 +522,7 @@ func (s *RestServer) createScaleioClient(state *types.ScaleIOFramework) (*goscal
 	})
 	if err != nil {
 		log.Errorln("Authenticate Error:", err)
+		s.Metrics.ScaleIOError("Authenticate")
 		log.Debugln("createScaleioClient LEAVE")
 		return nil, err
 	}
@@ -367,6 +534,99 @@ func (s *RestServer) createScaleioClient(state *types.ScaleIOFramework) (*goscal
 	return client, nil
 }
 
+//createSds creates an SDS with the IPs and port in the layout of the node.
+//goscaleio can't set the port so those SDSs are created through the Gateway.
+func (s *RestServer) createSds(client *goscaleio.Client, scaleioDomain *goscaleio.ProtectionDomain,
+	node *types.ScaleIONode, sds *kvstore.Sds) error {
+	ips := sds.IPs
+	if len(ips) == 0 {
+		ips = []string{node.IPAddress}
+	}
+
+	//the IPs keep the "all" role even for a server only SDS because the SDCs
+	//on the other nodes reach the SDS through them
+	if sds.Port == 0 {
+		_, err := scaleioDomain.CreateSds(sds.Name, ips)
+		return err
+	}
+
+	sdsParam := &siotypes.SdsParam{
+		Name:               sds.Name,
+		ProtectionDomainID: scaleioDomain.ProtectionDomain.ID,
+		Port:               strconv.Itoa(sds.Port),
+	}
+	for _, ip := range ips {
+		sdsParam.IPList = append(sdsParam.IPList, &siotypes.SdsIPList{
+			SdsIP: siotypes.SdsIP{
+				IP:   ip,
+				Role: "all",
+			},
+		})
+	}
+	return s.scaleioPost(client, "/types/Sds/instances", sdsParam, "CreateSds")
+}
+
+//scaleioAction runs an action on a ScaleIO object that goscaleio doesn't
+//expose, ie removeSds. The instance is Type::ID.
+func (s *RestServer) scaleioAction(client *goscaleio.Client, instance string, action string) error {
+	log.Debugln("scaleioAction ENTER")
+	log.Debugln("Instance:", instance, "Action:", action)
+
+	err := s.scaleioPost(client, "/instances/"+instance+"/action/"+action, struct{}{}, action)
+
+	log.Debugln("scaleioAction LEAVE")
+	return err
+}
+
+//scaleioPost posts a request to the ScaleIO Gateway for what goscaleio doesn't
+//expose. The name is the operation reported in the metrics.
+func (s *RestServer) scaleioPost(client *goscaleio.Client, path string, param interface{},
+	name string) error {
+	log.Debugln("scaleioPost ENTER")
+	log.Debugln("Path:", path)
+
+	body, err := json.Marshal(param)
+	if err != nil {
+		log.Errorln("Marshal Error:", err)
+		log.Debugln("scaleioPost LEAVE")
+		return err
+	}
+
+	endpoint := client.SIOEndpoint
+	endpoint.Path += path
+
+	req, err := http.NewRequest("POST", endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		log.Errorln("NewRequest Error:", err)
+		log.Debugln("scaleioPost LEAVE")
+		return err
+	}
+	req.SetBasicAuth("", client.Token)
+	req.Header.Add("Accept", "application/json;version="+s.Config.APIVersion)
+	req.Header.Add("Content-Type", "application/json;version="+s.Config.APIVersion)
+
+	resp, err := client.Http.Do(req)
+	if err != nil {
+		log.Errorln(name, "Error:", err)
+		s.Metrics.ScaleIOError(name)
+		log.Debugln("scaleioPost LEAVE")
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Errorln(name, "Failed. Status:", resp.StatusCode, "Body:", string(body))
+		s.Metrics.ScaleIOError(name)
+		log.Debugln("scaleioPost LEAVE")
+		return errors.New(name + " failed: " + strings.TrimSpace(string(body)))
+	}
+
+	log.Debugln("scaleioPost Succeeded")
+	log.Debugln("scaleioPost LEAVE")
+	return nil
+}
+
 func (s *RestServer) addResourcesToScaleIO(state *types.ScaleIOFramework) error {
 	log.Debugln("addResourcesToScaleIO ENTER")
 
@@ -381,6 +641,16 @@ func (s *RestServer) addResourcesToScaleIO(state *types.ScaleIOFramework) error
 			continue
 		}
 
+		if node.Maintenance {
+			log.Warnln("This node is in maintenance. Skip!")
+			continue
+		}
+
+		if node.Decommission != nil {
+			log.Warnln("This node is being decommissioned. Skip!")
+			continue
+		}
+
 		//Get metadata
 		metaData, err := s.Store.GetMetadata(node.Hostname)
 		if err != nil {
@@ -414,7 +684,12 @@ func (s *RestServer) addResourcesToScaleIO(state *types.ScaleIOFramework) error
 		}
 
 		//process metadata model
-		s.processMetadata(client, node, metaData)
+		err = s.processMetadata(client, node, metaData)
+		if err != nil {
+			log.Errorln("processMetadata Failed. Err:", err)
+			//nothing is removed from the store until ScaleIO confirms it
+			keepDeletions(metaData)
+		}
 
 		//Save metadata
 		err = s.Store.SetMetadata(node.Hostname, metaData)
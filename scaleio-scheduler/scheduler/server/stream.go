@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//DeltaHistory is the number of deltas kept so clients can resume
+	DeltaHistory = 1024
+
+	//StreamKeepAliveInSeconds how often a comment is sent to keep idle
+	//streams open through proxies
+	StreamKeepAliveInSeconds = 15
+
+	//StateMaxWaitInSeconds is the longest a GET of the state can long-poll
+	StateMaxWaitInSeconds = 120
+
+	streamBuffer = 64
+)
+
+//deltaHub keeps a history of deltas and fans them out to subscribers. The
+//revisions come from the state so there are gaps for changes that are not
+//published (ie pings).
+type deltaHub struct {
+	dropped     uint64
+	history     []*types.Delta
+	subscribers map[chan *types.Delta]bool
+
+	sync.Mutex
+}
+
+func newDeltaHub() *deltaHub {
+	return &deltaHub{
+		history:     make([]*types.Delta, 0),
+		subscribers: make(map[chan *types.Delta]bool),
+	}
+}
+
+func (h *deltaHub) publish(delta *types.Delta) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.history = append(h.history, delta)
+	if len(h.history) > DeltaHistory {
+		h.dropped = h.history[len(h.history)-DeltaHistory-1].Revision
+		h.history = h.history[len(h.history)-DeltaHistory:]
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- delta:
+		default:
+			//too slow. drop it and let the client resume from its revision
+			log.Warnln("Dropping slow watch subscriber at revision", delta.Revision)
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+//subscribe returns the deltas after since and a channel for new ones. ok is
+//false when since is older than the history.
+func (h *deltaHub) subscribe(since uint64, revision uint64) ([]*types.Delta, chan *types.Delta, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	ok := true
+	backlog := make([]*types.Delta, 0)
+	if since > revision || since < h.dropped {
+		//too old or the scheduler restarted and the revisions started over
+		ok = false
+	} else {
+		for _, delta := range h.history {
+			if delta.Revision > since {
+				backlog = append(backlog, delta)
+			}
+		}
+	}
+
+	ch := make(chan *types.Delta, streamBuffer)
+	h.subscribers[ch] = true
+	return backlog, ch, ok
+}
+
+func (h *deltaHub) unsubscribe(ch chan *types.Delta) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.subscribers[ch] {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+//Touch bumps the revision of the state and wakes up anyone long-polling.
+//The caller must hold the lock.
+func (s *RestServer) Touch() {
+	s.State.Revision++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+//Publish bumps the revision of the state and sends a delta to everyone
+//watching. The caller must hold the lock.
+func (s *RestServer) Publish(delta *types.Delta) {
+	s.Touch()
+	delta.Revision = s.State.Revision
+	delta.Timestamp = time.Now().Unix()
+	s.deltas.publish(delta)
+}
+
+//PublishNode sends a delta describing a node. The caller must hold the lock.
+func (s *RestServer) PublishNode(deltaType string, node *types.ScaleIONode) {
+	delta := &types.Delta{
+		Type:        deltaType,
+		Hostname:    node.Hostname,
+		ExecutorID:  node.ExecutorID,
+		Persona:     node.Persona,
+		State:       node.State,
+		Maintenance: node.Maintenance,
+	}
+	if deltaType == types.DeltaNodeState {
+		delta.Previous = node.PreviousState
+		delta.Reason = node.StateReason
+	}
+	if deltaType == types.DeltaNodeLiveness {
+		delta.Liveness = node.Liveness
+		delta.Reason = node.TaskState
+	}
+	if deltaType == types.DeltaDevicesAdvertised {
+		delta.Devices = make([]string, 0)
+		for _, pd := range node.ProvidesDomains {
+			for _, sp := range pd.Pools {
+				delta.Devices = append(delta.Devices, sp.Devices...)
+			}
+		}
+	}
+	s.Publish(delta)
+}
+
+func writeDelta(w http.ResponseWriter, delta *types.Delta) error {
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", delta.Revision, delta.Type, data)
+	return err
+}
+
+func getWatch(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	//EventSource sends Last-Event-ID when it reconnects
+	sinceStr := r.URL.Query().Get("since")
+	if len(sinceStr) == 0 {
+		sinceStr = r.Header.Get("Last-Event-ID")
+	}
+	var since uint64
+	if len(sinceStr) > 0 {
+		var err error
+		since, err = strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			writeError(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	server.Lock()
+	revision := server.State.Revision
+	if len(sinceStr) == 0 {
+		since = revision
+	}
+	backlog, ch, ok := server.deltas.subscribe(since, revision)
+	server.Unlock()
+	defer server.deltas.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !ok {
+		writeDelta(w, &types.Delta{
+			Revision:  revision,
+			Timestamp: time.Now().Unix(),
+			Type:      types.DeltaResync,
+		})
+	}
+	for _, delta := range backlog {
+		if err := writeDelta(w, delta); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(time.Duration(StreamKeepAliveInSeconds) * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case delta, open := <-ch:
+			if !open {
+				return
+			}
+			if err := writeDelta(w, delta); err != nil {
+				log.Debugln("Watch client went away:", err)
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
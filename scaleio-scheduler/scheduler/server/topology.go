@@ -0,0 +1,313 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//defaultSdsPort is the port an SDS listens on when none is declared
+const defaultSdsPort = 7072
+
+//validateSdss checks the SDS layout of a ProtectionDomain. The SDSs of a host
+//must only use the devices the host provides in the ProtectionDomain and
+//must not share an IP and port.
+func validateSdss(domain *types.TopologyDomain, sdsNames map[string]bool,
+	endpoints map[string]bool) error {
+	for hostname, sdss := range domain.Sdss {
+		if len(hostname) == 0 {
+			return errors.New("ProtectionDomain " + domain.Name + " has SDSs without a host")
+		}
+
+		provided := make([]string, 0)
+		for _, pool := range domain.Pools {
+			provided = append(provided, pool.Devices[hostname]...)
+		}
+		if len(provided) == 0 {
+			return errors.New("Host " + hostname + " has SDSs in " + domain.Name +
+				" but provides no devices to it")
+		}
+
+		devices := make(map[string]bool)
+		for _, sds := range sdss {
+			if sds == nil || len(sds.Name) == 0 {
+				return errors.New("An SDS of " + hostname + " in " + domain.Name + " is missing a name")
+			}
+			if strings.ContainsAny(sds.Name, ",:@") {
+				return errors.New("SDS " + sds.Name + " can't contain a comma, colon or @")
+			}
+			if sdsNames[sds.Name] {
+				return errors.New("SDS " + sds.Name + " is declared more than once")
+			}
+			sdsNames[sds.Name] = true
+
+			if sds.Port < 0 || sds.Port > 65535 {
+				return errors.New("SDS " + sds.Name + " has an invalid port")
+			}
+			port := sds.Port
+			if port == 0 {
+				port = defaultSdsPort
+			}
+
+			ips := sds.IPs
+			if len(ips) == 0 {
+				//the IP of the node
+				ips = []string{""}
+			}
+			for _, ip := range ips {
+				if len(ip) > 0 && net.ParseIP(ip) == nil {
+					return errors.New("SDS " + sds.Name + " has an invalid IP " + ip)
+				}
+				key := hostname + "|" + ip + "|" + strconv.Itoa(port)
+				if endpoints[key] {
+					return errors.New("SDS " + sds.Name + " uses an IP and port of another SDS on " + hostname)
+				}
+				endpoints[key] = true
+			}
+
+			for _, device := range sds.Devices {
+				if !doesNeedleExist(provided, device) {
+					return errors.New("SDS " + sds.Name + " uses device " + device + " that " + hostname +
+						" does not provide to " + domain.Name)
+				}
+				if devices[device] {
+					return errors.New("Device " + device + " on " + hostname + " is used by more than one SDS")
+				}
+				devices[device] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+//validateTopology checks that names are set and unique and that a device is
+//only used once on each host
+func validateTopology(topology *types.Topology) error {
+	domains := make(map[string]bool)
+	devices := make(map[string]bool)
+	sdsNames := make(map[string]bool)
+	endpoints := make(map[string]bool)
+
+	for _, domain := range topology.Domains {
+		if domain == nil || len(domain.Name) == 0 {
+			return errors.New("A ProtectionDomain is missing a name")
+		}
+		if domains[domain.Name] {
+			return errors.New("ProtectionDomain " + domain.Name + " is declared more than once")
+		}
+		domains[domain.Name] = true
+
+		pools := make(map[string]bool)
+		for _, pool := range domain.Pools {
+			if pool == nil || len(pool.Name) == 0 {
+				return errors.New("A StoragePool in " + domain.Name + " is missing a name")
+			}
+			if pools[pool.Name] {
+				return errors.New("StoragePool " + pool.Name + " is declared more than once in " +
+					domain.Name)
+			}
+			pools[pool.Name] = true
+
+			for hostname, hostDevices := range pool.Devices {
+				if len(hostname) == 0 {
+					return errors.New("StoragePool " + pool.Name + " has devices without a host")
+				}
+				for _, device := range hostDevices {
+					if !strings.HasPrefix(device, "/dev/") {
+						return errors.New("Device " + device + " on " + hostname + " is not under /dev")
+					}
+					key := hostname + ":" + device
+					if devices[key] {
+						return errors.New("Device " + device + " on " + hostname + " is used more than once")
+					}
+					devices[key] = true
+				}
+			}
+		}
+
+		if err := validateSdss(domain, sdsNames, endpoints); err != nil {
+			return err
+		}
+
+		for _, consumer := range domain.Consumers {
+			if len(consumer) == 0 {
+				return errors.New("ProtectionDomain " + domain.Name + " has an empty consumer")
+			}
+		}
+	}
+
+	return nil
+}
+
+//topologyForHost converts the topology into the domains a host provides and
+//consumes. This is the same shape prepareScaleIONode builds from the agent
+//attributes. declared is false when the host is not in the topology.
+func topologyForHost(topology *types.Topology, hostname string) (map[string]*types.ProtectionDomain,
+	map[string]*types.ProtectionDomain, bool) {
+	provides := make(map[string]*types.ProtectionDomain)
+	consumes := make(map[string]*types.ProtectionDomain)
+	declared := false
+
+	if topology == nil {
+		return provides, consumes, false
+	}
+
+	for _, domain := range topology.Domains {
+		for _, pool := range domain.Pools {
+			devices := pool.Devices[hostname]
+			if len(devices) == 0 {
+				continue
+			}
+			declared = true
+
+			if provides[domain.Name] == nil {
+				provides[domain.Name] = &types.ProtectionDomain{
+					Name:     domain.Name,
+					KeyValue: make(map[string]string),
+					Pools:    make(map[string]*types.StoragePool),
+				}
+			}
+			provides[domain.Name].Pools[pool.Name] = &types.StoragePool{
+				Name:     pool.Name,
+				KeyValue: make(map[string]string),
+				Devices:  append([]string{}, devices...),
+			}
+		}
+
+		if provides[domain.Name] != nil {
+			for _, sds := range domain.Sdss[hostname] {
+				provides[domain.Name].Sdss = append(provides[domain.Name].Sdss, &types.Sds{
+					Name:    sds.Name,
+					IPs:     append([]string{}, sds.IPs...),
+					Port:    sds.Port,
+					Devices: append([]string{}, sds.Devices...),
+				})
+			}
+		}
+
+		for _, consumer := range domain.Consumers {
+			if consumer != hostname {
+				continue
+			}
+			declared = true
+
+			nDomain := &types.ProtectionDomain{
+				Name:     domain.Name,
+				KeyValue: make(map[string]string),
+				Pools:    make(map[string]*types.StoragePool),
+			}
+			for _, pool := range domain.Pools {
+				nDomain.Pools[pool.Name] = &types.StoragePool{
+					Name:     pool.Name,
+					KeyValue: make(map[string]string),
+				}
+			}
+			consumes[domain.Name] = nDomain
+		}
+	}
+
+	return provides, consumes, declared
+}
+
+//ApplyTopology sets the domains a node provides and consumes from the
+//declared topology. Returns false if the node is not in the topology. The
+//caller must hold the lock.
+func (s *RestServer) ApplyTopology(node *types.ScaleIONode) bool {
+	provides, consumes, declared := topologyForHost(s.topology, node.Hostname)
+	if !declared {
+		return false
+	}
+
+	log.Infoln("Node", node.Hostname, "is declared in the topology")
+	node.ProvidesDomains = provides
+	node.ConsumesDomains = consumes
+	node.Imperative = true
+	s.State.ScaleIO.AtLeastOneImperative = true
+	return true
+}
+
+func getTopology(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	topology := server.topology
+	server.Unlock()
+
+	if topology == nil {
+		writeError(w, "No topology has been declared", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(topology); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func setTopology(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	topology := &types.Topology{}
+	if err := json.Unmarshal(body, &topology); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+	if err := validateTopology(topology); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = server.Store.SetTopology(topology)
+	if err != nil {
+		writeError(w, "SetTopology Err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	server.Lock()
+	old := server.topology
+	server.topology = topology
+	for _, node := range server.State.ScaleIO.Nodes {
+		if !server.ApplyTopology(node) {
+			if _, _, wasDeclared := topologyForHost(old, node.Hostname); !wasDeclared {
+				//still declared through agent attributes
+				continue
+			}
+			//removed from the topology so everything on it is deleted
+			node.ProvidesDomains = make(map[string]*types.ProtectionDomain)
+			node.ConsumesDomains = make(map[string]*types.ProtectionDomain)
+		}
+
+		if err := server.Store.SetNodeRecord(node); err != nil {
+			log.Warnln("Failed to save node", node.Hostname, "to the store:", err)
+		}
+		server.PublishNode(types.DeltaDevicesAdvertised, node)
+	}
+	//picked up by MonitorForState on the next pass
+	server.topologyChanged = true
+	server.Unlock()
+
+	server.RecordEvent(types.EventTopologyChanged, "", "Topology declared with "+
+		strconv.Itoa(len(topology.Domains))+" ProtectionDomains")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(topology); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//recordTransition moves a node to a new state and remembers the state it came
+//from, when and why. The caller must hold the lock.
+func (s *RestServer) recordTransition(node *types.ScaleIONode, state int, reason string) {
+	log.Infoln("Node", node.Hostname, "moving from", common.StateIDToString(node.State),
+		"to", common.StateIDToString(state), "Reason:", reason)
+
+	//the step that failed made it through
+	if node.Failure != nil && state != types.StateFatalInstall && node.State == node.Failure.State {
+		node.Failure = nil
+	}
+
+	node.PreviousState = node.State
+	node.State = state
+	node.StateChanged = time.Now().Unix()
+	node.StateReason = reason
+	s.PublishNode(types.DeltaNodeState, node)
+
+	s.RecordEvent(types.EventNodeStateChanged, node.Hostname, "State changed from "+
+		common.StateIDToString(node.PreviousState)+" to "+common.StateIDToString(node.State)+
+		". Reason: "+reason)
+}
+
+//TransitionNode moves a node to a new state if the install lifecycle allows it
+//and saves the node in the store. Returns false if the node was already in that
+//state. The caller must hold the lock.
+func (s *RestServer) TransitionNode(node *types.ScaleIONode, state int, reason string) (bool, error) {
+	if node.State == state {
+		return false, nil
+	}
+	if err := types.ValidateTransition(node.State, state); err != nil {
+		log.Warnln("Node", node.Hostname, "cannot move from", common.StateIDToString(node.State),
+			"to", common.StateIDToString(state))
+		return false, err
+	}
+
+	s.recordTransition(node, state, reason)
+
+	err := s.Store.SetNodeInfo(node.Hostname, node.Persona, node.State)
+	if err == nil {
+		err = s.Store.SetNodeRecord(node)
+	}
+	return true, err
+}
+
+//decommissionNode moves a node to StateDecommission and saves the node in the
+//store. The install lifecycle never leads there so only the decommission an
+//operator started with DELETE on the node may call this. The caller must hold
+//the lock.
+func (s *RestServer) decommissionNode(node *types.ScaleIONode, reason string) error {
+	if node.State == types.StateDecommission {
+		return nil
+	}
+	if node.State == types.StateDecommissioned {
+		return types.ErrInvalidStateTransition
+	}
+
+	s.recordTransition(node, types.StateDecommission, reason)
+
+	err := s.Store.SetNodeInfo(node.Hostname, node.Persona, node.State)
+	if err == nil {
+		err = s.Store.SetNodeRecord(node)
+	}
+	return err
+}
+
+//resetNodeState moves a node in StateFatalInstall back to StateUnknown so the
+//install starts over and saves the node in the store. The install lifecycle
+//never leads out of StateFatalInstall so only an operator resetting the node
+//may call this. The caller must hold the lock.
+func (s *RestServer) resetNodeState(node *types.ScaleIONode, reason string) error {
+	if node.State != types.StateFatalInstall {
+		return types.ErrInvalidStateTransition
+	}
+
+	node.Failure = nil
+	s.recordTransition(node, types.StateUnknown, reason)
+
+	err := s.Store.SetNodeInfo(node.Hostname, node.Persona, node.State)
+	if err == nil {
+		err = s.Store.SetNodeRecord(node)
+	}
+	return err
+}
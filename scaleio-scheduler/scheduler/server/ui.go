@@ -0,0 +1,437 @@
+package server
+
+import (
+	"net/http"
+)
+
+//getUI serves the operator UI. The page is static and everything it shows
+//comes from the JSON API so it needs no access to the state itself.
+func getUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(uiIndex))
+}
+
+const uiIndex = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ScaleIO Framework</title>
+<style>` + uiStyle + `</style>
+</head>
+<body>
+<header>
+  <h1>ScaleIO Framework</h1>
+  <span id="version"></span>
+  <span id="live" class="badge">offline</span>
+  <form id="auth">
+    <input id="token" type="password" placeholder="API token" autocomplete="off">
+    <button type="submit">Save</button>
+  </form>
+</header>
+<div id="error" class="error hidden"></div>
+<main>
+  <section>
+    <h2>Health <span id="health" class="badge">unknown</span></h2>
+    <ul id="issues"></ul>
+  </section>
+  <section>
+    <h2>Nodes</h2>
+    <table>
+      <thead>
+        <tr><th>Hostname</th><th>Persona</th><th>Install</th><th>Last Contact</th><th>Last Error</th><th>Actions</th></tr>
+      </thead>
+      <tbody id="nodes"></tbody>
+    </table>
+  </section>
+  <section>
+    <h2>Topology</h2>
+    <div id="topology"></div>
+  </section>
+  <section>
+    <h2>Capacity <button id="expand">Expand StoragePools</button></h2>
+    <div id="capacity"></div>
+    <canvas id="history" width="900" height="180"></canvas>
+    <div id="pools"></div>
+  </section>
+  <section>
+    <h2>Events</h2>
+    <ul id="events"></ul>
+  </section>
+</main>
+<script>` + uiScript + `</script>
+</body>
+</html>
+`
+
+const uiStyle = `
+body { font-family: sans-serif; margin: 0; color: #222; background: #f4f5f7; }
+header { display: flex; align-items: center; gap: 1em; padding: 0.5em 1em; background: #2b3e50; color: #fff; }
+header h1 { font-size: 1.2em; margin: 0; }
+header form { margin-left: auto; }
+main { padding: 1em; }
+section { background: #fff; border-radius: 4px; padding: 0.5em 1em 1em; margin-bottom: 1em; }
+h2 { font-size: 1em; display: flex; align-items: center; gap: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.3em 0.5em; border-bottom: 1px solid #e1e4e8; font-size: 0.9em; }
+.badge { padding: 0.1em 0.5em; border-radius: 3px; background: #888; font-size: 0.8em; }
+.badge.on { background: #2e8b57; }
+.badge.ok { background: #2e8b57; }
+.badge.info { background: #3572b0; }
+.badge.warning { background: #e67e22; }
+.badge.critical { background: #c0392b; }
+#issues { list-style: none; padding: 0; font-size: 0.9em; }
+.error { background: #fbeaea; color: #a30000; padding: 0.5em 1em; }
+.hidden { display: none; }
+.bar { background: #e1e4e8; border-radius: 3px; height: 0.8em; width: 12em; overflow: hidden; }
+.bar div { background: #3572b0; height: 100%; }
+.bar.fatal div { background: #c0392b; }
+.bar.done div { background: #2e8b57; }
+.bar.full div { background: #e67e22; }
+.maintenance { color: #e67e22; font-weight: bold; }
+.liveness { font-weight: bold; }
+.liveness.online { color: #2e8b57; }
+.liveness.stale { color: #e67e22; }
+.liveness.offline { color: #c0392b; }
+.domain { border-left: 3px solid #3572b0; padding-left: 0.8em; margin-bottom: 0.8em; }
+.pool { margin-left: 1em; }
+.muted { color: #777; font-size: 0.85em; }
+#events { list-style: none; padding: 0; max-height: 20em; overflow-y: auto; font-size: 0.85em; }
+#events li { border-bottom: 1px solid #e1e4e8; padding: 0.2em 0; }
+`
+
+const uiScript = `
+(function () {
+  "use strict";
+
+  var API = "/api/v1";
+  var STEPS = [
+    [0, "Installing Prerequisite Packages"],
+    [1, "Sync on Prerequisite Install"],
+    [2, "Installing ScaleIO Packages"],
+    [3, "Creating ScaleIO Cluster"],
+    [4, "Initializing ScaleIO"],
+    [5, "Adding resources to ScaleIO cluster"],
+    [6, "Installing REX-Ray"],
+    [7, "Sync Before for Reboot"],
+    [8, "System is Rebooting"],
+    [1024, "ScaleIO Running"]
+  ];
+  var FATAL = 4096;
+  var FINISHED = 1024;
+  var MAX_EVENTS = 200;
+  var MAX_SAMPLES = 120;
+
+  var events = [];
+  var lastSequence = 0;
+  var samples = [];
+  var source = null;
+  var pending = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function esc(value) {
+    return String(value === undefined || value === null ? "" : value)
+      .replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;")
+      .replace(/"/g, "&quot;").replace(/'/g, "&#39;");
+  }
+
+  function token() { return window.localStorage.getItem("scaleioToken") || ""; }
+
+  function showError(message) {
+    var el = $("error");
+    el.textContent = message || "";
+    el.className = message ? "error" : "error hidden";
+  }
+
+  function request(method, path, body) {
+    var headers = { "Accept": "application/json" };
+    if (token()) { headers["Authorization"] = "Bearer " + token(); }
+    if (body !== undefined) { headers["Content-Type"] = "application/json"; }
+    return fetch(API + path, {
+      method: method,
+      headers: headers,
+      body: body === undefined ? undefined : JSON.stringify(body)
+    }).then(function (rsp) {
+      return rsp.text().then(function (text) {
+        var data = text ? JSON.parse(text) : null;
+        if (!rsp.ok) {
+          throw new Error((data && data.message) || (rsp.status + " " + rsp.statusText));
+        }
+        return data;
+      });
+    });
+  }
+
+  function stepOf(state) {
+    for (var i = 0; i < STEPS.length; i++) {
+      if (STEPS[i][0] === state) { return i; }
+    }
+    return -1;
+  }
+
+  function progress(node) {
+    var cls = "bar";
+    var label = node.statename;
+    var percent = 0;
+    if (node.state === FATAL) {
+      cls += " fatal";
+      label = "Installation Failed";
+      percent = 100;
+    } else {
+      var step = stepOf(node.state);
+      if (step >= 0) {
+        label = STEPS[step][1];
+        percent = Math.round(step / (STEPS.length - 1) * 100);
+      }
+      if (node.state === FINISHED) { cls += " done"; }
+    }
+    return "<div class=\"" + cls + "\"><div style=\"width:" + percent + "%\"></div></div>" +
+      "<span class=\"muted\">" + esc(label) + "</span>";
+  }
+
+  function age(timestamp) {
+    if (!timestamp) { return "never"; }
+    var secs = Math.max(0, Math.round(Date.now() / 1000 - timestamp));
+    if (secs < 120) { return secs + "s ago"; }
+    if (secs < 7200) { return Math.round(secs / 60) + "m ago"; }
+    return Math.round(secs / 3600) + "h ago";
+  }
+
+  function liveness(node) {
+    var status = node.liveness || "unknown";
+    return "<span class=\"liveness " + esc(status) + "\" title=\"" + esc(node.taskstate) + "\">" +
+      esc(status) + "</span> <span class=\"muted\">" + age(node.lastcontact) + "</span>";
+  }
+
+  function lastError(hostname) {
+    for (var i = events.length - 1; i >= 0; i--) {
+      var ev = events[i];
+      if (ev.hostname === hostname && /fatal|fail|error/i.test(ev.message)) {
+        return ev.message;
+      }
+    }
+    return "";
+  }
+
+  function failure(node) {
+    if (!node.failure) { return ""; }
+    var text = (node.failure.step || "Install") + " failed (retries: " + node.failure.retries + ")";
+    if (node.failure.nextretry) { text += ", next retry " + new Date(node.failure.nextretry * 1000).toLocaleTimeString(); }
+    return text;
+  }
+
+  function renderNodes(nodes) {
+    var rows = nodes.map(function (node) {
+      var actions = "";
+      if (node.state === FATAL && node.failure) {
+        actions += "<button data-action=\"retry\" data-host=\"" + esc(node.hostname) + "\">Retry</button> ";
+      }
+      if (node.state === FATAL) {
+        actions += "<button data-action=\"reset\" data-host=\"" + esc(node.hostname) + "\">Reset</button> ";
+      }
+      actions += "<button data-action=\"maintenance\" data-host=\"" + esc(node.hostname) +
+        "\" data-enabled=\"" + (!node.maintenance) + "\">" +
+        (node.maintenance ? "End Maintenance" : "Maintenance") + "</button>";
+      return "<tr><td>" + esc(node.hostname) +
+        (node.maintenance ? " <span class=\"maintenance\">maintenance</span>" : "") +
+        "<div class=\"muted\">" + esc(node.ipaddress) + "</div></td>" +
+        "<td>" + esc(node.personaname) + "</td>" +
+        "<td>" + progress(node) + "</td>" +
+        "<td>" + liveness(node) + "</td>" +
+        "<td class=\"muted\" title=\"" + esc(node.failure ? node.failure.output : "") + "\">" +
+        esc(failure(node) || lastError(node.hostname)) + "</td>" +
+        "<td>" + actions + "</td></tr>";
+    });
+    $("nodes").innerHTML = rows.length ? rows.join("") :
+      "<tr><td colspan=\"6\" class=\"muted\">No nodes have joined yet</td></tr>";
+  }
+
+  function renderTopology(nodes) {
+    //regroup the per-node view by ProtectionDomain and StoragePool
+    var domains = {};
+    nodes.forEach(function (node) {
+      (node.domains || []).forEach(function (nd) {
+        var domain = domains[nd.name] || (domains[nd.name] = { sdss: [], pools: {} });
+        (nd.sdss || []).forEach(function (sds) {
+          domain.sdss.push({ name: sds.name, mode: sds.mode, hostname: node.hostname });
+        });
+        (nd.pools || []).forEach(function (np) {
+          var pool = domain.pools[np.name] || (domain.pools[np.name] = []);
+          (np.devices || []).forEach(function (device) {
+            pool.push(node.hostname + ":" + device);
+          });
+        });
+      });
+    });
+
+    var names = Object.keys(domains).sort();
+    if (!names.length) {
+      $("topology").innerHTML = "<span class=\"muted\">Nothing has been added to ScaleIO yet</span>";
+      return;
+    }
+    $("topology").innerHTML = names.map(function (name) {
+      var domain = domains[name];
+      var sdss = domain.sdss.map(function (sds) {
+        return esc(sds.name) + " <span class=\"muted\">(" + esc(sds.hostname) + ")</span>";
+      }).join(", ");
+      var pools = Object.keys(domain.pools).sort().map(function (pool) {
+        var devices = domain.pools[pool];
+        return "<div class=\"pool\"><b>" + esc(pool) + "</b> <span class=\"muted\">" +
+          devices.length + " devices</span><div class=\"muted\">" +
+          devices.map(esc).join(", ") + "</div></div>";
+      }).join("");
+      return "<div class=\"domain\"><b>" + esc(name) + "</b>" +
+        "<div class=\"muted\">SDS: " + (sdss || "none") + "</div>" + pools + "</div>";
+    }).join("");
+  }
+
+  function renderCapacity(capacity) {
+    var used = capacity.usedkb + capacity.fakeusedkb;
+    var percent = capacity.capacitykb ? Math.round(used / capacity.capacitykb * 100) : 0;
+    $("capacity").innerHTML = "Capacity: " + capacity.capacitykb + " KB, Used: " + capacity.usedkb +
+      " KB, Fake Used: " + capacity.fakeusedkb + " KB, " + percent + "% of " +
+      capacity.usedthreshold + "% threshold";
+
+    samples.push({ time: Date.now(), percent: percent, threshold: capacity.usedthreshold });
+    if (samples.length > MAX_SAMPLES) { samples.shift(); }
+    drawHistory();
+
+    $("pools").innerHTML = (capacity.pools || []).map(function (pool) {
+      var p = pool.capacitykb ? Math.round(pool.usedkb / pool.capacitykb * 100) : 0;
+      var cls = p > capacity.usedthreshold ? "bar full" : "bar";
+      return "<div>" + esc(pool.domain) + " / " + esc(pool.pool) +
+        "<div class=\"" + cls + "\"><div style=\"width:" + Math.min(p, 100) + "%\"></div></div>" +
+        "<span class=\"muted\">" + pool.usedkb + " of " + pool.capacitykb + " KB</span></div>";
+    }).join("");
+  }
+
+  function drawHistory() {
+    var canvas = $("history");
+    var ctx = canvas.getContext("2d");
+    var w = canvas.width;
+    var h = canvas.height;
+    ctx.clearRect(0, 0, w, h);
+    ctx.strokeStyle = "#e1e4e8";
+    ctx.strokeRect(0, 0, w, h);
+    if (!samples.length) { return; }
+
+    var x = function (i) { return samples.length === 1 ? w : i / (samples.length - 1) * w; };
+    var y = function (percent) { return h - Math.min(percent, 100) / 100 * h; };
+
+    ctx.strokeStyle = "#e67e22";
+    ctx.setLineDash([4, 4]);
+    ctx.beginPath();
+    ctx.moveTo(0, y(samples[samples.length - 1].threshold));
+    ctx.lineTo(w, y(samples[samples.length - 1].threshold));
+    ctx.stroke();
+    ctx.setLineDash([]);
+
+    ctx.strokeStyle = "#3572b0";
+    ctx.beginPath();
+    samples.forEach(function (sample, i) {
+      if (i === 0) { ctx.moveTo(x(i), y(sample.percent)); } else { ctx.lineTo(x(i), y(sample.percent)); }
+    });
+    ctx.stroke();
+  }
+
+  function renderHealth(health) {
+    $("health").textContent = health.severity;
+    $("health").className = "badge " + health.severity;
+    $("issues").innerHTML = (health.issues || []).map(function (issue) {
+      return "<li><span class=\"badge " + esc(issue.severity) + "\">" + esc(issue.severity) + "</span> " +
+        esc(issue.message) + (issue.hostname ? " <span class=\"muted\">" + esc(issue.hostname) + "</span>" : "") +
+        "</li>";
+    }).join("") || (health.checked ?
+      "<li class=\"muted\">Checked " + age(health.checked) + "</li>" :
+      "<li class=\"muted\">Not checked yet</li>");
+  }
+
+  function renderEvents() {
+    $("events").innerHTML = events.slice().reverse().map(function (ev) {
+      return "<li><span class=\"muted\">" + esc(new Date(ev.timestamp * 1000).toLocaleString()) +
+        "</span> <b>" + esc(ev.type) + "</b> " + esc(ev.hostname) + " " + esc(ev.message) + "</li>";
+    }).join("");
+  }
+
+  function refresh() {
+    pending = null;
+    var query = lastSequence > 0 ? "since=" + lastSequence : "limit=" + MAX_EVENTS;
+    return request("GET", "/events?" + query).then(function (list) {
+      (list || []).forEach(function (ev) {
+        events.push(ev);
+        lastSequence = Math.max(lastSequence, ev.sequence);
+      });
+      if (events.length > MAX_EVENTS) { events = events.slice(events.length - MAX_EVENTS); }
+      renderEvents();
+      return Promise.all([request("GET", "/nodes"), request("GET", "/capacity"), request("GET", "/health")]);
+    }).then(function (results) {
+      renderNodes(results[0] || []);
+      renderTopology(results[0] || []);
+      renderCapacity(results[1]);
+      renderHealth(results[2]);
+      showError("");
+    }).catch(function (err) {
+      showError(err.message);
+    });
+  }
+
+  function schedule() {
+    if (!pending) { pending = window.setTimeout(refresh, 250); }
+  }
+
+  function watch() {
+    if (source) { source.close(); }
+    var url = API + "/watch" + (token() ? "?token=" + encodeURIComponent(token()) : "");
+    source = new EventSource(url);
+    source.onopen = function () { $("live").textContent = "live"; $("live").className = "badge on"; };
+    source.onerror = function () { $("live").textContent = "offline"; $("live").className = "badge"; };
+    ["NodeState", "PersonaAssigned", "DevicesAdvertised", "ClusterConfigured",
+      "ClusterSetting", "NodeMaintenance", "NodeLiveness", "ClusterHealth", "Resync"].forEach(function (type) {
+      source.addEventListener(type, schedule);
+    });
+  }
+
+  function act(method, path, body, confirmText) {
+    if (confirmText && !window.confirm(confirmText)) { return; }
+    request(method, path, body).then(schedule).catch(function (err) { showError(err.message); });
+  }
+
+  $("nodes").addEventListener("click", function (e) {
+    var btn = e.target;
+    var host = btn.getAttribute("data-host");
+    if (!host) { return; }
+    var path = "/nodes/" + encodeURIComponent(host);
+    if (btn.getAttribute("data-action") === "retry") {
+      act("POST", path + "/retry", undefined, "Run the failed step on " + host + " again?");
+    } else if (btn.getAttribute("data-action") === "reset") {
+      act("POST", path + "/reset", undefined, "Start the install of " + host + " over?");
+    } else {
+      var enabled = btn.getAttribute("data-enabled") === "true";
+      act("POST", path + "/maintenance", { maintenance: enabled },
+        (enabled ? "Put " : "Take ") + host + (enabled ? " in" : " out of") + " maintenance?");
+    }
+  });
+
+  $("expand").addEventListener("click", function () {
+    act("POST", "/expand", undefined, "Expand all StoragePools?");
+  });
+
+  $("auth").addEventListener("submit", function (e) {
+    e.preventDefault();
+    window.localStorage.setItem("scaleioToken", $("token").value);
+    $("token").value = "";
+    watch();
+    refresh();
+  });
+
+  request("GET", "/version").then(function (v) { $("version").textContent = v.versionstr; });
+  watch();
+  refresh();
+  //catch what the stream does not carry (ie pings and capacity)
+  window.setInterval(schedule, 15000);
+})();
+`
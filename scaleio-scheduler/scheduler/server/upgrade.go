@@ -0,0 +1,480 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+//upgradeInProgress is true when the upgrade has not finished
+func upgradeInProgress(upgrade *types.Upgrade) bool {
+	return upgrade != nil && (upgrade.Status == types.UpgradeRunning ||
+		upgrade.Status == types.UpgradePaused || upgrade.Status == types.UpgradeRollingBack)
+}
+
+//upgradeOrder is the order the nodes are upgraded in. The TieBreaker goes
+//first, then the Secondary MDM, then the Primary MDM and then the data nodes
+//one at a time.
+func upgradeOrder(nodes types.ScaleIONodes) []string {
+	order := make([]string, 0)
+	for _, persona := range []int{types.PersonaTb, types.PersonaMdmSecondary, types.PersonaMdmPrimary} {
+		for _, node := range nodes {
+			if node.Persona == persona && len(node.Hostname) > 0 {
+				order = append(order, node.Hostname)
+			}
+		}
+	}
+
+	data := make([]string, 0)
+	for _, node := range nodes {
+		if node.Persona == types.PersonaNode && len(node.Hostname) > 0 {
+			data = append(data, node.Hostname)
+		}
+	}
+	sort.Strings(data)
+
+	return append(order, data...)
+}
+
+//packageSettings maps the live settings to the package URIs
+func packageSettings(ubuntu14 types.Ubuntu14Packages, rhel7 types.Rhel7Packages) map[string]string {
+	return map[string]string{
+		"scaleio.ubuntu14.mdm": ubuntu14.Mdm,
+		"scaleio.ubuntu14.sds": ubuntu14.Sds,
+		"scaleio.ubuntu14.sdc": ubuntu14.Sdc,
+		"scaleio.ubuntu14.lia": ubuntu14.Lia,
+		"scaleio.ubuntu14.gw":  ubuntu14.Gw,
+		"scaleio.rhel7.mdm":    rhel7.Mdm,
+		"scaleio.rhel7.sds":    rhel7.Sds,
+		"scaleio.rhel7.sdc":    rhel7.Sdc,
+		"scaleio.rhel7.lia":    rhel7.Lia,
+		"scaleio.rhel7.gw":     rhel7.Gw,
+	}
+}
+
+//applyPackages changes the package URIs the executors install. The URIs are
+//also saved in the store so the store watcher doesnt put back the old ones.
+//The caller must hold the lock.
+func (s *RestServer) applyPackages(ubuntu14 types.Ubuntu14Packages, rhel7 types.Rhel7Packages) {
+	for name, value := range packageSettings(ubuntu14, rhel7) {
+		old, err := liveSettings[name](s, value)
+		if err != nil || old == value {
+			continue
+		}
+
+		log.Infoln("Package", name, "changed from", old, "to", value)
+		if err := s.Store.SetSetting(name, value); err != nil {
+			log.Warnln("Failed to save", name, "to the store:", err)
+		}
+		s.Publish(&types.Delta{
+			Type:    types.DeltaClusterSetting,
+			Setting: name,
+			Value:   value,
+		})
+	}
+}
+
+//saveUpgrade saves the upgrade in the store. The caller must hold the lock.
+func (s *RestServer) saveUpgrade() {
+	if err := s.Store.SetUpgrade(s.upgrade); err != nil {
+		log.Warnln("Failed to save the upgrade to the store:", err)
+	}
+}
+
+//startRollback puts back the previous packages and undoes the upgrade starting
+//with the last node upgraded. A node still upgrading picks up the previous
+//packages when it finishes. The caller must hold the lock.
+func (s *RestServer) startRollback() {
+	upgrade := s.upgrade
+	upgrade.Status = types.UpgradeRollingBack
+	upgrade.Rollback = true
+	upgrade.Finished = 0
+	s.applyPackages(upgrade.PreviousUbuntu14, upgrade.PreviousRhel7)
+
+	if len(upgrade.Current) > 0 {
+		if !doesNeedleExist(upgrade.Upgraded, upgrade.Current) {
+			upgrade.Upgraded = append(upgrade.Upgraded, upgrade.Current)
+		}
+		node := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, upgrade.Current)
+		if node != nil && node.State == types.StateUpgradeCluster {
+			upgrade.CurrentStarted = time.Now().Unix()
+		} else {
+			upgrade.Current = ""
+			upgrade.CurrentStarted = 0
+		}
+	}
+
+	s.RecordEvent(types.EventUpgrade, "", "Rolling back the upgrade")
+}
+
+//upgradeFailed pauses the upgrade or rolls it back when the operator asked
+//for that. The caller must hold the lock.
+func (s *RestServer) upgradeFailed(hostname string, message string) {
+	upgrade := s.upgrade
+	upgrade.Error = message
+	s.RecordEvent(types.EventUpgrade, hostname, message)
+
+	if upgrade.RollbackOnFailure && !upgrade.Rollback {
+		s.startRollback()
+	} else {
+		upgrade.Status = types.UpgradePaused
+		s.RecordEvent(types.EventUpgrade, hostname, "Upgrade paused")
+	}
+	s.saveUpgrade()
+}
+
+//nextUpgradeNode is the next node to upgrade, or to roll back
+func nextUpgradeNode(upgrade *types.Upgrade) string {
+	if upgrade.Rollback {
+		if len(upgrade.Upgraded) == 0 {
+			return ""
+		}
+		return upgrade.Upgraded[len(upgrade.Upgraded)-1]
+	}
+
+	for _, hostname := range upgrade.Order {
+		if !doesNeedleExist(upgrade.Upgraded, hostname) {
+			return hostname
+		}
+	}
+	return ""
+}
+
+//startNodeUpgrade moves a node to StateUpgradeCluster so its executor
+//installs the packages. A node whose upgrade failed is retried. The caller must
+//hold the lock.
+func (s *RestServer) startNodeUpgrade(node *types.ScaleIONode, reason string) error {
+	if node.Maintenance {
+		return errors.New("Node " + node.Hostname + " is in maintenance")
+	}
+	if node.State == types.StateFatalInstall && node.Failure != nil &&
+		node.Failure.State == types.StateUpgradeCluster {
+		return s.RetryNode(node, reason)
+	}
+	if node.State == types.StateUpgradeCluster {
+		//already retried and installs whichever packages are current
+		return nil
+	}
+	if node.State != types.StateFinishInstall {
+		return errors.New("Node " + node.Hostname + " is in state " + common.StateIDToString(node.State))
+	}
+	_, err := s.TransitionNode(node, types.StateUpgradeCluster, reason)
+	return err
+}
+
+//progressUpgrade moves a rolling upgrade along. The node being upgraded must
+//reach StateFinishInstall and ScaleIO must finish rebuilding and rebalancing
+//before the next node is started.
+func (s *RestServer) progressUpgrade() {
+	s.Lock()
+	defer s.Unlock()
+
+	upgrade := s.upgrade
+	if upgrade == nil || (upgrade.Status != types.UpgradeRunning &&
+		upgrade.Status != types.UpgradeRollingBack) {
+		return
+	}
+
+	now := time.Now()
+	timedOut := upgrade.CurrentStarted > 0 &&
+		now.Sub(time.Unix(upgrade.CurrentStarted, 0)) > s.Config.UpgradeTimeout
+
+	if current := upgrade.Current; len(current) > 0 {
+		node := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, current)
+		switch {
+		case node == nil:
+			s.upgradeFailed(current, "Node "+current+" is no longer in the cluster")
+			return
+		case node.State == types.StateFatalInstall:
+			step := ""
+			if node.Failure != nil {
+				step = node.Failure.Step
+			}
+			s.upgradeFailed(current, "Node "+current+" failed to upgrade. Step: "+step)
+			return
+		case node.State != types.StateFinishInstall:
+			if timedOut {
+				s.upgradeFailed(current, "Node "+current+" did not upgrade within "+
+					s.Config.UpgradeTimeout.String())
+			}
+			return
+		}
+
+		//talking to ScaleIO can take a while
+		s.Unlock()
+		healthy, err := s.checkClusterHealth()
+		s.Lock()
+		if s.upgrade != upgrade || upgrade.Current != current ||
+			(upgrade.Status != types.UpgradeRunning && upgrade.Status != types.UpgradeRollingBack) {
+			//changed by an operator in the meantime
+			return
+		}
+		if err != nil {
+			s.upgradeFailed(current, err.Error())
+			return
+		}
+		if !healthy {
+			if timedOut {
+				s.upgradeFailed(current, "ScaleIO did not finish rebuilding and rebalancing within "+
+					s.Config.UpgradeTimeout.String())
+			}
+			return
+		}
+
+		if upgrade.Rollback {
+			upgraded := make([]string, 0)
+			for _, hostname := range upgrade.Upgraded {
+				if hostname != current {
+					upgraded = append(upgraded, hostname)
+				}
+			}
+			upgrade.Upgraded = upgraded
+			s.RecordEvent(types.EventUpgrade, current, "Node rolled back")
+		} else {
+			upgrade.Upgraded = append(upgrade.Upgraded, current)
+			s.RecordEvent(types.EventUpgrade, current, "Node upgraded")
+		}
+		upgrade.Current = ""
+		upgrade.CurrentStarted = 0
+	}
+
+	hostname := nextUpgradeNode(upgrade)
+	if len(hostname) == 0 {
+		upgrade.Finished = now.Unix()
+		if upgrade.Rollback {
+			upgrade.Status = types.UpgradeRolledBack
+			s.RecordEvent(types.EventUpgrade, "", "Upgrade rolled back")
+		} else {
+			upgrade.Status = types.UpgradeComplete
+			s.RecordEvent(types.EventUpgrade, "", "Upgrade complete")
+		}
+		s.saveUpgrade()
+		return
+	}
+
+	reason := "Rolling upgrade"
+	if upgrade.Rollback {
+		reason = "Rolling back the upgrade"
+	}
+	node := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, hostname)
+	if node == nil {
+		s.upgradeFailed(hostname, "Node "+hostname+" is no longer in the cluster")
+		return
+	}
+	if err := s.startNodeUpgrade(node, reason); err != nil {
+		s.upgradeFailed(hostname, "Unable to start the upgrade of "+hostname+": "+err.Error())
+		return
+	}
+
+	upgrade.Current = hostname
+	upgrade.CurrentStarted = now.Unix()
+	s.RecordEvent(types.EventUpgrade, hostname, reason)
+	s.saveUpgrade()
+}
+
+//upgradeInfo copies the upgrade so it can be encoded without the lock. The
+//caller must hold the lock.
+func (s *RestServer) upgradeInfo() *types.Upgrade {
+	info := *s.upgrade
+	info.Order = append([]string{}, s.upgrade.Order...)
+	info.Upgraded = append([]string{}, s.upgrade.Upgraded...)
+	return &info
+}
+
+//writeUpgrade encodes the upgrade with the status code
+func writeUpgrade(w http.ResponseWriter, upgrade *types.Upgrade, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(upgrade); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func getUpgrade(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	if server.upgrade == nil {
+		server.Unlock()
+		writeError(w, "No upgrade has been started", http.StatusNotFound)
+		return
+	}
+	info := server.upgradeInfo()
+	server.Unlock()
+
+	writeUpgrade(w, info, http.StatusOK)
+}
+
+//fillPackages keeps the current URI for any package left empty
+func fillPackages(request *types.UpgradeRequest, ubuntu14 types.Ubuntu14Packages, rhel7 types.Rhel7Packages) {
+	fill := func(value *string, current string) {
+		if len(*value) == 0 {
+			*value = current
+		}
+	}
+	fill(&request.Ubuntu14.Mdm, ubuntu14.Mdm)
+	fill(&request.Ubuntu14.Sds, ubuntu14.Sds)
+	fill(&request.Ubuntu14.Sdc, ubuntu14.Sdc)
+	fill(&request.Ubuntu14.Lia, ubuntu14.Lia)
+	fill(&request.Ubuntu14.Gw, ubuntu14.Gw)
+	fill(&request.Rhel7.Mdm, rhel7.Mdm)
+	fill(&request.Rhel7.Sds, rhel7.Sds)
+	fill(&request.Rhel7.Sdc, rhel7.Sdc)
+	fill(&request.Rhel7.Lia, rhel7.Lia)
+	fill(&request.Rhel7.Gw, rhel7.Gw)
+}
+
+func startUpgrade(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	request := &types.UpgradeRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+
+	server.Lock()
+	if !server.State.ScaleIO.Configured {
+		server.Unlock()
+		writeError(w, common.ErrClusterNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if upgradeInProgress(server.upgrade) {
+		server.Unlock()
+		writeError(w, "A rolling upgrade is already in progress", http.StatusConflict)
+		return
+	}
+
+	ubuntu14 := server.State.ScaleIO.Ubuntu14
+	rhel7 := server.State.ScaleIO.Rhel7
+	fillPackages(request, ubuntu14, rhel7)
+	if request.Ubuntu14 == ubuntu14 && request.Rhel7 == rhel7 {
+		server.Unlock()
+		writeError(w, "The packages are already installed", http.StatusBadRequest)
+		return
+	}
+
+	for _, node := range server.State.ScaleIO.Nodes {
+		if node.Decommission != nil {
+			server.Unlock()
+			writeError(w, "Node "+node.Hostname+" is being decommissioned", http.StatusConflict)
+			return
+		}
+		if node.State != types.StateFinishInstall {
+			state := node.State
+			server.Unlock()
+			writeError(w, "Node "+node.Hostname+" is in state "+common.StateIDToString(state)+
+				". Every node must be in state "+common.StateIDToString(types.StateFinishInstall)+
+				" to upgrade", http.StatusConflict)
+			return
+		}
+	}
+
+	server.upgrade = &types.Upgrade{
+		Status:            types.UpgradeRunning,
+		Ubuntu14:          request.Ubuntu14,
+		Rhel7:             request.Rhel7,
+		PreviousUbuntu14:  ubuntu14,
+		PreviousRhel7:     rhel7,
+		RollbackOnFailure: request.RollbackOnFailure,
+		Order:             upgradeOrder(server.State.ScaleIO.Nodes),
+		Upgraded:          make([]string, 0),
+		Started:           time.Now().Unix(),
+	}
+	server.applyPackages(request.Ubuntu14, request.Rhel7)
+	server.saveUpgrade()
+	server.RecordEvent(types.EventUpgrade, "", "Upgrade started")
+	info := server.upgradeInfo()
+	server.Unlock()
+
+	//picked up by MonitorForState on the next pass
+	writeUpgrade(w, info, http.StatusAccepted)
+}
+
+func pauseUpgrade(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	upgrade := server.upgrade
+	if upgrade == nil || (upgrade.Status != types.UpgradeRunning &&
+		upgrade.Status != types.UpgradeRollingBack) {
+		server.Unlock()
+		writeError(w, "There is no running upgrade to pause", http.StatusConflict)
+		return
+	}
+
+	//the node being upgraded finishes on its own
+	upgrade.Status = types.UpgradePaused
+	server.saveUpgrade()
+	server.RecordEvent(types.EventUpgrade, "", "Upgrade paused by an operator")
+	info := server.upgradeInfo()
+	server.Unlock()
+
+	writeUpgrade(w, info, http.StatusOK)
+}
+
+func resumeUpgrade(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	upgrade := server.upgrade
+	if upgrade == nil || upgrade.Status != types.UpgradePaused {
+		server.Unlock()
+		writeError(w, "There is no paused upgrade to resume", http.StatusConflict)
+		return
+	}
+
+	upgrade.Status = types.UpgradeRunning
+	if upgrade.Rollback {
+		upgrade.Status = types.UpgradeRollingBack
+	}
+	upgrade.Error = ""
+
+	//try the node that failed again
+	if len(upgrade.Current) > 0 {
+		node := common.FindScaleIONodeByHostname(server.State.ScaleIO.Nodes, upgrade.Current)
+		if node != nil && types.IsValidRetry(node.State, node.Failure) &&
+			node.Failure.State == types.StateUpgradeCluster {
+			if err := server.RetryNode(node, "Upgrade resumed by an operator"); err != nil {
+				log.Warnln("Failed to retry node", node.Hostname, ":", err)
+			}
+		}
+		upgrade.CurrentStarted = time.Now().Unix()
+	}
+
+	server.saveUpgrade()
+	server.RecordEvent(types.EventUpgrade, "", "Upgrade resumed by an operator")
+	info := server.upgradeInfo()
+	server.Unlock()
+
+	writeUpgrade(w, info, http.StatusOK)
+}
+
+func rollbackUpgrade(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	server.Lock()
+	upgrade := server.upgrade
+	if upgrade == nil || upgrade.Rollback || (upgrade.Status != types.UpgradeRunning &&
+		upgrade.Status != types.UpgradePaused && upgrade.Status != types.UpgradeComplete) {
+		server.Unlock()
+		writeError(w, "There is no upgrade to roll back", http.StatusConflict)
+		return
+	}
+
+	upgrade.Error = ""
+	server.startRollback()
+	server.saveUpgrade()
+	info := server.upgradeInfo()
+	server.Unlock()
+
+	writeUpgrade(w, info, http.StatusAccepted)
+}
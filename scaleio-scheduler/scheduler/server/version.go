@@ -20,7 +20,7 @@ func getVersion(w http.ResponseWriter, r *http.Request, server *RestServer) {
 
 	response, err := json.MarshalIndent(ver, "", "  ")
 	if err != nil {
-		http.Error(w, "Unable to marshall the response", http.StatusBadRequest)
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
 		return
 	}
 
@@ -0,0 +1,570 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	goscaleio "github.com/codedellemc/goscaleio"
+	siotypes "github.com/codedellemc/goscaleio/types/v1"
+	"github.com/gorilla/mux"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//VolumeGranularityInGB ScaleIO allocates volumes in multiples of 8GB
+	VolumeGranularityInGB = 8
+)
+
+//poolRef names a StoragePool and the ProtectionDomain it belongs to
+type poolRef struct {
+	Domain string
+	Pool   string
+	sp     *goscaleio.StoragePool
+}
+
+//scaleioSession is an authenticated connection to the ScaleIO Gateway along
+//with the hosts known to the framework
+type scaleioSession struct {
+	client *goscaleio.Client
+	system *goscaleio.System
+	hosts  map[string]string
+}
+
+//openScaleIO logs in to the ScaleIO Gateway with the credentials of the
+//framework so callers of the REST API don't need their own
+func (s *RestServer) openScaleIO() (*scaleioSession, error) {
+	log.Debugln("openScaleIO ENTER")
+
+	s.Lock()
+	configured := s.State.ScaleIO.Configured
+	state := cloneState(s.State)
+	connect := s.connectScaleIO
+	s.Unlock()
+
+	if !configured {
+		log.Debugln("openScaleIO LEAVE")
+		return nil, common.ErrClusterNotConfigured
+	}
+
+	client, err := connect(state)
+	if err != nil {
+		log.Errorln("connectScaleIO Failed. Err:", err)
+		log.Debugln("openScaleIO LEAVE")
+		return nil, err
+	}
+
+	system, err := client.FindSystem(state.ScaleIO.ClusterID, state.ScaleIO.ClusterName, "")
+	if err != nil {
+		log.Errorln("FindSystem Error:", err)
+		s.Metrics.ScaleIOError("FindSystem")
+		log.Debugln("openScaleIO LEAVE")
+		return nil, err
+	}
+
+	//IP -> hostname so SDCs can be shown by their framework hostname
+	hosts := make(map[string]string)
+	for _, node := range state.ScaleIO.Nodes {
+		hosts[node.IPAddress] = node.Hostname
+	}
+
+	log.Debugln("openScaleIO Succeeded")
+	log.Debugln("openScaleIO LEAVE")
+	return &scaleioSession{
+		client: client,
+		system: system,
+		hosts:  hosts,
+	}, nil
+}
+
+//pools returns every StoragePool by ID
+func (s *RestServer) pools(session *scaleioSession) (map[string]*poolRef, error) {
+	domains, err := session.system.GetProtectionDomain("")
+	if err != nil {
+		log.Errorln("GetProtectionDomain Error:", err)
+		s.Metrics.ScaleIOError("GetProtectionDomain")
+		return nil, err
+	}
+
+	pools := make(map[string]*poolRef)
+	for _, tmpDomain := range domains {
+		scaleioDomain := goscaleio.NewProtectionDomainEx(session.client, tmpDomain)
+		storagePools, err := scaleioDomain.GetStoragePool("")
+		if err != nil {
+			log.Errorln("GetStoragePool Error:", err)
+			s.Metrics.ScaleIOError("GetStoragePool")
+			return nil, err
+		}
+		for _, tmpPool := range storagePools {
+			pools[tmpPool.ID] = &poolRef{
+				Domain: tmpDomain.Name,
+				Pool:   tmpPool.Name,
+				sp:     goscaleio.NewStoragePoolEx(session.client, tmpPool),
+			}
+		}
+	}
+	return pools, nil
+}
+
+//findSdc returns the SDC on the node with the given framework hostname
+func (s *RestServer) findSdc(session *scaleioSession, hostname string) (*goscaleio.Sdc, error) {
+	s.Lock()
+	node := common.FindScaleIONodeByHostname(s.State.ScaleIO.Nodes, hostname)
+	ip := ""
+	if node != nil {
+		ip = node.IPAddress
+	}
+	s.Unlock()
+
+	if len(ip) == 0 {
+		return nil, common.ErrNodeNotFound
+	}
+
+	sdc, err := session.system.FindSdc("SdcIp", ip)
+	if err != nil {
+		log.Errorln("FindSdc Error:", err)
+		s.Metrics.ScaleIOError("FindSdc")
+		return nil, err
+	}
+	return sdc, nil
+}
+
+//findVolume returns the volume with the given name
+func (s *RestServer) findVolume(session *scaleioSession, name string) (*siotypes.Volume, bool, error) {
+	id, err := session.client.FindVolumeID(name)
+	if err != nil {
+		log.Debugln("FindVolumeID(", name, ") Error:", err)
+		return nil, false, nil
+	}
+
+	volumes, err := session.client.GetVolume("", id, "", "", true)
+	if err != nil {
+		log.Errorln("GetVolume Error:", err)
+		s.Metrics.ScaleIOError("GetVolume")
+		return nil, false, err
+	}
+	if len(volumes) == 0 {
+		return nil, false, nil
+	}
+	return volumes[0], true, nil
+}
+
+func newVolumeInfo(volume *siotypes.Volume, pools map[string]*poolRef, hosts map[string]string) *types.VolumeInfo {
+	info := &types.VolumeInfo{
+		ID:           volume.ID,
+		Name:         volume.Name,
+		SizeInKb:     volume.SizeInKb,
+		Type:         volume.VolumeType,
+		AncestorID:   volume.AncestorVolumeID,
+		CreationTime: int64(volume.CreationTime),
+		MappedHosts:  make([]string, 0),
+		Tags:         make([]string, 0),
+	}
+	if pool := pools[volume.StoragePoolID]; pool != nil {
+		info.Domain = pool.Domain
+		info.Pool = pool.Pool
+	}
+	for _, mapped := range volume.MappedSdcInfo {
+		if hostname, ok := hosts[mapped.SdcIP]; ok {
+			info.MappedHosts = append(info.MappedHosts, hostname)
+		} else {
+			info.MappedHosts = append(info.MappedHosts, mapped.SdcIP)
+		}
+	}
+	sort.Strings(info.MappedHosts)
+	return info
+}
+
+//writeScaleIOError maps errors talking to ScaleIO to a status code
+func writeScaleIOError(w http.ResponseWriter, err error) {
+	switch err {
+	case common.ErrClusterNotConfigured:
+		writeError(w, err.Error(), http.StatusServiceUnavailable)
+	case common.ErrNodeNotFound:
+		writeError(w, "Unable to find the Node", http.StatusNotFound)
+	case common.ErrVolumeNotFound:
+		writeError(w, "Unable to find the Volume", http.StatusNotFound)
+	default:
+		writeError(w, "ScaleIO Gateway Err: "+err.Error(), http.StatusBadGateway)
+	}
+}
+
+//volumeInfo re-reads a volume after a change
+func (s *RestServer) volumeInfo(session *scaleioSession, name string) (*types.VolumeInfo, error) {
+	volume, found, err := s.findVolume(session, name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, common.ErrVolumeNotFound
+	}
+	pools, err := s.pools(session)
+	if err != nil {
+		return nil, err
+	}
+	info := newVolumeInfo(volume, pools, session.hosts)
+	info.Tags = s.Store.GetVolumeTags(volume.ID)
+	return info, nil
+}
+
+func writeVolume(w http.ResponseWriter, code int, info interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+	}
+}
+
+func getVolumes(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	snapshots := r.URL.Query().Get("snapshots") == "true"
+
+	session, err := server.openScaleIO()
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	pools, err := server.pools(session)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	volumes, err := session.client.GetVolume("", "", "", "", snapshots)
+	if err != nil {
+		log.Errorln("GetVolume Error:", err)
+		server.Metrics.ScaleIOError("GetVolume")
+		writeScaleIOError(w, err)
+		return
+	}
+
+	infos := make([]*types.VolumeInfo, 0)
+	for _, volume := range volumes {
+		if !snapshots && len(volume.AncestorVolumeID) > 0 {
+			continue
+		}
+		info := newVolumeInfo(volume, pools, session.hosts)
+		info.Tags = server.Store.GetVolumeTags(volume.ID)
+		infos = append(infos, info)
+	}
+
+	writeVolume(w, http.StatusOK, infos)
+}
+
+func getScaleioVolume(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	name := mux.Vars(r)["name"]
+
+	session, err := server.openScaleIO()
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	info, err := server.volumeInfo(session, name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	writeVolume(w, http.StatusOK, info)
+}
+
+func createScaleioVolume(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	create := &types.CreateVolume{}
+	if err := json.Unmarshal(body, &create); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+	if len(create.Name) == 0 || create.SizeInGB <= 0 {
+		writeError(w, "A name and a size are required", http.StatusBadRequest)
+		return
+	}
+	if len(create.Domain) == 0 {
+		create.Domain = server.Config.ProtectionDomain
+	}
+	if len(create.Pool) == 0 {
+		create.Pool = server.Config.StoragePool
+	}
+
+	session, err := server.openScaleIO()
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	if _, found, _ := server.findVolume(session, create.Name); found {
+		writeError(w, "Volume "+create.Name+" already exists", http.StatusConflict)
+		return
+	}
+
+	pools, err := server.pools(session)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+	var pool *poolRef
+	for _, ref := range pools {
+		if ref.Domain == create.Domain && ref.Pool == create.Pool {
+			pool = ref
+		}
+	}
+	if pool == nil {
+		writeError(w, "Unable to find StoragePool "+create.Pool+" in ProtectionDomain "+
+			create.Domain, http.StatusBadRequest)
+		return
+	}
+
+	volumeType := "ThinProvisioned"
+	if create.Thick {
+		volumeType = "ThickProvisioned"
+	}
+	resp, err := pool.sp.CreateVolume(&siotypes.VolumeParam{
+		Name:           create.Name,
+		VolumeSizeInKb: strconv.Itoa(create.SizeInGB * 1024 * 1024),
+		VolumeType:     volumeType,
+	})
+	if err != nil {
+		log.Errorln("CreateVolume Error:", err)
+		server.Metrics.ScaleIOError("CreateVolume")
+		writeScaleIOError(w, err)
+		return
+	}
+
+	if len(create.Tags) > 0 {
+		err = server.Store.SetVolumeTags(resp.ID, create.Tags)
+		if err != nil {
+			log.Warnln("Failed to save the tags of volume", create.Name, ":", err)
+		}
+	}
+
+	server.RecordEvent(types.EventVolumeUpdated, "", "Volume "+create.Name+" of "+
+		strconv.Itoa(create.SizeInGB)+"GB created in StoragePool "+create.Pool)
+
+	info, err := server.volumeInfo(session, create.Name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	writeVolume(w, http.StatusCreated, info)
+}
+
+func deleteVolume(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	name := mux.Vars(r)["name"]
+
+	session, err := server.openScaleIO()
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	info, err := server.volumeInfo(session, name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+	if len(info.MappedHosts) > 0 {
+		writeError(w, "Volume "+name+" is still mapped", http.StatusConflict)
+		return
+	}
+
+	volume := goscaleio.NewVolume(session.client)
+	volume.Volume = &siotypes.Volume{ID: info.ID, Name: info.Name}
+	err = volume.RemoveVolume("ONLY_ME")
+	if err != nil {
+		log.Errorln("RemoveVolume Error:", err)
+		server.Metrics.ScaleIOError("RemoveVolume")
+		writeScaleIOError(w, err)
+		return
+	}
+
+	err = server.Store.DeleteVolumeTags(info.ID)
+	if err != nil {
+		log.Debugln("DeleteVolumeTags Err:", err)
+	}
+
+	server.RecordEvent(types.EventVolumeUpdated, "", "Volume "+name+" deleted")
+
+	writeVolume(w, http.StatusOK, info)
+}
+
+func resizeVolume(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	name := mux.Vars(r)["name"]
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	resize := &types.ResizeVolume{}
+	if err := json.Unmarshal(body, &resize); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return
+	}
+	if resize.SizeInGB <= 0 || resize.SizeInGB%VolumeGranularityInGB != 0 {
+		writeError(w, "The size must be a multiple of "+strconv.Itoa(VolumeGranularityInGB)+"GB",
+			http.StatusBadRequest)
+		return
+	}
+
+	session, err := server.openScaleIO()
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	volume, found, err := server.findVolume(session, name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+	if !found {
+		writeScaleIOError(w, common.ErrVolumeNotFound)
+		return
+	}
+	if resize.SizeInGB*1024*1024 <= volume.SizeInKb {
+		writeError(w, "Volumes can only grow", http.StatusBadRequest)
+		return
+	}
+
+	scaleioVolume := goscaleio.NewVolume(session.client)
+	scaleioVolume.Volume = volume
+	err = scaleioVolume.SetVolumeSize(strconv.Itoa(resize.SizeInGB))
+	if err != nil {
+		log.Errorln("SetVolumeSize Error:", err)
+		server.Metrics.ScaleIOError("SetVolumeSize")
+		writeScaleIOError(w, err)
+		return
+	}
+
+	server.RecordEvent(types.EventVolumeUpdated, "", "Volume "+name+" resized to "+
+		strconv.Itoa(resize.SizeInGB)+"GB")
+
+	info, err := server.volumeInfo(session, name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	writeVolume(w, http.StatusOK, info)
+}
+
+func readVolumeMapping(w http.ResponseWriter, r *http.Request) *types.VolumeMapping {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		writeError(w, "Unable to read the HTTP Body stream", http.StatusBadRequest)
+		return nil
+	}
+	if err := r.Body.Close(); err != nil {
+		log.Warnln("Unable to close the HTTP Body stream:", err)
+	}
+
+	mapping := &types.VolumeMapping{}
+	if err := json.Unmarshal(body, &mapping); err != nil {
+		writeError(w, "Unable to marshall the response", http.StatusBadRequest)
+		return nil
+	}
+	if len(mapping.Hostname) == 0 {
+		writeError(w, "A hostname is required", http.StatusBadRequest)
+		return nil
+	}
+	return mapping
+}
+
+//changeMapping maps or unmaps a volume to the SDC on a node
+func changeMapping(w http.ResponseWriter, r *http.Request, server *RestServer, mapVolume bool) {
+	name := mux.Vars(r)["name"]
+
+	mapping := readVolumeMapping(w, r)
+	if mapping == nil {
+		return
+	}
+
+	session, err := server.openScaleIO()
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	volume, found, err := server.findVolume(session, name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+	if !found {
+		writeScaleIOError(w, common.ErrVolumeNotFound)
+		return
+	}
+
+	sdc, err := server.findSdc(session, mapping.Hostname)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	scaleioVolume := goscaleio.NewVolume(session.client)
+	scaleioVolume.Volume = volume
+	if mapVolume {
+		err = scaleioVolume.MapVolumeSdc(&siotypes.MapVolumeSdcParam{
+			SdcID:                 sdc.Sdc.ID,
+			AllowMultipleMappings: strconv.FormatBool(mapping.AllowMultiple),
+		})
+		if err != nil {
+			log.Errorln("MapVolumeSdc Error:", err)
+			server.Metrics.ScaleIOError("MapVolumeSdc")
+		}
+	} else {
+		err = scaleioVolume.UnmapVolumeSdc(&siotypes.UnmapVolumeSdcParam{
+			SdcID: sdc.Sdc.ID,
+		})
+		if err != nil {
+			log.Errorln("UnmapVolumeSdc Error:", err)
+			server.Metrics.ScaleIOError("UnmapVolumeSdc")
+		}
+	}
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	if mapVolume {
+		server.RecordEvent(types.EventVolumeUpdated, mapping.Hostname, "Volume "+name+" mapped")
+	} else {
+		server.RecordEvent(types.EventVolumeUpdated, mapping.Hostname, "Volume "+name+" unmapped")
+	}
+
+	info, err := server.volumeInfo(session, name)
+	if err != nil {
+		writeScaleIOError(w, err)
+		return
+	}
+
+	writeVolume(w, http.StatusOK, info)
+}
+
+func mapVolume(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	changeMapping(w, r, server, true)
+}
+
+func unmapVolume(w http.ResponseWriter, r *http.Request, server *RestServer) {
+	changeMapping(w, r, server, false)
+}
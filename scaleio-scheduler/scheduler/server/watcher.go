@@ -0,0 +1,359 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	common "github.com/codedellemc/scaleio-framework/scaleio-scheduler/scheduler/common"
+	types "github.com/codedellemc/scaleio-framework/scaleio-scheduler/types"
+)
+
+const (
+	//WatchPollInSeconds how often the store is re-read in case a watch is
+	//missed or the backend doesnt support watches (ie boltdb)
+	WatchPollInSeconds = 15
+)
+
+type applySetting func(s *RestServer, value string) (string, error)
+
+func applyString(get func(s *RestServer) string, set func(s *RestServer, value string)) applySetting {
+	return func(s *RestServer, value string) (string, error) {
+		old := get(s)
+		set(s, value)
+		return old, nil
+	}
+}
+
+func applyInt(get func(s *RestServer) int, set func(s *RestServer, value int)) applySetting {
+	return func(s *RestServer, value string) (string, error) {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return "", err
+		}
+		old := get(s)
+		set(s, i)
+		return strconv.Itoa(old), nil
+	}
+}
+
+//liveSettings are the keys under <root>/configuration that can be changed
+//while the framework is running. The key names match the command line flags.
+var liveSettings = map[string]applySetting{
+	"loglevel": func(s *RestServer, value string) (string, error) {
+		level, err := log.ParseLevel(value)
+		if err != nil {
+			return "", err
+		}
+		old := s.State.LogLevel
+		log.SetLevel(level)
+		s.Config.LogLevel = value
+		s.State.LogLevel = value
+		return old, nil
+	},
+	"aws.threshold": applyInt(
+		func(s *RestServer) int { return s.Config.UsedThreshold },
+		func(s *RestServer, value int) { s.Config.UsedThreshold = value }),
+	"aws.checkfull": func(s *RestServer, value string) (string, error) {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return "", err
+		}
+		if i <= 0 {
+			return "", strconv.ErrRange
+		}
+		old := s.Config.CheckFull
+		s.Config.CheckFull = i
+		return strconv.Itoa(old), nil
+	},
+	"aws.growthsize": applyInt(
+		func(s *RestServer) int { return s.Config.VolumeGrowthSize },
+		func(s *RestServer, value int) { s.Config.VolumeGrowthSize = value }),
+	"rexray.branch": applyString(
+		func(s *RestServer) string { return s.State.Rexray.Branch },
+		func(s *RestServer, value string) {
+			s.Config.RexrayBranch = value
+			s.State.Rexray.Branch = value
+		}),
+	"rexray.version": applyString(
+		func(s *RestServer) string { return s.State.Rexray.Version },
+		func(s *RestServer, value string) {
+			s.Config.RexrayVersion = value
+			s.State.Rexray.Version = value
+		}),
+	"isolator.binary": applyString(
+		func(s *RestServer) string { return s.State.Isolator.Binary },
+		func(s *RestServer, value string) {
+			s.Config.IsolatorBinary = value
+			s.State.Isolator.Binary = value
+		}),
+	"scaleio.ubuntu14.mdm": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Ubuntu14.Mdm },
+		func(s *RestServer, value string) {
+			s.Config.DebMdm = value
+			s.State.ScaleIO.Ubuntu14.Mdm = value
+		}),
+	"scaleio.ubuntu14.sds": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Ubuntu14.Sds },
+		func(s *RestServer, value string) {
+			s.Config.DebSds = value
+			s.State.ScaleIO.Ubuntu14.Sds = value
+		}),
+	"scaleio.ubuntu14.sdc": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Ubuntu14.Sdc },
+		func(s *RestServer, value string) {
+			s.Config.DebSdc = value
+			s.State.ScaleIO.Ubuntu14.Sdc = value
+		}),
+	"scaleio.ubuntu14.lia": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Ubuntu14.Lia },
+		func(s *RestServer, value string) {
+			s.Config.DebLia = value
+			s.State.ScaleIO.Ubuntu14.Lia = value
+		}),
+	"scaleio.ubuntu14.gw": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Ubuntu14.Gw },
+		func(s *RestServer, value string) {
+			s.Config.DebGw = value
+			s.State.ScaleIO.Ubuntu14.Gw = value
+		}),
+	"scaleio.rhel7.mdm": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Rhel7.Mdm },
+		func(s *RestServer, value string) {
+			s.Config.RpmMdm = value
+			s.State.ScaleIO.Rhel7.Mdm = value
+		}),
+	"scaleio.rhel7.sds": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Rhel7.Sds },
+		func(s *RestServer, value string) {
+			s.Config.RpmSds = value
+			s.State.ScaleIO.Rhel7.Sds = value
+		}),
+	"scaleio.rhel7.sdc": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Rhel7.Sdc },
+		func(s *RestServer, value string) {
+			s.Config.RpmSdc = value
+			s.State.ScaleIO.Rhel7.Sdc = value
+		}),
+	"scaleio.rhel7.lia": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Rhel7.Lia },
+		func(s *RestServer, value string) {
+			s.Config.RpmLia = value
+			s.State.ScaleIO.Rhel7.Lia = value
+		}),
+	"scaleio.rhel7.gw": applyString(
+		func(s *RestServer) string { return s.State.ScaleIO.Rhel7.Gw },
+		func(s *RestServer, value string) {
+			s.Config.RpmGw = value
+			s.State.ScaleIO.Rhel7.Gw = value
+		}),
+}
+
+func (s *RestServer) auditChange(hostname string, what string, oldValue string, newValue string) {
+	log.Infoln("[AUDIT]", what, "changed from", "\""+oldValue+"\"", "to",
+		"\""+newValue+"\"", "via the store")
+	s.RecordEvent(types.EventConfigChanged, hostname, what+" changed from \""+oldValue+
+		"\" to \""+newValue+"\" via the store")
+}
+
+//storeNode is the state of a node in the store along with the state it had
+//in memory before the store was read
+type storeNode struct {
+	node  *types.ScaleIONode
+	base  int
+	state int
+}
+
+//storeSnapshot is what readStore found in the store
+type storeSnapshot struct {
+	settings map[string]string
+	nodes    []*storeNode
+}
+
+//snapshotNodes remembers the state of each node before the store is read.
+//The caller must hold the lock.
+func snapshotNodes(nodes []*types.ScaleIONode) []*storeNode {
+	snapshot := make([]*storeNode, 0)
+	for _, node := range nodes {
+		if len(node.Hostname) == 0 {
+			continue
+		}
+		snapshot = append(snapshot, &storeNode{
+			node:  node,
+			base:  node.State,
+			state: node.State,
+		})
+	}
+	return snapshot
+}
+
+//readStore reads the live settings and the node states from the store. It
+//does not need the lock.
+func (s *RestServer) readStore(nodes []*storeNode) *storeSnapshot {
+	snapshot := &storeSnapshot{
+		settings: make(map[string]string),
+		nodes:    make([]*storeNode, 0),
+	}
+
+	for name := range liveSettings {
+		value, err := s.Store.GetSetting(name)
+		if err != nil {
+			//not set in the store
+			continue
+		}
+		snapshot.settings[name] = value
+	}
+
+	for _, node := range nodes {
+		_, state, err := s.Store.GetNodeInfo(node.node.Hostname)
+		if err != nil {
+			continue
+		}
+		node.state = state
+		snapshot.nodes = append(snapshot.nodes, node)
+	}
+
+	return snapshot
+}
+
+//mergeStore applies the changes found by readStore. Only the state is taken
+//from the store and only when the node is allowed to move there. Everything the
+//scheduler tracks on its own (ie liveness, last contact and retries) is kept.
+//The caller must hold the lock.
+func (s *RestServer) mergeStore(snapshot *storeSnapshot) {
+	for name, value := range snapshot.settings {
+		old, err := liveSettings[name](s, value)
+		if err != nil {
+			log.Warnln("Ignoring invalid value", value, "for", name, ". Err:", err)
+			continue
+		}
+		if old != value {
+			s.auditChange("", name, old, value)
+			s.Publish(&types.Delta{
+				Type:    types.DeltaClusterSetting,
+				Setting: name,
+				Value:   value,
+			})
+		}
+	}
+
+	for _, stored := range snapshot.nodes {
+		node := stored.node
+		if node.State != stored.base {
+			//the scheduler moved the node while the store was read. What was
+			//read is older than the node, the next sync picks up any edit.
+			log.Debugln("Node", node.Hostname, "changed while reading the store")
+			continue
+		}
+		if stored.state == node.State {
+			continue
+		}
+
+		//the store is held to the install lifecycle like the API. Moving a
+		//failed node back is the same as an operator retrying or resetting it.
+		previous := node.State
+		reason := "Changed in the store"
+		var err error
+		switch {
+		case types.IsValidRetry(node.State, node.Failure) && stored.state == node.Failure.State:
+			err = s.RetryNode(node, reason)
+		case node.State == types.StateFatalInstall && stored.state == types.StateUnknown:
+			err = s.resetNodeState(node, reason)
+		default:
+			_, err = s.TransitionNode(node, stored.state, reason)
+		}
+
+		if err == types.ErrInvalidStateTransition {
+			log.Warnln("Ignoring state", common.StateIDToString(stored.state), "of node",
+				node.Hostname, "in the store. Putting back",
+				common.StateIDToString(node.State))
+			if err := s.Store.SetNodeInfo(node.Hostname, node.Persona, node.State); err != nil {
+				log.Warnln("Failed to save state for", node.Hostname, ":", err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Warnln("Failed to save state for", node.Hostname, ":", err)
+		}
+
+		s.auditChange(node.Hostname, "state", common.StateIDToString(previous),
+			common.StateIDToString(stored.state))
+	}
+}
+
+//syncFromStore applies any changes found in the store to the running state.
+//The store is read without the lock so the API is not held up by the store.
+func (s *RestServer) syncFromStore() {
+	s.Lock()
+	nodes := snapshotNodes(s.State.ScaleIO.Nodes)
+	s.Unlock()
+
+	snapshot := s.readStore(nodes)
+
+	s.Lock()
+	s.mergeStore(snapshot)
+	s.Unlock()
+}
+
+func (s *RestServer) watchTree(dir string, trigger chan<- struct{}, closed chan<- string) bool {
+	events, err := s.Store.WatchTree(dir, nil)
+	if err != nil {
+		log.Debugln("WatchTree(", dir, ") not available. Err:", err)
+		return false
+	}
+
+	go func() {
+		for range events {
+			log.Debugln("Change detected under", dir)
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+		log.Debugln("WatchTree(", dir, ") closed")
+		closed <- dir
+	}()
+
+	return true
+}
+
+//WatchStore watches <root>/configuration and the node subtrees and applies
+//allowed changes to the running state
+func (s *RestServer) WatchStore() {
+	trigger := make(chan struct{}, 1)
+	closed := make(chan string, 16)
+	watching := make(map[string]bool)
+
+	for {
+		//re-establish watches that were closed (ie lost session)
+		for len(closed) > 0 {
+			delete(watching, <-closed)
+		}
+
+		if !watching["configuration"] {
+			watching["configuration"] = s.watchTree("configuration", trigger, closed)
+		}
+
+		s.Lock()
+		hostnames := make([]string, 0)
+		for _, node := range s.State.ScaleIO.Nodes {
+			hostnames = append(hostnames, node.Hostname)
+		}
+		s.Unlock()
+
+		for _, hostname := range hostnames {
+			dir := "configuration/" + hostname
+			if len(hostname) > 0 && !watching[dir] {
+				watching[dir] = s.watchTree(dir, trigger, closed)
+			}
+		}
+
+		s.syncFromStore()
+
+		select {
+		case <-trigger:
+		case <-time.After(time.Duration(WatchPollInSeconds) * time.Second):
+		}
+	}
+}
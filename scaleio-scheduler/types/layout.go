@@ -0,0 +1,50 @@
+package types
+
+//DefaultSdsName is the name of the SDS a node runs in a ProtectionDomain when
+//no SDS layout is declared for it
+func DefaultSdsName(ipAddress string) string {
+	return "sds_" + ipAddress
+}
+
+//GetSdss returns the SDSs a node runs in the ProtectionDomain. A single SDS
+//named after the node IP is returned when no layout is declared. SDSs without
+//IPs use the node IP.
+func (pd *ProtectionDomain) GetSdss(ipAddress string) []*Sds {
+	if pd == nil || len(pd.Sdss) == 0 {
+		return []*Sds{
+			{
+				Name: DefaultSdsName(ipAddress),
+				IPs:  []string{ipAddress},
+			},
+		}
+	}
+
+	sdss := make([]*Sds, 0, len(pd.Sdss))
+	for _, sds := range pd.Sdss {
+		ips := sds.IPs
+		if len(ips) == 0 {
+			ips = []string{ipAddress}
+		}
+		sdss = append(sdss, &Sds{
+			Name:    sds.Name,
+			IPs:     append([]string{}, ips...),
+			Port:    sds.Port,
+			Devices: append([]string{}, sds.Devices...),
+		})
+	}
+	return sdss
+}
+
+//SdsForDevice returns the name of the SDS a device is attached through.
+//Devices that are not listed in the layout go to the first SDS.
+func (pd *ProtectionDomain) SdsForDevice(ipAddress string, device string) string {
+	sdss := pd.GetSdss(ipAddress)
+	for _, sds := range sdss {
+		for _, tmpDevice := range sds.Devices {
+			if tmpDevice == device {
+				return sds.Name
+			}
+		}
+	}
+	return sdss[0].Name
+}
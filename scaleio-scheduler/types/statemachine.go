@@ -0,0 +1,80 @@
+package types
+
+import (
+	"errors"
+)
+
+var (
+	//ErrInvalidStateTransition the node cannot move from its current state to
+	//the requested state
+	ErrInvalidStateTransition = errors.New("The state transition is not allowed")
+)
+
+//StateTransitions is the install lifecycle of a node. Each state maps to the
+//states a node can move to next. Data nodes skip BasePackagedInstalled and
+//InitializeCluster since they only join the cluster. Any state can also move
+//to StateFatalInstall, and staying in the same state is always allowed since an
+//executor reports its state again after a restart. Nothing leads out of
+//StateFatalInstall, only a retry or an operator resetting the node moves it.
+//No state leads to StateDecommission, only an operator removing the node moves
+//it there. A decommissioned node goes nowhere since it is deleted.
+var StateTransitions = map[int][]int{
+	StateUnknown:                {StateCleanPrereqsReboot},
+	StateCleanPrereqsReboot:     {StatePrerequisitesInstalled},
+	StatePrerequisitesInstalled: {StateBasePackagedInstalled, StateAddResourcesToScaleIO},
+	StateBasePackagedInstalled:  {StateInitializeCluster},
+	StateInitializeCluster:      {StateAddResourcesToScaleIO},
+	StateAddResourcesToScaleIO:  {StateInstallRexRay},
+	StateInstallRexRay:          {StateCleanInstallReboot},
+	StateCleanInstallReboot:     {StateSystemReboot, StateFinishInstall},
+	StateSystemReboot:           {StateFinishInstall},
+	StateFinishInstall:          {StateUpgradeCluster},
+	StateUpgradeCluster:         {StateFinishInstall},
+	StateFatalInstall:           {},
+	StateDecommission:           {StateDecommissioned},
+	StateDecommissioned:         {},
+}
+
+//IsValidState is true when the state is part of the install lifecycle
+func IsValidState(state int) bool {
+	_, ok := StateTransitions[state]
+	return ok
+}
+
+//IsValidTransition is true when a node is allowed to move between the states
+func IsValidTransition(from int, to int) bool {
+	if !IsValidState(from) || !IsValidState(to) {
+		return false
+	}
+	if from == to {
+		return true
+	}
+	if from == StateDecommissioned {
+		return false
+	}
+	if to == StateFatalInstall {
+		return true
+	}
+	for _, next := range StateTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+//ValidateTransition returns ErrInvalidStateTransition when a node is not
+//allowed to move between the states
+func ValidateTransition(from int, to int) error {
+	if !IsValidTransition(from, to) {
+		return ErrInvalidStateTransition
+	}
+	return nil
+}
+
+//IsValidRetry is true when a node in StateFatalInstall can go back to the
+//state it failed in to try that step again
+func IsValidRetry(state int, failure *NodeFailure) bool {
+	return state == StateFatalInstall && failure != nil && IsValidState(failure.State) &&
+		failure.State != StateFatalInstall
+}
@@ -38,6 +38,21 @@ const (
 	DvdcliPackageName = "dvdcli"
 )
 
+const (
+	//ExecutorTokenEnv is the environment variable the scheduler uses to hand
+	//each executor its token
+	ExecutorTokenEnv = "SCALEIO_EXECUTOR_TOKEN"
+
+	//ExecutorIDHeader is the HTTP header an executor uses to identify itself
+	ExecutorIDHeader = "X-ScaleIO-Executor-ID"
+
+	//RedactedSecret replaces secrets in public views of the state
+	RedactedSecret = ""
+
+	//APIPrefix is the prefix of the current version of the REST API
+	APIPrefix = "/api/v1"
+)
+
 const (
 	//PersonaUnknown is unknown
 	PersonaUnknown = 0
@@ -92,6 +107,174 @@ const (
 	//StateFatalInstall the agent node installation had a fatal error
 	//manual intervention is required for now
 	StateFatalInstall = 4096
+
+	//StateDecommission the packages are being removed from the agent node
+	StateDecommission = 8192
+
+	//StateDecommissioned the packages are removed and the node can be deleted
+	StateDecommissioned = 16384
+)
+
+const (
+	//EventPersonaAssigned a persona was assigned to a node
+	EventPersonaAssigned = "PersonaAssigned"
+
+	//EventNodeStateChanged a node moved to a new state
+	EventNodeStateChanged = "NodeStateChanged"
+
+	//EventDomainCreated a ProtectionDomain was created
+	EventDomainCreated = "DomainCreated"
+
+	//EventSdsCreated an SDS was created
+	EventSdsCreated = "SdsCreated"
+
+	//EventPoolCreated a StoragePool was created
+	EventPoolCreated = "PoolCreated"
+
+	//EventDeviceAttached a device was added to a StoragePool
+	EventDeviceAttached = "DeviceAttached"
+
+	//EventDeviceRemoved a device was removed from a StoragePool
+	EventDeviceRemoved = "DeviceRemoved"
+
+	//EventPoolRemoved a StoragePool was removed
+	EventPoolRemoved = "PoolRemoved"
+
+	//EventSdsRemoved an SDS was removed
+	EventSdsRemoved = "SdsRemoved"
+
+	//EventDomainRemoved a ProtectionDomain was removed
+	EventDomainRemoved = "DomainRemoved"
+
+	//EventVolumeCreated an AWS volume was created and attached
+	EventVolumeCreated = "VolumeCreated"
+
+	//EventConfigChanged a setting was changed while running
+	EventConfigChanged = "ConfigChanged"
+
+	//EventMaintenanceChanged a node was put in or taken out of maintenance
+	EventMaintenanceChanged = "MaintenanceChanged"
+
+	//EventExpandRequested an operator asked for the StoragePools to be expanded
+	EventExpandRequested = "ExpandRequested"
+
+	//EventTopologyChanged the declared topology was replaced
+	EventTopologyChanged = "TopologyChanged"
+
+	//EventVolumeUpdated a ScaleIO volume was created, deleted, resized or mapped
+	EventVolumeUpdated = "VolumeUpdated"
+
+	//EventSnapshotPolicyRun a snapshot policy took and pruned snapshots
+	EventSnapshotPolicyRun = "SnapshotPolicyRun"
+
+	//EventNodeFailed a step of the install failed on a node
+	EventNodeFailed = "NodeFailed"
+
+	//EventUpgrade a rolling upgrade started, moved to another node or stopped
+	EventUpgrade = "Upgrade"
+
+	//EventDecommission a node decommission started, moved along or finished
+	EventDecommission = "Decommission"
+
+	//EventReboot a reboot lease was granted, released or expired
+	EventReboot = "Reboot"
+
+	//EventLivenessChanged a node went online, stale or offline
+	EventLivenessChanged = "LivenessChanged"
+
+	//EventHealthChanged the severity of the cluster health changed
+	EventHealthChanged = "HealthChanged"
+)
+
+const (
+	//HealthUnknown the health of the cluster has not been checked yet
+	HealthUnknown = "unknown"
+
+	//HealthOk nothing to report
+	HealthOk = "ok"
+
+	//HealthInfo ScaleIO is doing routine work such as rebalancing
+	HealthInfo = "info"
+
+	//HealthWarning the data is at risk or a component needs attention
+	HealthWarning = "warning"
+
+	//HealthCritical data is unavailable or ScaleIO can not be reached
+	HealthCritical = "critical"
+)
+
+const (
+	//LivenessUnknown the executor has not contacted the scheduler yet
+	LivenessUnknown = "unknown"
+
+	//LivenessOnline the executor pinged the scheduler recently
+	LivenessOnline = "online"
+
+	//LivenessStale the executor missed some pings
+	LivenessStale = "stale"
+
+	//LivenessOffline the executor stopped pinging or its task is gone
+	LivenessOffline = "offline"
+)
+
+const (
+	//UpgradeRunning the nodes are being upgraded one at a time
+	UpgradeRunning = "running"
+
+	//UpgradePaused a check failed or an operator paused the upgrade
+	UpgradePaused = "paused"
+
+	//UpgradeRollingBack the upgraded nodes are going back to the previous packages
+	UpgradeRollingBack = "rollingback"
+
+	//UpgradeComplete every node runs the new packages
+	UpgradeComplete = "complete"
+
+	//UpgradeRolledBack every node runs the previous packages again
+	UpgradeRolledBack = "rolledback"
+)
+
+const (
+	//DecommissionRemovingSds the SDS is migrating its data to the other nodes
+	DecommissionRemovingSds = "removingsds"
+
+	//DecommissionUnmapping the volumes are being unmapped from the SDC
+	DecommissionUnmapping = "unmapping"
+
+	//DecommissionUninstalling the executor is removing the packages
+	DecommissionUninstalling = "uninstalling"
+)
+
+const (
+	//DeltaNodeState the install state of a node changed
+	DeltaNodeState = "NodeState"
+
+	//DeltaPersonaAssigned a node joined the cluster with a persona
+	DeltaPersonaAssigned = "PersonaAssigned"
+
+	//DeltaDevicesAdvertised a node advertised its devices
+	DeltaDevicesAdvertised = "DevicesAdvertised"
+
+	//DeltaClusterConfigured the cluster was configured
+	DeltaClusterConfigured = "ClusterConfigured"
+
+	//DeltaClusterSetting a cluster setting was changed
+	DeltaClusterSetting = "ClusterSetting"
+
+	//DeltaNodeMaintenance a node was put in or taken out of maintenance
+	DeltaNodeMaintenance = "NodeMaintenance"
+
+	//DeltaResync the revision requested is too old. Fetch the full state.
+	DeltaResync = "Resync"
+
+	//DeltaNodeRemoved a node was decommissioned and removed from the cluster
+	DeltaNodeRemoved = "NodeRemoved"
+
+	//DeltaNodeLiveness a node went online, stale or offline
+	DeltaNodeLiveness = "NodeLiveness"
+
+	//DeltaClusterHealth the severity of the cluster health changed
+	DeltaClusterHealth = "ClusterHealth"
 )
 
 //Version describes the version of the REST API
@@ -127,10 +310,20 @@ type StoragePool struct {
 	KeyValue map[string]string `json:"keyvalue,omitempty"`
 }
 
+//Sds describes an SDS a node runs in a ProtectionDomain and the devices that
+//are attached through it
+type Sds struct {
+	Name    string   `json:"name"`
+	IPs     []string `json:"ips,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Devices []string `json:"devices,omitempty"`
+}
+
 //ProtectionDomain describes a ScaleIO ProtectionDomain
 type ProtectionDomain struct {
 	Name     string            `json:"name"`
 	KeyValue map[string]string `json:"keyvalue,omitempty"`
+	Sdss     []*Sds            `json:"sdss,omitempty"`
 	Pools    map[string]*StoragePool
 }
 
@@ -144,14 +337,42 @@ type ScaleIONode struct {
 	Hostname        string            `json:"hostname"`
 	Persona         int               `json:"persona"`
 	State           int               `json:"state"`
+	PreviousState   int               `json:"previousstate"`
+	StateChanged    int64             `json:"statechanged"`
+	StateReason     string            `json:"statereason,omitempty"`
 	LastContact     int64             `json:"lastcontact"`
+	Liveness        string            `json:"liveness,omitempty"`
+	TaskState       string            `json:"taskstate,omitempty"`
 	Imperative      bool              `json:"imperative"`
 	Advertised      bool              `json:"advertised"`
+	Maintenance     bool              `json:"maintenance"`
+	Failure         *NodeFailure      `json:"failure,omitempty"`
+	Decommission    *NodeDecommission `json:"decommission,omitempty"`
 	KeyValue        map[string]string `json:"keyvalue,omitempty"`
 	ProvidesDomains map[string]*ProtectionDomain
 	ConsumesDomains map[string]*ProtectionDomain
 }
 
+//NodeFailure describes the install step that failed on a node and the retries
+//of that step
+type NodeFailure struct {
+	State     int    `json:"state"`
+	Step      string `json:"step,omitempty"`
+	Output    string `json:"output,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Retries   int    `json:"retries"`
+	NextRetry int64  `json:"nextretry,omitempty"`
+}
+
+//NodeDecommission describes the removal of a node. Removing is the IDs of the
+//SDSs ScaleIO was asked to remove.
+type NodeDecommission struct {
+	Phase    string   `json:"phase"`
+	Started  int64    `json:"started"`
+	Removing []string `json:"removing,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
 //ScaleIONodes collection of ScaleIONode
 type ScaleIONodes []*ScaleIONode
 
@@ -200,6 +421,7 @@ type RexrayConfig struct {
 
 //ScaleIOFramework describes the overall framework state
 type ScaleIOFramework struct {
+	Revision         uint64            `json:"revision"`
 	SchedulerAddress string            `json:"scheduleraddress"`
 	LogLevel         string            `json:"loglevel"`     //optional. Default: info
 	Debug            bool              `json:"debug"`        //optional. Default: false
@@ -221,6 +443,9 @@ type UpdateNode struct {
 	Acknowledged bool              `json:"acknowledged"`
 	ExecutorID   string            `json:"executorid"`
 	State        int               `json:"state"`
+	Reason       string            `json:"reason,omitempty"`
+	FailedStep   string            `json:"failedstep,omitempty"`
+	Output       string            `json:"output,omitempty"`
 	KeyValue     map[string]string `json:"keyvalue,omitempty"`
 }
 
@@ -239,8 +464,281 @@ type PingNode struct {
 	KeyValue     map[string]string `json:"keyvalue,omitempty"`
 }
 
+//RebootLease asks the scheduler for permission to reboot a node or gives the
+//permission back when Release is set. Granted is false while the node has to
+//wait and Reason says why.
+type RebootLease struct {
+	Acknowledged bool              `json:"acknowledged"`
+	ExecutorID   string            `json:"executorid"`
+	Hostname     string            `json:"hostname,omitempty"`
+	Release      bool              `json:"release,omitempty"`
+	Granted      bool              `json:"granted"`
+	Reason       string            `json:"reason,omitempty"`
+	Started      int64             `json:"started,omitempty"`
+	Expires      int64             `json:"expires,omitempty"`
+	KeyValue     map[string]string `json:"keyvalue,omitempty"`
+}
+
+//NodeCredentials describes the secrets handed to an executor
+type NodeCredentials struct {
+	Acknowledged  bool              `json:"acknowledged"`
+	ExecutorID    string            `json:"executorid"`
+	AdminPassword string            `json:"adminpassword,omitempty"`
+	KeyValue      map[string]string `json:"keyvalue,omitempty"`
+}
+
 //UpdateUsedData describes simulating data used
 type UpdateUsedData struct {
 	Acknowledged bool `json:"acknowledged"`
 	FakeUsedData int  `json:"fakeuseddata"`
 }
+
+//Event describes something the framework did
+type Event struct {
+	Sequence  uint64            `json:"sequence"`
+	Timestamp int64             `json:"timestamp"`
+	Type      string            `json:"type"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Message   string            `json:"message"`
+	KeyValue  map[string]string `json:"keyvalue,omitempty"`
+}
+
+//NodeSds describes an SDS configured on a node
+type NodeSds struct {
+	Name    string   `json:"name"`
+	Mode    int      `json:"mode"`
+	IPs     []string `json:"ips,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Devices []string `json:"devices"`
+}
+
+//NodePool describes a StoragePool and the devices a node contributes to it
+type NodePool struct {
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+//NodeDomain describes a ProtectionDomain configured on a node
+type NodeDomain struct {
+	Name  string      `json:"name"`
+	Sdss  []*NodeSds  `json:"sdss"`
+	Pools []*NodePool `json:"pools"`
+}
+
+//NodeInfo describes a node merged with its metadata in the store
+type NodeInfo struct {
+	Hostname        string                       `json:"hostname"`
+	AgentID         string                       `json:"agentid"`
+	ExecutorID      string                       `json:"executorid"`
+	IPAddress       string                       `json:"ipaddress"`
+	Persona         int                          `json:"persona"`
+	PersonaName     string                       `json:"personaname"`
+	State           int                          `json:"state"`
+	StateName       string                       `json:"statename"`
+	PreviousState   int                          `json:"previousstate"`
+	StateChanged    int64                        `json:"statechanged"`
+	StateReason     string                       `json:"statereason,omitempty"`
+	LastContact     int64                        `json:"lastcontact"`
+	Liveness        string                       `json:"liveness"`
+	TaskState       string                       `json:"taskstate,omitempty"`
+	Imperative      bool                         `json:"imperative"`
+	Advertised      bool                         `json:"advertised"`
+	Maintenance     bool                         `json:"maintenance"`
+	Failure         *NodeFailure                 `json:"failure,omitempty"`
+	Decommission    *NodeDecommission            `json:"decommission,omitempty"`
+	Domains         []*NodeDomain                `json:"domains"`
+	ProvidesDomains map[string]*ProtectionDomain `json:"providesdomains,omitempty"`
+	ConsumesDomains map[string]*ProtectionDomain `json:"consumesdomains,omitempty"`
+}
+
+//APIError describes an error returned by the REST API
+type APIError struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+//Delta describes a single change to the state of the framework
+type Delta struct {
+	Revision    uint64   `json:"revision"`
+	Timestamp   int64    `json:"timestamp"`
+	Type        string   `json:"type"`
+	Hostname    string   `json:"hostname,omitempty"`
+	ExecutorID  string   `json:"executorid,omitempty"`
+	Persona     int      `json:"persona,omitempty"`
+	State       int      `json:"state,omitempty"`
+	Previous    int      `json:"previous,omitempty"`
+	Reason      string   `json:"reason,omitempty"`
+	Maintenance bool     `json:"maintenance,omitempty"`
+	Liveness    string   `json:"liveness,omitempty"`
+	Devices     []string `json:"devices,omitempty"`
+	Setting     string   `json:"setting,omitempty"`
+	Value       string   `json:"value,omitempty"`
+}
+
+//NodeMaintenance describes putting a node in or out of maintenance
+type NodeMaintenance struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+//PoolCapacity describes the capacity of a StoragePool
+type PoolCapacity struct {
+	Domain     string `json:"domain"`
+	Pool       string `json:"pool"`
+	CapacityKb uint64 `json:"capacitykb"`
+	UsedKb     uint64 `json:"usedkb"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+//Capacity describes the capacity of the cluster
+type Capacity struct {
+	CapacityKb    int             `json:"capacitykb"`
+	UsedKb        int             `json:"usedkb"`
+	FakeUsedKb    int             `json:"fakeusedkb"`
+	UsedThreshold int             `json:"usedthreshold"`
+	Pools         []*PoolCapacity `json:"pools"`
+}
+
+//Topology declares the ProtectionDomains, StoragePools and devices of the
+//cluster in place of agent attributes
+type Topology struct {
+	Domains []*TopologyDomain `json:"domains"`
+}
+
+//TopologyDomain declares a ProtectionDomain and the hosts that consume it.
+//Sdss declares the SDSs of a host when it runs more than one.
+type TopologyDomain struct {
+	Name      string            `json:"name"`
+	Pools     []*TopologyPool   `json:"pools"`
+	Sdss      map[string][]*Sds `json:"sdss,omitempty"`
+	Consumers []string          `json:"consumers,omitempty"`
+}
+
+//TopologyPool declares a StoragePool and the devices each host provides
+type TopologyPool struct {
+	Name    string              `json:"name"`
+	Devices map[string][]string `json:"devices"`
+}
+
+//VolumeInfo describes a ScaleIO volume
+type VolumeInfo struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	SizeInKb     int      `json:"sizeinkb"`
+	Type         string   `json:"type"`
+	Domain       string   `json:"domain"`
+	Pool         string   `json:"pool"`
+	AncestorID   string   `json:"ancestorid,omitempty"`
+	CreationTime int64    `json:"creationtime"`
+	MappedHosts  []string `json:"mappedhosts"`
+	Tags         []string `json:"tags"`
+}
+
+//CreateVolume describes a volume to create. Domain and Pool default to the
+//ProtectionDomain and StoragePool in the configuration.
+type CreateVolume struct {
+	Name     string   `json:"name"`
+	Domain   string   `json:"domain,omitempty"`
+	Pool     string   `json:"pool,omitempty"`
+	SizeInGB int      `json:"sizeingb"`
+	Thick    bool     `json:"thick"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+//ResizeVolume describes the new size of a volume
+type ResizeVolume struct {
+	SizeInGB int `json:"sizeingb"`
+}
+
+//VolumeMapping describes mapping a volume to the SDC on a node
+type VolumeMapping struct {
+	Hostname      string `json:"hostname"`
+	AllowMultiple bool   `json:"allowmultiple"`
+}
+
+//SnapshotPolicy takes periodic snapshots of the volumes in a StoragePool whose
+//name starts with Prefix and/or that have Tag. SourceDomain and SourcePool pick
+//the volumes. ScaleIO keeps a snapshot in the StoragePool of its volume.
+type SnapshotPolicy struct {
+	Name              string                `json:"name"`
+	Prefix            string                `json:"prefix,omitempty"`
+	Tag               string                `json:"tag,omitempty"`
+	SourceDomain      string                `json:"sourcedomain,omitempty"`
+	SourcePool        string                `json:"sourcepool,omitempty"`
+	IntervalInMinutes int                   `json:"intervalinminutes"`
+	Retention         int                   `json:"retention"`
+	Status            *SnapshotPolicyStatus `json:"status,omitempty"`
+}
+
+//SnapshotPolicyStatus describes the last run of a snapshot policy.
+//Snapshots are the IDs taken by the policy by volume ID, oldest first.
+type SnapshotPolicyStatus struct {
+	LastRun     int64               `json:"lastrun"`
+	LastSuccess int64               `json:"lastsuccess"`
+	Taken       int                 `json:"taken"`
+	Pruned      int                 `json:"pruned"`
+	Error       string              `json:"error,omitempty"`
+	Snapshots   map[string][]string `json:"snapshots"`
+}
+
+//UpgradeRequest describes the packages a rolling upgrade installs. Packages
+//left empty keep their current URI.
+type UpgradeRequest struct {
+	Ubuntu14          Ubuntu14Packages `json:"ubuntu14"`
+	Rhel7             Rhel7Packages    `json:"rhel7"`
+	RollbackOnFailure bool             `json:"rollbackonfailure"`
+}
+
+//HealthIssue describes something wrong with a component of the cluster.
+//Component is one of system, sds, device or pool.
+type HealthIssue struct {
+	Component string `json:"component"`
+	Name      string `json:"name"`
+	Hostname  string `json:"hostname,omitempty"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+//PoolHealth describes the data of a StoragePool and the rebuild and rebalance
+//still to do
+type PoolHealth struct {
+	Domain      string `json:"domain"`
+	Pool        string `json:"pool"`
+	Severity    string `json:"severity"`
+	FailedKb    int    `json:"failedkb"`
+	DegradedKb  int    `json:"degradedkb"`
+	RebuildKb   int    `json:"rebuildkb"`
+	RebalanceKb int    `json:"rebalancekb"`
+}
+
+//ClusterHealth is the last health check of the ScaleIO cluster. Severity is
+//the worst severity of the issues.
+type ClusterHealth struct {
+	Severity        string         `json:"severity"`
+	Checked         int64          `json:"checked"`
+	Changed         int64          `json:"changed"`
+	MdmMode         string         `json:"mdmmode,omitempty"`
+	MdmClusterState string         `json:"mdmclusterstate,omitempty"`
+	Issues          []*HealthIssue `json:"issues"`
+	Pools           []*PoolHealth  `json:"pools"`
+}
+
+//Upgrade describes a rolling upgrade. Order is the hostnames in the order they
+//are upgraded and Upgraded the hostnames that run the new packages. Rollback is
+//true once the upgrade is being undone.
+type Upgrade struct {
+	Status            string           `json:"status"`
+	Rollback          bool             `json:"rollback"`
+	Ubuntu14          Ubuntu14Packages `json:"ubuntu14"`
+	Rhel7             Rhel7Packages    `json:"rhel7"`
+	PreviousUbuntu14  Ubuntu14Packages `json:"previousubuntu14"`
+	PreviousRhel7     Rhel7Packages    `json:"previousrhel7"`
+	RollbackOnFailure bool             `json:"rollbackonfailure"`
+	Order             []string         `json:"order"`
+	Upgraded          []string         `json:"upgraded"`
+	Current           string           `json:"current,omitempty"`
+	CurrentStarted    int64            `json:"currentstarted,omitempty"`
+	Started           int64            `json:"started"`
+	Finished          int64            `json:"finished,omitempty"`
+	Error             string           `json:"error,omitempty"`
+}